@@ -0,0 +1,318 @@
+package goentangle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker settings.
+//
+// Zero values are replaced by the corresponding value from
+// DefaultCircuitBreakerSettings.
+type CircuitBreakerSettings struct {
+	// Failure rate between 0 and 1 at which the circuit opens.
+	FailureRate float64
+
+	// Minimum number of calls within a window before the failure rate is
+	// considered.
+	MinimumCalls int
+
+	// Window over which calls and failures are counted.
+	Window time.Duration
+
+	// Time the circuit stays open before probing.
+	OpenTimeout time.Duration
+
+	// Number of successful probes required to close a half-open circuit.
+	Probes int
+}
+
+// Default circuit breaker settings.
+var DefaultCircuitBreakerSettings = CircuitBreakerSettings{
+	FailureRate:  0.5,
+	MinimumCalls: 10,
+	Window:       10 * time.Second,
+	OpenTimeout:  5 * time.Second,
+	Probes:       1,
+}
+
+// Circuit state.
+type CircuitState uint8
+
+// Circuit states.
+const (
+	// Closed, calls pass through.
+	CircuitClosed CircuitState = iota
+
+	// Open, calls fail fast.
+	CircuitOpen
+
+	// Half-open, probe calls pass through.
+	CircuitHalfOpen
+)
+
+// Circuit state names.
+var circuitStateNames = map[CircuitState]string{
+	CircuitClosed:   "closed",
+	CircuitOpen:     "open",
+	CircuitHalfOpen: "half-open",
+}
+
+func (s CircuitState) String() string {
+	if name, ok := circuitStateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("<invalid: %d>", s)
+}
+
+// Circuit key.
+type circuitKey struct {
+	endpoint string
+	method   string
+}
+
+// Circuit.
+type circuit struct {
+	// State.
+	state CircuitState
+
+	// Start of the current window, or time the circuit opened.
+	since time.Time
+
+	// Calls in the current window.
+	calls int
+
+	// Failures in the current window.
+	failures int
+
+	// Probes in flight.
+	probing int
+
+	// Successful probes.
+	probed int
+}
+
+// Circuit breaker.
+//
+// Tracks the failure rate of calls per endpoint and method, and fails calls
+// fast with ErrCircuitOpen while the failure rate is too high. The endpoint is
+// identified by the connection description. Calls failing with an error, such
+// as ErrShutdown, an I/O error, ErrBadMessage or a context deadline, or with an
+// InternalServerError exception count as failures. Calls cancelled by their
+// caller count as neither successes nor failures.
+//
+// Install the circuit breaker by passing its Intercept method to
+// ClientConnHandler.Intercept.
+type CircuitBreaker struct {
+	// Settings.
+	settings CircuitBreakerSettings
+
+	// Circuits.
+	circuits map[circuitKey]*circuit
+
+	// Lock.
+	lock sync.Mutex
+
+	// Clock.
+	now func() time.Time
+}
+
+// New circuit breaker.
+func NewCircuitBreaker(settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.FailureRate <= 0 {
+		settings.FailureRate = DefaultCircuitBreakerSettings.FailureRate
+	}
+	if settings.MinimumCalls <= 0 {
+		settings.MinimumCalls = DefaultCircuitBreakerSettings.MinimumCalls
+	}
+	if settings.Window <= 0 {
+		settings.Window = DefaultCircuitBreakerSettings.Window
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultCircuitBreakerSettings.OpenTimeout
+	}
+	if settings.Probes <= 0 {
+		settings.Probes = DefaultCircuitBreakerSettings.Probes
+	}
+
+	return &CircuitBreaker{
+		settings: settings,
+		circuits: make(map[circuitKey]*circuit),
+		now:      time.Now,
+	}
+}
+
+// State of the circuit for an endpoint and method.
+func (b *CircuitBreaker) State(endpoint, method string) CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if c, ok := b.circuits[circuitKey{endpoint, method}]; ok {
+		b.advance(c)
+		return c.state
+	}
+
+	return CircuitClosed
+}
+
+// Intercept a call.
+//
+// Satisfies UnaryInterceptor.
+func (b *CircuitBreaker) Intercept(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+	key := circuitKey{call.Conn.Description(), call.Method}
+
+	probe, ok := b.allow(key)
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+
+	msg, err := next(ctx, call)
+	b.record(key, probe, circuitCallOutcome(msg, err))
+	return msg, err
+}
+
+// Call outcome.
+type callOutcome uint8
+
+// Call outcomes.
+const (
+	// Call succeeded.
+	callSucceeded callOutcome = iota
+
+	// Call failed.
+	callFailed
+
+	// Call was cancelled by its caller, and says nothing about the endpoint.
+	callCancelled
+)
+
+// Determine the outcome of a call result.
+func circuitCallOutcome(msg Message, err error) callOutcome {
+	if errors.Is(err, context.Canceled) {
+		return callCancelled
+	} else if err != nil {
+		return callFailed
+	}
+
+	if exc, ok := msg.(*ExceptionMessage); ok && exc.Is(InternalServerError) {
+		return callFailed
+	}
+
+	return callSucceeded
+}
+
+// Move a circuit to the state dictated by the clock.
+//
+// Must be called with the lock held.
+func (b *CircuitBreaker) advance(c *circuit) {
+	now := b.now()
+
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.since) >= b.settings.Window {
+			c.since = now
+			c.calls = 0
+			c.failures = 0
+		}
+
+	case CircuitOpen:
+		if now.Sub(c.since) >= b.settings.OpenTimeout {
+			c.state = CircuitHalfOpen
+			c.probing = 0
+			c.probed = 0
+		}
+	}
+}
+
+// Determine if a call is allowed, and if it is a probe.
+func (b *CircuitBreaker) allow(key circuitKey) (probe bool, ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c, exists := b.circuits[key]
+	if !exists {
+		c = &circuit{
+			since: b.now(),
+		}
+		b.circuits[key] = c
+	}
+
+	b.advance(c)
+
+	switch c.state {
+	case CircuitOpen:
+		return false, false
+
+	case CircuitHalfOpen:
+		if c.probing+c.probed >= b.settings.Probes {
+			return false, false
+		}
+
+		c.probing++
+		return true, true
+	}
+
+	return false, true
+}
+
+// Record the outcome of a call.
+//
+// Cancelled calls are not counted, but a cancelled probe makes room for
+// another probe.
+func (b *CircuitBreaker) record(key circuitKey, probe bool, outcome callOutcome) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuits[key]
+
+	if probe {
+		// The circuit may have been reopened by another probe in the
+		// meantime.
+		if c.state != CircuitHalfOpen {
+			return
+		}
+
+		c.probing--
+
+		if outcome == callFailed {
+			b.open(c)
+		} else if outcome == callCancelled {
+			return
+		} else if c.probed++; c.probed >= b.settings.Probes {
+			c.state = CircuitClosed
+			c.since = b.now()
+			c.calls = 0
+			c.failures = 0
+		}
+
+		return
+	}
+
+	if c.state != CircuitClosed || outcome == callCancelled {
+		return
+	}
+
+	b.advance(c)
+
+	c.calls++
+	if outcome == callFailed {
+		c.failures++
+	}
+
+	if c.calls >= b.settings.MinimumCalls && float64(c.failures)/float64(c.calls) >= b.settings.FailureRate {
+		b.open(c)
+	}
+}
+
+// Open a circuit.
+func (b *CircuitBreaker) open(c *circuit) {
+	c.state = CircuitOpen
+	c.since = b.now()
+}
@@ -0,0 +1,132 @@
+package goentangle
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(CircuitBreakerSettings{
+		FailureRate:  0.5,
+		MinimumCalls: 4,
+		Window:       time.Minute,
+		OpenTimeout:  time.Second,
+		Probes:       1,
+	})
+	breaker.now = func() time.Time {
+		return now
+	}
+
+	conn, peer := newTestingConnPipe()
+	defer conn.Close()
+	defer peer.Close()
+	call := &Call{
+		Conn:   conn,
+		Method: "method",
+	}
+
+	invoked := 0
+	var result error
+	invoker := func(ctx context.Context, call *Call) (Message, error) {
+		invoked++
+		if result != nil {
+			return nil, result
+		}
+		return &ResponseMessage{}, nil
+	}
+
+	invoke := func(expected error) {
+		invoked = 0
+		if _, err := breaker.Intercept(context.Background(), call, invoker); err != expected {
+			t.Errorf("Expected '%v' from call, but got '%v'", expected, err)
+		}
+	}
+
+	state := func(expected CircuitState) {
+		if actual := breaker.State(conn.Description(), call.Method); actual != expected {
+			t.Errorf("Expected circuit to be %v, but it is %v", expected, actual)
+		}
+	}
+
+	// Two successes and two failures open the circuit.
+	invoke(nil)
+	invoke(nil)
+	result = ErrShutdown
+	invoke(ErrShutdown)
+	state(CircuitClosed)
+	invoke(ErrShutdown)
+	state(CircuitOpen)
+
+	// Calls fail fast while the circuit is open.
+	invoke(ErrCircuitOpen)
+	if invoked != 0 {
+		t.Errorf("Expected call not to be invoked while the circuit is open")
+	}
+
+	// Other methods are unaffected.
+	if breaker.State(conn.Description(), "other") != CircuitClosed {
+		t.Errorf("Expected circuit for other method to be closed")
+	}
+
+	// A failed probe reopens the circuit.
+	now = now.Add(time.Second)
+	state(CircuitHalfOpen)
+	invoke(ErrShutdown)
+	if invoked != 1 {
+		t.Errorf("Expected probe call to be invoked")
+	}
+	state(CircuitOpen)
+
+	// A successful probe closes the circuit.
+	now = now.Add(time.Second)
+	result = nil
+	invoke(nil)
+	state(CircuitClosed)
+
+	// A cancelled probe neither closes nor reopens the circuit, and makes room
+	// for another probe.
+	result = ErrShutdown
+	invoke(ErrShutdown)
+	invoke(ErrShutdown)
+	invoke(ErrShutdown)
+	invoke(ErrShutdown)
+	state(CircuitOpen)
+	now = now.Add(time.Second)
+	result = context.Canceled
+	invoke(context.Canceled)
+	state(CircuitHalfOpen)
+	result = nil
+	invoke(nil)
+	state(CircuitClosed)
+
+	// Errors and internal server errors count as failures, other exceptions
+	// do not, and cancellations are neutral.
+	for _, test := range []struct {
+		msg      Message
+		err      error
+		expected callOutcome
+	}{
+		{&ResponseMessage{}, nil, callSucceeded},
+		{nil, ErrShutdown, callFailed},
+		{nil, ErrBadMessage, callFailed},
+		{nil, io.ErrUnexpectedEOF, callFailed},
+		{nil, context.DeadlineExceeded, callFailed},
+		{nil, context.Canceled, callCancelled},
+		{exceptionMessage(InternalServerError.New("failure")), nil, callFailed},
+		{exceptionMessage(UnknownMethodError.New("failure")), nil, callSucceeded},
+	} {
+		if outcome := circuitCallOutcome(test.msg, test.err); outcome != test.expected {
+			t.Errorf("Expected outcome %d for %v, %v, but got %d", test.expected, test.msg, test.err, outcome)
+		}
+	}
+}
+
+func exceptionMessage(exc Exception) *ExceptionMessage {
+	return &ExceptionMessage{
+		Definition: exc.Definition(),
+		Name:       exc.Name(),
+	}
+}
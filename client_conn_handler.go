@@ -1,6 +1,7 @@
 package goentangle
 
 import (
+	"context"
 	"errors"
 	"io"
 	"sync"
@@ -9,6 +10,18 @@ import (
 // Client connection is shut down.
 var ErrShutdown = errors.New("connection is shut down")
 
+// Caller.
+//
+// Call surface of clients, implemented by ClientConnHandler. Code depending on
+// Entangle services can accept a Caller to be tested against a mock client.
+type Caller interface {
+	// Call a remote function.
+	Call(method string, args []interface{}, notify bool, trace bool) (resp Message, err error)
+
+	// Call a remote function with a context.
+	CallContext(ctx context.Context, method string, args []interface{}, notify bool, trace bool) (resp Message, err error)
+}
+
 // Client connection handler.
 //
 // Convenience type for handling requests and responses for clients.
@@ -30,6 +43,9 @@ type ClientConnHandler struct {
 
 	// Lock for state.
 	stateLock sync.Mutex
+
+	// Interceptors.
+	interceptors []UnaryInterceptor
 }
 
 // Receive messages and dispatch.
@@ -85,6 +101,40 @@ func (h *ClientConnHandler) receive() {
 
 // Call a remote function.
 func (h *ClientConnHandler) Call(method string, args []interface{}, notify bool, trace bool) (resp Message, err error) {
+	return h.CallContext(context.Background(), method, args, notify, trace)
+}
+
+// Call a remote function with a context.
+//
+// If the context is done before the response arrives, the call is abandoned
+// and the context's error is returned. The call is passed through the
+// handler's interceptors.
+func (h *ClientConnHandler) CallContext(ctx context.Context, method string, args []interface{}, notify bool, trace bool) (resp Message, err error) {
+	h.stateLock.Lock()
+	interceptors := h.interceptors
+	h.stateLock.Unlock()
+
+	return chainUnaryInvoker(interceptors, h.invoke)(ctx, &Call{
+		Conn:         h.conn,
+		Method:       method,
+		Arguments:    args,
+		Notification: notify,
+		Trace:        trace,
+	})
+}
+
+// Add interceptors.
+//
+// Interceptors wrap every subsequent call, the first added being the
+// outermost.
+func (h *ClientConnHandler) Intercept(interceptors ...UnaryInterceptor) {
+	h.stateLock.Lock()
+	defer h.stateLock.Unlock()
+	h.interceptors = append(h.interceptors[:len(h.interceptors):len(h.interceptors)], interceptors...)
+}
+
+// Invoke a call.
+func (h *ClientConnHandler) invoke(ctx context.Context, call *Call) (resp Message, err error) {
 	// Make sure we're in normal operating state.
 	h.stateLock.Lock()
 	if h.shutdown || h.closing {
@@ -94,16 +144,20 @@ func (h *ClientConnHandler) Call(method string, args []interface{}, notify bool,
 	}
 	h.stateLock.Unlock()
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	// Acquire the lock for the pending table.
 	h.pendingLock.Lock()
 
 	// Send the message.
 	var msgId MessageId
 
-	if notify {
-		msgId, err = h.conn.SendNotification(method, args)
+	if call.Notification {
+		msgId, err = h.conn.SendNotification(call.Method, call.Arguments)
 	} else {
-		msgId, err = h.conn.SendRequest(method, args, trace)
+		msgId, err = h.conn.SendRequest(call.Method, call.Arguments, call.Trace)
 	}
 
 	if err != nil {
@@ -121,11 +175,20 @@ func (h *ClientConnHandler) Call(method string, args []interface{}, notify bool,
 	h.pending[msgId] = done
 	h.pendingLock.Unlock()
 
-	// Wait for the response.
-	defer close(done)
-	if resp = <-done; resp == nil {
-		err = ErrShutdown
-		return
+	// Wait for the response or for the context to be done. The channel is
+	// buffered, so the receiver never blocks on an abandoned call.
+	select {
+	case resp = <-done:
+		if resp == nil {
+			err = ErrShutdown
+		}
+
+	case <-ctx.Done():
+		h.pendingLock.Lock()
+		delete(h.pending, msgId)
+		h.pendingLock.Unlock()
+
+		err = ctx.Err()
 	}
 
 	return
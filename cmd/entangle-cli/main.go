@@ -0,0 +1,152 @@
+// Command entangle-cli calls methods of Entangle services from the command
+// line.
+//
+// Usage:
+//
+//	entangle-cli [flags] address method [argument ...]
+//	entangle-cli [flags] -describe address
+//
+// The address is either host:port for TCP or unix:path for a Unix socket.
+// Each argument is a JSON value, which is converted to the corresponding
+// msgpack value: integral numbers become integers, other numbers floating
+// point numbers, and objects maps.
+//
+// The result of a request is printed as indented JSON, with binary data
+// base64-encoded and extension types such as times and decimals as strings.
+// Exceptions are printed with their definition, name and description, and
+// make the command exit with status 1. If tracing is requested, the trace
+// tree is printed with the duration of every trace.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/entangle/goentangle"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Call options.
+type options struct {
+	// Send a notification rather than a request.
+	notify bool
+
+	// Request a trace.
+	trace bool
+
+	// Describe the service rather than calling a method.
+	describe bool
+}
+
+func main() {
+	var (
+		opts    options
+		timeout = flag.Duration("timeout", 10*time.Second, "timeout for connecting and calling")
+	)
+
+	flag.BoolVar(&opts.notify, "notify", false, "send a notification rather than a request")
+	flag.BoolVar(&opts.trace, "trace", false, "request and print a trace")
+	flag.BoolVar(&opts.describe, "describe", false, "describe the methods of the service")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] address method [argument ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -describe address\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (opts.describe && flag.NArg() != 1) || (!opts.describe && flag.NArg() < 2) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	netConn, err := dial(ctx, flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "entangle-cli: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := goentangle.NewClientConnHandler(goentangle.NewConn(netConn, flag.Arg(0)))
+	defer client.Close()
+
+	if err = run(ctx, client, os.Stdout, opts, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "entangle-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Connect to an address.
+//
+// Addresses prefixed with unix: are Unix socket paths, others TCP addresses.
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// Perform a call and print the reply.
+//
+// The first argument is the method, followed by its JSON arguments, unless
+// the service is described. Exceptions are printed and returned as errors.
+func run(ctx context.Context, client *goentangle.ClientConnHandler, out io.Writer, opts options, args []string) error {
+	if opts.describe {
+		descriptions, err := client.Describe(ctx)
+		if err != nil {
+			return err
+		}
+
+		printDescriptions(out, descriptions)
+		return nil
+	}
+
+	callArgs, err := parseArguments(args[1:])
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.CallContext(ctx, args[0], callArgs, opts.notify, opts.trace)
+	if err != nil {
+		return err
+	}
+
+	switch resp := resp.(type) {
+	case *goentangle.ResponseMessage:
+		if err = printValue(out, resp.Result); err != nil {
+			return err
+		}
+
+		if resp.Trace != nil {
+			fmt.Fprintln(out)
+			printTrace(out, resp.Trace)
+		}
+
+	case *goentangle.ExceptionMessage:
+		fmt.Fprintf(out, "Exception %s.%s: %s\n", resp.Definition, resp.Name, resp.Description)
+
+		if resp.Trace != nil {
+			fmt.Fprintln(out)
+			printTrace(out, resp.Trace)
+		}
+
+		return resp.Exception()
+
+	case *goentangle.NotificationAcknowledgementMessage:
+		fmt.Fprintln(out, "Notification acknowledged")
+
+	default:
+		return goentangle.ErrBadMessage
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/entangle/goentangle"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestingClient(t *testing.T) *goentangle.ClientConnHandler {
+	dispatcher := goentangle.NewDispatcher()
+	dispatcher.Handle("echo", func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {
+		if trace != nil {
+			trace.Begin("inner").End()
+		}
+		return call.Arguments, nil
+	})
+	dispatcher.Handle("fail", func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {
+		return nil, goentangle.NewExceptionDefinition("test", "Failure").New("failed")
+	})
+	dispatcher.Describe(goentangle.MethodDescription{
+		Name: "fail",
+		Doc:  "Always fail.",
+		Exceptions: []goentangle.ExceptionDefinition{
+			goentangle.NewExceptionDefinition("test", "Failure"),
+		},
+	})
+
+	clientConn, serverConn := net.Pipe()
+	go goentangle.NewServer(dispatcher).ServeConn(goentangle.NewConn(serverConn, "server"))
+
+	client := goentangle.NewClientConnHandler(goentangle.NewConn(clientConn, "client"))
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+func runTesting(t *testing.T, opts options, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var out bytes.Buffer
+	err := run(ctx, newTestingClient(t), &out, opts, args)
+	return out.String(), err
+}
+
+// Test calling a method.
+func TestRunRequest(t *testing.T) {
+	out, err := runTesting(t, options{}, "echo", `{"a": [1, 2.5]}`, `"text"`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "[\n  {\n    \"a\": [\n      1,\n      2.5\n    ]\n  },\n  \"text\"\n]\n"
+	if out != expected {
+		t.Errorf("Expected output %q, but got %q", expected, out)
+	}
+}
+
+// Test calling a method with tracing.
+func TestRunTrace(t *testing.T) {
+	out, err := runTesting(t, options{trace: true}, "echo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(out, "[]\n\necho (") || !strings.Contains(out, "\n  inner (") {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+// Test sending a notification.
+func TestRunNotification(t *testing.T) {
+	out, err := runTesting(t, options{notify: true}, "echo", "1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if out != "Notification acknowledged\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+// Test that exceptions are printed and returned.
+func TestRunException(t *testing.T) {
+	out, err := runTesting(t, options{}, "fail")
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("Expected exception error, but got %v", err)
+	}
+
+	if out != "Exception test.Failure: failed\n" {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+// Test describing a service.
+func TestRunDescribe(t *testing.T) {
+	out, err := runTesting(t, options{describe: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(out, "echo()\n\nentangle.describe() []MethodDescription\n") ||
+		!strings.HasSuffix(out, "\nfail() raises test.Failure\n    Always fail.\n") {
+		t.Errorf("Unexpected output: %q", out)
+	}
+}
+
+// Test that invalid arguments are rejected.
+func TestRunInvalidArguments(t *testing.T) {
+	if _, err := runTesting(t, options{}, "echo", "{"); err == nil {
+		t.Errorf("Expected error for invalid JSON")
+	}
+
+	if _, err := runTesting(t, options{}, "echo", "1 2"); err == nil {
+		t.Errorf("Expected error for trailing data")
+	}
+}
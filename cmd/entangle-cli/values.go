@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/entangle/goentangle"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse JSON arguments.
+func parseArguments(args []string) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+
+	for i, arg := range args {
+		decoder := json.NewDecoder(strings.NewReader(arg))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+
+		if decoder.More() {
+			return nil, fmt.Errorf("argument %d: unexpected data after JSON value", i+1)
+		}
+
+		values[i] = convertJSON(value)
+	}
+
+	return values, nil
+}
+
+// Convert a decoded JSON value for sending.
+//
+// Integral numbers are converted into integers and other numbers into
+// floating point numbers.
+func convertJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		} else if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u
+		}
+
+		f, _ := v.Float64()
+		return f
+
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertJSON(e)
+		}
+
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertJSON(e)
+		}
+	}
+
+	return value
+}
+
+// Convert a received value for printing as JSON.
+//
+// Map keys are converted into strings, and extension types into their string
+// representations.
+func formatValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int64, uint64, float32, float64, string, []byte:
+		return v
+
+	case []interface{}:
+		formatted := make([]interface{}, len(v))
+		for i, e := range v {
+			formatted[i] = formatValue(e)
+		}
+		return formatted
+
+	case map[interface{}]interface{}:
+		formatted := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(formatValue(k))
+			}
+			formatted[key] = formatValue(e)
+		}
+		return formatted
+
+	case map[string]interface{}:
+		formatted := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			formatted[k] = formatValue(e)
+		}
+		return formatted
+	}
+
+	if _, formatted, ok := goentangle.FormatExtValue(value); ok {
+		return formatted
+	}
+
+	return fmt.Sprint(value)
+}
+
+// Print a value as indented JSON.
+func printValue(out io.Writer, value interface{}) error {
+	encoded, err := json.MarshalIndent(formatValue(value), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", encoded)
+	return err
+}
+
+// Print a trace tree.
+//
+// Every trace is printed with its duration, sub-traces indented below it.
+func printTrace(out io.Writer, trace goentangle.Trace) {
+	printSerializedTrace(out, trace.Serialize(), 0)
+}
+
+// Print a serialized trace at a depth.
+func printSerializedTrace(out io.Writer, trace interface{}, depth int) {
+	fields, _ := trace.([]interface{})
+	if len(fields) < 4 {
+		return
+	}
+
+	description, _ := goentangle.DeserializeString(fields[0])
+	start, _ := goentangle.DeserializeInt64(fields[1])
+	end, _ := goentangle.DeserializeInt64(fields[2])
+
+	fmt.Fprintf(out, "%s%s (%s)\n", strings.Repeat("  ", depth), description, time.Duration(end-start))
+
+	subTraces, _ := fields[3].([]interface{})
+	for _, subTrace := range subTraces {
+		printSerializedTrace(out, subTrace, depth+1)
+	}
+}
+
+// Print method descriptions.
+func printDescriptions(out io.Writer, descriptions []goentangle.MethodDescription) {
+	for i, description := range descriptions {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+
+		args := make([]string, len(description.Arguments))
+		for j, arg := range description.Arguments {
+			args[j] = arg.Name + " " + arg.Type
+		}
+
+		signature := description.Name + "(" + strings.Join(args, ", ") + ")"
+		if description.Result != "" {
+			signature += " " + description.Result
+		}
+
+		if len(description.Exceptions) > 0 {
+			raises := make([]string, len(description.Exceptions))
+			for j, definition := range description.Exceptions {
+				definitionName, name := goentangle.ExceptionDefinitionNames(definition)
+				raises[j] = definitionName + "." + name
+			}
+			signature += " raises " + strings.Join(raises, ", ")
+		}
+
+		fmt.Fprintln(out, signature)
+
+		if description.Doc != "" {
+			for _, line := range strings.Split(description.Doc, "\n") {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/entangle/goentangle"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test converting JSON arguments.
+func TestParseArguments(t *testing.T) {
+	values, err := parseArguments([]string{`-1`, `18446744073709551615`, `1.5`, `[true, null, {"k": 2}]`})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []interface{}{
+		int64(-1),
+		uint64(18446744073709551615),
+		1.5,
+		[]interface{}{true, nil, map[string]interface{}{"k": int64(2)}},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %#v, but got %#v", expected, values)
+	}
+}
+
+// Test converting received values for printing.
+func TestFormatValue(t *testing.T) {
+	decimal, _ := goentangle.ParseDecimal("-1.25")
+
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected interface{}
+	}{
+		{int64(1), int64(1)},
+		{[]byte("b"), []byte("b")},
+		{map[interface{}]interface{}{int64(1): "a"}, map[string]interface{}{"1": "a"}},
+		{goentangle.SerializeTime(time.Unix(0, 5).UTC()), "1970-01-01T00:00:00.000000005Z"},
+		{goentangle.SerializeDuration(time.Second), "1s"},
+		{goentangle.SerializeBigInt(big.NewInt(-7)), "-7"},
+		{goentangle.SerializeDecimal(decimal), "-1.25"},
+	} {
+		if actual := formatValue(testCase.Input); !reflect.DeepEqual(actual, testCase.Expected) {
+			t.Errorf("Expected %#v to format as %#v, but got %#v", testCase.Input, testCase.Expected, actual)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Command entangle-dump prints the Entangle messages in raw byte streams.
+//
+// Usage:
+//
+//	entangle-dump [flags] [file ...]
+//
+// Each file, or the standard input if no file is given, is read as the raw
+// byte stream of one direction of a connection, for example a payload
+// extracted from a packet capture. Every message is printed with its byte
+// offset, length, opcode, message ID and fields, compressed messages being
+// expanded. Invalid messages are reported with their byte offsets, and make
+// the command exit with status 1.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/entangle/goentangle"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	hexInput := flag.Bool("hex", false, "read hexadecimal input, ignoring whitespace")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	failed := false
+	for i, file := range files {
+		if len(files) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", file)
+		}
+
+		if err := dumpFile(os.Stdout, file, *hexInput); err != nil {
+			fmt.Fprintf(os.Stderr, "entangle-dump: %s: %v\n", file, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Dump the messages of a file.
+//
+// The file - is the standard input.
+func dumpFile(out io.Writer, file string, hexInput bool) error {
+	var input io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	if hexInput {
+		text, err := io.ReadAll(input)
+		if err != nil {
+			return err
+		}
+
+		data, err := hex.DecodeString(strings.Join(strings.Fields(string(text)), ""))
+		if err != nil {
+			return err
+		}
+		input = bytes.NewReader(data)
+	}
+
+	return goentangle.Dump(out, input)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/entangle/goentangle"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test dumping files.
+func TestDumpFile(t *testing.T) {
+	dir := t.TempDir()
+
+	raw := filepath.Join(dir, "raw")
+	if err := os.WriteFile(raw, []byte{0x92, 0x04, 0x01}, 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	hexFile := filepath.Join(dir, "hex")
+	if err := os.WriteFile(hexFile, []byte("92 04 01\n92 04\n"), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := dumpFile(&out, raw, false); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if expected := "offset 0, 3 bytes: notification acknowledgement, message ID 1\n"; out.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := dumpFile(&out, hexFile, true); !errors.Is(err, goentangle.ErrInvalidMessageData) {
+		t.Errorf("Expected %v, but got %v", goentangle.ErrInvalidMessageData, err)
+	}
+
+	if err := dumpFile(&out, raw, true); err == nil {
+		t.Errorf("Expected error for invalid hexadecimal input")
+	}
+
+	if err := dumpFile(&out, filepath.Join(dir, "missing"), false); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
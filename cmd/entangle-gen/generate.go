@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	gotoken "go/token"
+	"strings"
+	"unicode"
+)
+
+// Names used by generated code, which parameters must not shadow.
+var reservedNames = map[string]bool{
+	"c":          true,
+	"call":       true,
+	"ctx":        true,
+	"dispatcher": true,
+	"err":        true,
+	"goentangle": true,
+	"context":    true,
+	"policy":     true,
+	"resp":       true,
+	"result":     true,
+	"server":     true,
+	"trace":      true,
+	"value":      true,
+}
+
+// Exported Go name of an interface definition name.
+//
+// Underscore-separated words are joined and capitalized, so get_user and
+// getUser both become GetUser.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if word == "" {
+			continue
+		}
+		runes := []rune(word)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+	return b.String()
+}
+
+// Local Go name of an interface definition name.
+func localName(name string) string {
+	local := exportedName(name)
+	if local != "" {
+		runes := []rune(local)
+		runes[0] = unicode.ToLower(runes[0])
+		local = string(runes)
+	}
+
+	if gotoken.IsKeyword(local) || reservedNames[local] {
+		local += "_"
+	}
+	return local
+}
+
+// Exception definition variable name.
+func exceptionName(name string) string {
+	name = exportedName(name)
+	if !strings.HasSuffix(name, "Error") {
+		name += "Error"
+	}
+	return name
+}
+
+// Go type of a type.
+func goType(t *Type) string {
+	switch t.Kind {
+	case PrimitiveKind:
+		if t.Name == "binary" {
+			return "[]byte"
+		}
+		return t.Name
+	case ListKind:
+		return "[]" + goType(t.Elem)
+	case MapKind:
+		return "map[" + goType(t.Key) + "]" + goType(t.Elem)
+	case OptionalKind:
+		return "*" + goType(t.Elem)
+	}
+
+	return exportedName(t.Name)
+}
+
+// Expression deserializing an expression of a type.
+//
+// The expression evaluates to the deserialized value and an error, and
+// deserializes with the coercion policy in the variable policy.
+func deserializer(t *Type, expr string) string {
+	// Element deserializer of a collection.
+	element := func(t *Type) string {
+		return fmt.Sprintf("func(input interface{}) (%s, error) { return %s }", goType(t), deserializer(t, "input"))
+	}
+
+	switch t.Kind {
+	case PrimitiveKind:
+		return fmt.Sprintf("goentangle.DeserializeWithPolicy[%s](%s, policy)", goType(t), expr)
+	case ListKind:
+		return fmt.Sprintf("goentangle.DeserializeList(%s, %s)", expr, element(t.Elem))
+	case MapKind:
+		return fmt.Sprintf("goentangle.DeserializeMap(%s, %s, %s)", expr, element(t.Key), element(t.Elem))
+	case OptionalKind:
+		return fmt.Sprintf("goentangle.DeserializeOptional(%s, %s)", expr, element(t.Elem))
+	}
+
+	return fmt.Sprintf("Deserialize%sWithPolicy(%s, policy)", exportedName(t.Name), expr)
+}
+
+// Expression serializing an expression of a type.
+func serializer(t *Type, expr string) string {
+	switch t.Kind {
+	case EnumKind:
+		return "int64(" + expr + ")"
+
+	case StructKind:
+		return "Serialize" + exportedName(t.Name) + "(" + expr + ")"
+
+	case ListKind:
+		if elem := serializer(t.Elem, "e"); elem != "e" {
+			return fmt.Sprintf(`func(v %s) interface{} {
+				if v == nil {
+					return nil
+				}
+				s := make([]interface{}, len(v))
+				for i, e := range v {
+					s[i] = %s
+				}
+				return s
+			}(%s)`, goType(t), elem, expr)
+		}
+
+	case MapKind:
+		key, elem := serializer(t.Key, "k"), serializer(t.Elem, "e")
+		if key != "k" || elem != "e" {
+			return fmt.Sprintf(`func(v %s) interface{} {
+				if v == nil {
+					return nil
+				}
+				m := make(map[interface{}]interface{}, len(v))
+				for k, e := range v {
+					m[%s] = %s
+				}
+				return m
+			}(%s)`, goType(t), key, elem, expr)
+		}
+
+	case OptionalKind:
+		if elem := serializer(t.Elem, "*v"); elem != "*v" {
+			return fmt.Sprintf(`func(v %s) interface{} {
+				if v == nil {
+					return nil
+				}
+				return %s
+			}(%s)`, goType(t), elem, expr)
+		}
+	}
+
+	return expr
+}
+
+// Code generator.
+type generator struct {
+	// Output.
+	buf bytes.Buffer
+}
+
+// Print a line.
+func (g *generator) p(format string, a ...interface{}) {
+	fmt.Fprintf(&g.buf, format, a...)
+	g.buf.WriteByte('\n')
+}
+
+// Print a documentation comment, falling back to a default.
+func (g *generator) doc(doc []string, fallback string) {
+	if len(doc) == 0 {
+		doc = []string{fallback}
+	}
+
+	for _, line := range doc {
+		if line == "" {
+			g.p("//")
+		} else {
+			g.p("// %s", line)
+		}
+	}
+}
+
+// Generate Go code for an interface definition.
+//
+// The generated code declares exception definitions, types with serializers
+// and deserializers, and for every service a server interface with a
+// function registering it with a dispatcher, and a typed client.
+func Generate(def *Definition, packageName, source string) ([]byte, error) {
+	g := new(generator)
+
+	g.p("// Code generated by entangle-gen from %s. DO NOT EDIT.", source)
+	g.p("")
+	g.p("package %s", packageName)
+	g.p("")
+
+	if len(def.Services) > 0 {
+		g.p("import (")
+		g.p("\"context\"")
+		g.p("\"github.com/entangle/goentangle\"")
+		g.p(")")
+	} else {
+		g.p("import \"github.com/entangle/goentangle\"")
+	}
+
+	if len(def.Exceptions) > 0 {
+		g.p("")
+		g.p("var (")
+		for i, exception := range def.Exceptions {
+			if i > 0 {
+				g.p("")
+			}
+			g.doc(exception.Doc, exception.Name+" exception.")
+			g.p("%s = goentangle.NewExceptionDefinition(%q, %q)", exceptionName(exception.Name), def.Name, exception.Name)
+		}
+		g.p(")")
+	}
+
+	for _, enum := range def.Enums {
+		g.generateEnum(enum)
+	}
+
+	for _, s := range def.Structs {
+		g.generateStruct(s)
+	}
+
+	for _, service := range def.Services {
+		g.generateServer(service)
+		g.generateClient(service)
+	}
+
+	// Make sure the goentangle import is used.
+	if len(def.Services) == 0 && len(def.Enums) == 0 && len(def.Structs) == 0 && len(def.Exceptions) == 0 {
+		g.p("")
+		g.p("var _ goentangle.Exception")
+	}
+
+	formatted, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+
+	return formatted, nil
+}
+
+// Generate an enumeration.
+func (g *generator) generateEnum(enum *Enum) {
+	name := exportedName(enum.Name)
+
+	g.p("")
+	g.doc(enum.Doc, name+".")
+	g.p("type %s int64", name)
+
+	if len(enum.Members) > 0 {
+		g.p("")
+		g.p("const (")
+		for i, member := range enum.Members {
+			if i > 0 {
+				g.p("")
+			}
+			g.doc(member.Doc, exportedName(member.Name)+".")
+			g.p("%s%s %s = %d", name, exportedName(member.Name), name, member.Value)
+		}
+		g.p(")")
+	}
+
+	g.generateDeserialize(name)
+
+	g.p("")
+	g.p("// Deserialize a value of type %s with a coercion policy.", name)
+	g.p("//")
+	g.p("// Returns a *goentangle.DeserializationError if deserialization failed.")
+	g.p("func Deserialize%sWithPolicy(input interface{}, policy goentangle.CoercionPolicy) (%s, error) {", name, name)
+	g.p("v, err := goentangle.DeserializeWithPolicy[int64](input, policy)")
+	g.p("if err != nil {")
+	g.p("return 0, err")
+	g.p("}")
+	g.p("")
+
+	if len(enum.Members) > 0 {
+		members := make([]string, len(enum.Members))
+		for i, member := range enum.Members {
+			members[i] = name + exportedName(member.Name)
+		}
+
+		g.p("switch %s(v) {", name)
+		g.p("case %s:", strings.Join(members, ", "))
+		g.p("return %s(v), nil", name)
+		g.p("}")
+		g.p("")
+	}
+
+	g.p("return 0, goentangle.NewDeserializationError(%q, input)", name)
+	g.p("}")
+}
+
+// Generate a structure.
+func (g *generator) generateStruct(s *Struct) {
+	name := exportedName(s.Name)
+
+	g.p("")
+	g.doc(s.Doc, name+".")
+	g.p("type %s struct {", name)
+	for i, field := range s.Fields {
+		if i > 0 {
+			g.p("")
+		}
+		g.doc(field.Doc, exportedName(field.Name)+".")
+		g.p("%s %s `entangle:%q`", exportedName(field.Name), goType(field.Type), field.Name)
+	}
+	g.p("}")
+
+	g.p("")
+	g.p("// Serialize a value of type %s.", name)
+	g.p("func Serialize%s(v %s) interface{} {", name, name)
+	g.p("return []interface{}{")
+	for _, field := range s.Fields {
+		g.p("%s,", serializer(field.Type, "v."+exportedName(field.Name)))
+	}
+	g.p("}")
+	g.p("}")
+
+	g.generateDeserialize(name)
+
+	g.p("")
+	g.p("// Deserialize a value of type %s with a coercion policy.", name)
+	g.p("//")
+	g.p("// Returns a *goentangle.DeserializationError if deserialization failed.")
+	g.p("func Deserialize%sWithPolicy(input interface{}, policy goentangle.CoercionPolicy) (v %s, err error) {", name, name)
+	g.p("fields, ok := input.([]interface{})")
+	g.p("if !ok || len(fields) < %d {", len(s.Fields))
+	g.p("return v, goentangle.NewDeserializationError(%q, input)", name)
+	g.p("}")
+	for i, field := range s.Fields {
+		g.p("")
+		g.p("if v.%s, err = %s; err != nil {", exportedName(field.Name), deserializer(field.Type, fmt.Sprintf("fields[%d]", i)))
+		g.p("return")
+		g.p("}")
+	}
+	g.p("")
+	g.p("return")
+	g.p("}")
+}
+
+// Generate the deserializer of a named type with the default coercion policy.
+func (g *generator) generateDeserialize(name string) {
+	g.p("")
+	g.p("// Deserialize a value of type %s.", name)
+	g.p("//")
+	g.p("// Returns a *goentangle.DeserializationError if deserialization failed.")
+	g.p("func Deserialize%s(input interface{}) (%s, error) {", name, name)
+	g.p("return Deserialize%sWithPolicy(input, goentangle.DefaultCoercion)", name)
+	g.p("}")
+}
+
+// Go parameter list of a method.
+func methodParams(method *Method) string {
+	params := []string{"ctx context.Context"}
+	for _, param := range method.Params {
+		params = append(params, localName(param.Name)+" "+goType(param.Type))
+	}
+	return strings.Join(params, ", ")
+}
+
+// Generate a server interface and its registration.
+func (g *generator) generateServer(service *Service) {
+	name := exportedName(service.Name)
+
+	g.p("")
+	g.doc(service.Doc, name+" service.")
+	if len(service.Doc) > 0 {
+		g.p("//")
+	}
+	g.p("// Server implementing the %s service.", service.Name)
+	g.p("type %sServer interface {", name)
+	for i, method := range service.Methods {
+		if i > 0 {
+			g.p("")
+		}
+		g.doc(method.Doc, exportedName(method.Name)+".")
+
+		if method.Result != nil {
+			g.p("%s(%s) (%s, error)", exportedName(method.Name), methodParams(method), goType(method.Result))
+		} else {
+			g.p("%s(%s) error", exportedName(method.Name), methodParams(method))
+		}
+	}
+	g.p("}")
+
+	g.p("")
+	g.p("// Register the methods of a server implementing %sServer with a dispatcher.", service.Name)
+	g.p("//")
+	g.p("// The methods are described for the dispatcher's describe method. Arguments")
+	g.p("// are deserialized with the coercion policy of the call's context, and invalid")
+	g.p("// arguments are rejected with a BadMessageError exception.")
+	g.p("func Register%sServer(dispatcher *goentangle.Dispatcher, server %sServer) {", name, name)
+	for i, method := range service.Methods {
+		if i > 0 {
+			g.p("")
+		}
+
+		g.p("dispatcher.Handle(%q, func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {", method.Name)
+
+		plural := "s"
+		if len(method.Params) == 1 {
+			plural = ""
+		}
+		g.p("if len(call.Arguments) != %d {", len(method.Params))
+		g.p("return nil, goentangle.BadMessageError.New(%q)", fmt.Sprintf("%s takes %d argument%s", method.Name, len(method.Params), plural))
+		g.p("}")
+
+		if len(method.Params) > 0 {
+			g.p("")
+			g.p("policy := goentangle.CoercionPolicyFromContext(ctx)")
+		}
+
+		args := []string{"ctx"}
+		for j, param := range method.Params {
+			local := localName(param.Name)
+			args = append(args, local)
+
+			g.p("")
+			g.p("%s, err := %s", local, deserializer(param.Type, fmt.Sprintf("call.Arguments[%d]", j)))
+			g.p("if err != nil {")
+			g.p("return nil, goentangle.BadMessageError.Newf(%q, err)", "invalid argument "+param.Name+": %v")
+			g.p("}")
+		}
+
+		g.p("")
+		if method.Result != nil {
+			g.p("result, err := server.%s(%s)", exportedName(method.Name), strings.Join(args, ", "))
+			g.p("if err != nil {")
+			g.p("return nil, err")
+			g.p("}")
+			g.p("")
+			g.p("return %s, nil", serializer(method.Result, "result"))
+		} else {
+			g.p("return nil, server.%s(%s)", exportedName(method.Name), strings.Join(args, ", "))
+		}
+
+		g.p("})")
+
+		g.p("")
+		g.p("dispatcher.Describe(goentangle.MethodDescription{")
+		g.p("Name: %q,", method.Name)
+		if len(method.Doc) > 0 {
+			g.p("Doc: %q,", strings.Join(method.Doc, "\n"))
+		}
+		if len(method.Params) > 0 {
+			g.p("Arguments: []goentangle.ArgumentDescription{")
+			for _, param := range method.Params {
+				g.p("{Name: %q, Type: %q},", param.Name, param.Type.String())
+			}
+			g.p("},")
+		}
+		if method.Result != nil {
+			g.p("Result: %q,", method.Result.String())
+		}
+		if len(method.Raises) > 0 {
+			g.p("Exceptions: []goentangle.ExceptionDefinition{")
+			for _, exception := range method.Raises {
+				g.p("%s,", exceptionName(exception))
+			}
+			g.p("},")
+		}
+		g.p("})")
+	}
+	g.p("}")
+}
+
+// Generate a client.
+func (g *generator) generateClient(service *Service) {
+	name := exportedName(service.Name)
+
+	g.p("")
+	g.p("// Client of the %s service.", service.Name)
+	g.p("type %sClient struct {", name)
+	g.p("// Caller, typically a connection handler.")
+	g.p("caller goentangle.Caller")
+	g.p("}")
+
+	g.p("")
+	g.p("// New %s client.", service.Name)
+	g.p("//")
+	g.p("// The caller is typically a *goentangle.ClientConnHandler, or a mock client")
+	g.p("// in tests.")
+	g.p("func New%sClient(caller goentangle.Caller) *%sClient {", name, name)
+	g.p("return &%sClient{", name)
+	g.p("caller: caller,")
+	g.p("}")
+	g.p("}")
+
+	for _, method := range service.Methods {
+		g.p("")
+		g.doc(method.Doc, exportedName(method.Name)+".")
+		g.p("//")
+		g.p("// Exceptions raised by the server are returned as goentangle.Exception errors.")
+		if method.Result != nil {
+			g.p("// The result is deserialized with the coercion policy of the context.")
+		}
+
+		if method.Result != nil {
+			g.p("func (c *%sClient) %s(%s) (result %s, err error) {", name, exportedName(method.Name), methodParams(method), goType(method.Result))
+		} else {
+			g.p("func (c *%sClient) %s(%s) (err error) {", name, exportedName(method.Name), methodParams(method))
+		}
+
+		g.p("resp, err := c.caller.CallContext(ctx, %q, []interface{}{", method.Name)
+		for _, param := range method.Params {
+			g.p("%s,", serializer(param.Type, localName(param.Name)))
+		}
+		g.p("}, false, false)")
+		g.p("if err != nil {")
+		g.p("return")
+		g.p("}")
+		g.p("")
+		g.p("switch resp := resp.(type) {")
+		g.p("case *goentangle.ResponseMessage:")
+		if method.Result != nil {
+			g.p("var value interface{}")
+			g.p("if err = resp.DecodeResult(&value); err != nil {")
+			g.p("return")
+			g.p("}")
+			g.p("")
+			g.p("policy := goentangle.CoercionPolicyFromContext(ctx)")
+			g.p("return %s", deserializer(method.Result, "value"))
+		} else {
+			g.p("return nil")
+		}
+		g.p("")
+		g.p("case *goentangle.ExceptionMessage:")
+		g.p("err = resp.Exception()")
+		g.p("")
+		g.p("default:")
+		g.p("err = goentangle.ErrBadMessage")
+		g.p("}")
+		g.p("")
+		g.p("return")
+		g.p("}")
+	}
+}
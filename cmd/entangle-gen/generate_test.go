@@ -0,0 +1,246 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run a go command on a package of generated code.
+//
+// The package is written to a temporary GOPATH in front of the current one,
+// so that it builds against this goentangle. Skips the test if the go command
+// or goentangle cannot be found, as in module mode.
+func runGoOnGenerated(t *testing.T, packageName string, files map[string]string, args ...string) {
+	goCommand, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	if _, err = build.Import("github.com/entangle/goentangle", "", build.FindOnly); err != nil {
+		t.Skipf("goentangle not found in GOPATH: %v", err)
+	}
+
+	gopath := t.TempDir()
+	dir := filepath.Join(gopath, "src", packageName)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Unexpected error creating package directory: %v", err)
+	}
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing %s: %v", name, err)
+		}
+	}
+
+	cmd := exec.Command(goCommand, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off", "GOPATH="+gopath+string(filepath.ListSeparator)+build.Default.GOPATH)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// Test generating code from a definition.
+func TestGenerate(t *testing.T) {
+	code, err := Generate(parseTestingDefinition(t), "accounts", "accounts.entangle")
+	if err != nil {
+		t.Fatalf("Unexpected error generating code: %v", err)
+	}
+
+	for _, expected := range []string{
+		"package accounts",
+		`NotFoundError = goentangle.NewExceptionDefinition("accounts", "NotFound")`,
+		"type State int64",
+		"StateSuspended State = 2",
+		"func DeserializeState(input interface{}) (State, error)",
+		"Scores map[State]*float64 `entangle:\"scores\"`",
+		"// Serialize a value of type User.",
+		"func SerializeUser(v User) interface{}",
+		"func DeserializeUser(input interface{}) (User, error)",
+		"func DeserializeUserWithPolicy(input interface{}, policy goentangle.CoercionPolicy) (v User, err error)",
+		"policy := goentangle.CoercionPolicyFromContext(ctx)",
+		"LogIn(ctx context.Context, name string, password string) (*User, error)",
+		"SetStates(ctx context.Context, states map[int64]State, type_ string) error",
+		"// Register the methods of a server implementing AccountsServer with a dispatcher.",
+		"func RegisterAccountsServer(dispatcher *goentangle.Dispatcher, server AccountsServer)",
+		`dispatcher.Handle("log_in"`,
+		`Result: "?User"`,
+		`{Name: "password", Type: "string"}`,
+		"InvalidCredentialsError,",
+		"func NewAccountsClient(caller goentangle.Caller) *AccountsClient",
+		"func (c *AccountsClient) GetUser(ctx context.Context, id int64) (result User, err error)",
+	} {
+		if !strings.Contains(string(code), expected) {
+			t.Errorf("Expected generated code to contain %q", expected)
+		}
+	}
+}
+
+// Test that generated code type-checks.
+func TestGenerateVet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building generated code")
+	}
+
+	code, err := Generate(parseTestingDefinition(t), "accounts", "accounts.entangle")
+	if err != nil {
+		t.Fatalf("Unexpected error generating code: %v", err)
+	}
+
+	runGoOnGenerated(t, "accounts", map[string]string{
+		"accounts.go": string(code),
+	}, "vet", ".")
+}
+
+// Test the behavior of generated servers, clients and deserializers.
+func TestGeneratedCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building generated code")
+	}
+
+	def, err := Parse("counter", `
+enum Mode {
+    Up = 1
+}
+
+struct Step {
+    mode Mode
+    size int32
+}
+
+service Counter {
+    increment(value int32) int32
+}
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing definition: %v", err)
+	}
+
+	code, err := Generate(def, "counter", "counter.entangle")
+	if err != nil {
+		t.Fatalf("Unexpected error generating code: %v", err)
+	}
+
+	runGoOnGenerated(t, "counter", map[string]string{
+		"counter.go": string(code),
+		"counter_test.go": `package counter
+
+import (
+	"context"
+	"errors"
+	"github.com/entangle/goentangle"
+	"github.com/entangle/goentangle/entangletest"
+	"testing"
+)
+
+type server struct{}
+
+func (server) Increment(ctx context.Context, value int32) (int32, error) {
+	return value + 1, nil
+}
+
+func serve(settings goentangle.ServerSettings) (clientConn *goentangle.Conn) {
+	dispatcher := goentangle.NewDispatcher()
+	RegisterCounterServer(dispatcher, server{})
+
+	clientConn, serverConn := entangletest.NewPipe().Conns()
+	go goentangle.NewServerWithSettings(dispatcher, settings).ServeConn(serverConn)
+	return clientConn
+}
+
+func TestServerCoercionPolicy(t *testing.T) {
+	for policy, accepted := range map[goentangle.CoercionPolicy]bool{
+		goentangle.DefaultCoercion: false,
+		goentangle.LenientCoercion: true,
+	} {
+		clientConn := serve(goentangle.ServerSettings{
+			CoercionPolicy: policy,
+		})
+
+		resp, err := goentangle.NewClientConnHandler(clientConn).Call("increment", []interface{}{float64(2)}, false, false)
+		if err != nil {
+			t.Fatalf("Unexpected error calling: %v", err)
+		}
+
+		if _, ok := resp.(*goentangle.ResponseMessage); ok != accepted {
+			t.Errorf("Expected acceptance of a whole float with %s coercion to be %v, but got %v", policy, accepted, resp)
+		}
+
+		clientConn.Close()
+	}
+}
+
+func TestClientCoercionPolicy(t *testing.T) {
+	mock := entangletest.NewMockClient(t)
+	mock.Expect("increment", entangletest.Any()).Return(float64(3)).AnyTimes()
+	client := NewCounterClient(mock)
+
+	if _, err := client.Increment(context.Background(), 2); err == nil {
+		t.Errorf("Expected error deserializing a float result with default coercion")
+	}
+
+	ctx := goentangle.WithCoercionPolicy(context.Background(), goentangle.LenientCoercion)
+	if result, err := client.Increment(ctx, 2); err != nil || result != 3 {
+		t.Errorf("Unexpected result with lenient coercion: %v, %v", result, err)
+	}
+}
+
+func TestClientLazyDecoding(t *testing.T) {
+	clientConn := serve(goentangle.ServerSettings{})
+	defer clientConn.Close()
+	clientConn.EnableLazyDecoding()
+
+	client := NewCounterClient(goentangle.NewClientConnHandler(clientConn))
+	if result, err := client.Increment(context.Background(), 2); err != nil || result != 3 {
+		t.Errorf("Unexpected result with lazy decoding: %v, %v", result, err)
+	}
+}
+
+func TestDeserializationErrors(t *testing.T) {
+	var deserializationError *goentangle.DeserializationError
+
+	for _, err := range []error{
+		func() error { _, err := DeserializeMode(int64(2)); return err }(),
+		func() error { _, err := DeserializeMode("up"); return err }(),
+		func() error { _, err := DeserializeStep("step"); return err }(),
+		func() error { _, err := DeserializeStep([]interface{}{int64(1), "size"}); return err }(),
+	} {
+		if !errors.As(err, &deserializationError) {
+			t.Errorf("Expected a *goentangle.DeserializationError, but got %v", err)
+		}
+	}
+}
+`,
+	}, "test", ".")
+}
+
+// Test generating code from a definition without declarations.
+func TestGenerateEmpty(t *testing.T) {
+	def, err := Parse("empty", "")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing definition: %v", err)
+	}
+
+	if _, err = Generate(def, "empty", "empty.entangle"); err != nil {
+		t.Errorf("Unexpected error generating code: %v", err)
+	}
+}
+
+// Test generating a file.
+func TestRun(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "accounts.go")
+
+	if err := run("testdata/accounts.entangle", output, "accounts", "accounts"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if code, err := os.ReadFile(output); err != nil || !strings.HasPrefix(string(code), "// Code generated by entangle-gen") {
+		t.Errorf("Unexpected output: %v", err)
+	}
+
+	if err := run("testdata/missing.entangle", output, "accounts", "accounts"); err == nil {
+		t.Errorf("Expected error for missing input")
+	}
+}
@@ -0,0 +1,837 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Interface definition.
+type Definition struct {
+	// Name.
+	Name string
+
+	// Exceptions.
+	Exceptions []*Exception
+
+	// Enumerations.
+	Enums []*Enum
+
+	// Structures.
+	Structs []*Struct
+
+	// Services.
+	Services []*Service
+}
+
+// Exception.
+type Exception struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+}
+
+// Enumeration.
+type Enum struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Members.
+	Members []*EnumMember
+}
+
+// Enumeration member.
+type EnumMember struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Value.
+	Value int64
+}
+
+// Structure.
+type Struct struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Fields.
+	Fields []*Field
+}
+
+// Structure field or method parameter.
+type Field struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Type.
+	Type *Type
+}
+
+// Service.
+type Service struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Methods.
+	Methods []*Method
+}
+
+// Method.
+type Method struct {
+	// Documentation.
+	Doc []string
+
+	// Name.
+	Name string
+
+	// Line of the declaration.
+	Line int
+
+	// Parameters.
+	Params []*Field
+
+	// Result type. Nil if the method has no result.
+	Result *Type
+
+	// Names of the exceptions the method raises.
+	Raises []string
+}
+
+// Type kind.
+type Kind int
+
+const (
+	// Primitive type.
+	PrimitiveKind Kind = iota
+
+	// Enumeration.
+	EnumKind
+
+	// Structure.
+	StructKind
+
+	// List of an element type.
+	ListKind
+
+	// Map from a key type to an element type.
+	MapKind
+
+	// Optional value of an element type.
+	OptionalKind
+)
+
+// Type.
+type Type struct {
+	// Kind.
+	Kind Kind
+
+	// Name of primitive, enumeration and structure types.
+	Name string
+
+	// Key type of maps.
+	Key *Type
+
+	// Element type of lists, maps and optional values.
+	Elem *Type
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case ListKind:
+		return "[]" + t.Elem.String()
+	case MapKind:
+		return "map[" + t.Key.String() + "]" + t.Elem.String()
+	case OptionalKind:
+		return "?" + t.Elem.String()
+	}
+
+	return t.Name
+}
+
+// Primitive types.
+var primitiveTypes = map[string]bool{
+	"bool":    true,
+	"string":  true,
+	"binary":  true,
+	"int8":    true,
+	"int16":   true,
+	"int32":   true,
+	"int64":   true,
+	"uint8":   true,
+	"uint16":  true,
+	"uint32":  true,
+	"uint64":  true,
+	"float32": true,
+	"float64": true,
+}
+
+// Token.
+type token struct {
+	// Text. Empty at the end of the input.
+	text string
+
+	// Line.
+	line int
+
+	// Documentation comments preceding the token.
+	doc []string
+}
+
+// Split the source of an interface definition into tokens.
+func tokenize(source string) (tokens []token, err error) {
+	var doc []string
+	line := 1
+
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(c):
+			i++
+
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				end = len(source) - i
+			}
+			doc = append(doc, strings.TrimSpace(source[i+2:i+end]))
+			i += end
+
+		case strings.ContainsRune("{}()[],=?", c):
+			tokens = append(tokens, token{string(c), line, doc})
+			doc = nil
+			i++
+
+		case c == '_' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i++; i < len(source); i++ {
+				c = rune(source[i])
+				if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+			}
+			tokens = append(tokens, token{source[start:i], line, doc})
+			doc = nil
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+		}
+
+		// Comments only document the declaration directly following them.
+		if c == '\n' && i < len(source) && source[i] == '\n' {
+			doc = nil
+		}
+	}
+
+	return append(tokens, token{"", line, nil}), nil
+}
+
+// Parser.
+type parser struct {
+	// Tokens.
+	tokens []token
+
+	// Position of the current token.
+	pos int
+}
+
+// Current token.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// Consume the current token.
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+// Consume the current token, which must have the given text.
+func (p *parser) expect(text string) (token, error) {
+	t := p.next()
+	if t.text != text {
+		return t, p.errorf(t, "expected %q", text)
+	}
+	return t, nil
+}
+
+// Consume the current token, which must be an identifier.
+func (p *parser) identifier() (token, error) {
+	t := p.next()
+	if !isIdentifier(t.text) {
+		return t, p.errorf(t, "expected identifier")
+	}
+	return t, nil
+}
+
+// Format an error at a token.
+func (p *parser) errorf(t token, format string, a ...interface{}) error {
+	found := strconv.Quote(t.text)
+	if t.text == "" {
+		found = "end of input"
+	}
+
+	return fmt.Errorf("line %d: %s, found %s", t.line, fmt.Sprintf(format, a...), found)
+}
+
+// Test if a text is an identifier.
+func isIdentifier(text string) bool {
+	if text == "" || !(text[0] == '_' || unicode.IsLetter(rune(text[0]))) {
+		return false
+	}
+
+	return !strings.ContainsRune(text, '-')
+}
+
+// Parse an interface definition.
+//
+// The definition is parsed according to the grammar in the package
+// documentation.
+func Parse(name, source string) (*Definition, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+	}
+
+	def := &Definition{
+		Name: name,
+	}
+
+	for p.peek().text != "" {
+		t := p.next()
+
+		switch t.text {
+		case "exception":
+			var name token
+			if name, err = p.identifier(); err != nil {
+				return nil, err
+			}
+			def.Exceptions = append(def.Exceptions, &Exception{t.doc, name.text, name.line})
+
+		case "enum":
+			var enum *Enum
+			if enum, err = p.parseEnum(t.doc); err != nil {
+				return nil, err
+			}
+			def.Enums = append(def.Enums, enum)
+
+		case "struct":
+			var s *Struct
+			if s, err = p.parseStruct(t.doc); err != nil {
+				return nil, err
+			}
+			def.Structs = append(def.Structs, s)
+
+		case "service":
+			var service *Service
+			if service, err = p.parseService(t.doc); err != nil {
+				return nil, err
+			}
+			def.Services = append(def.Services, service)
+
+		default:
+			return nil, p.errorf(t, "expected declaration")
+		}
+	}
+
+	if err = def.resolve(); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+// Parse an enumeration.
+func (p *parser) parseEnum(doc []string) (enum *Enum, err error) {
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+
+	enum = &Enum{
+		Doc:  doc,
+		Name: name.text,
+		Line: name.line,
+	}
+
+	if _, err = p.expect("{"); err != nil {
+		return
+	}
+
+	for p.peek().text != "}" {
+		var member, value token
+		if member, err = p.identifier(); err != nil {
+			return
+		}
+
+		if _, err = p.expect("="); err != nil {
+			return
+		}
+
+		value = p.next()
+		n, parseErr := strconv.ParseInt(value.text, 0, 64)
+		if parseErr != nil {
+			return nil, p.errorf(value, "expected integer")
+		}
+
+		enum.Members = append(enum.Members, &EnumMember{member.doc, member.text, member.line, n})
+	}
+
+	p.next()
+	return
+}
+
+// Parse a structure.
+func (p *parser) parseStruct(doc []string) (s *Struct, err error) {
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+
+	s = &Struct{
+		Doc:  doc,
+		Name: name.text,
+		Line: name.line,
+	}
+
+	if _, err = p.expect("{"); err != nil {
+		return
+	}
+
+	for p.peek().text != "}" {
+		var field *Field
+		if field, err = p.parseField(); err != nil {
+			return
+		}
+		s.Fields = append(s.Fields, field)
+	}
+
+	p.next()
+	return
+}
+
+// Parse a field or parameter.
+func (p *parser) parseField() (*Field, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+
+	fieldType, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Field{name.doc, name.text, name.line, fieldType}, nil
+}
+
+// Parse a type.
+//
+// Enumeration and structure types are resolved once the whole definition has
+// been parsed.
+func (p *parser) parseType() (*Type, error) {
+	t := p.next()
+
+	switch t.text {
+	case "?":
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Kind: OptionalKind, Elem: elem}, nil
+
+	case "[":
+		if _, err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Kind: ListKind, Elem: elem}, nil
+
+	case "map":
+		if _, err := p.expect("["); err != nil {
+			return nil, err
+		}
+		key, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect("]"); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Kind: MapKind, Key: key, Elem: elem}, nil
+	}
+
+	if !isIdentifier(t.text) {
+		return nil, p.errorf(t, "expected type")
+	}
+
+	return &Type{Kind: PrimitiveKind, Name: t.text}, nil
+}
+
+// Parse a service.
+func (p *parser) parseService(doc []string) (service *Service, err error) {
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+
+	service = &Service{
+		Doc:  doc,
+		Name: name.text,
+		Line: name.line,
+	}
+
+	if _, err = p.expect("{"); err != nil {
+		return
+	}
+
+	for p.peek().text != "}" {
+		var method *Method
+		if method, err = p.parseMethod(); err != nil {
+			return
+		}
+		service.Methods = append(service.Methods, method)
+	}
+
+	p.next()
+	return
+}
+
+// Parse a method.
+func (p *parser) parseMethod() (method *Method, err error) {
+	name, err := p.identifier()
+	if err != nil {
+		return
+	}
+
+	method = &Method{
+		Doc:  name.doc,
+		Name: name.text,
+		Line: name.line,
+	}
+
+	if _, err = p.expect("("); err != nil {
+		return
+	}
+
+	for p.peek().text != ")" {
+		if len(method.Params) > 0 {
+			if _, err = p.expect(","); err != nil {
+				return
+			}
+		}
+
+		var param *Field
+		if param, err = p.parseField(); err != nil {
+			return
+		}
+		method.Params = append(method.Params, param)
+	}
+
+	p.next()
+
+	// An identifier followed by an opening parenthesis starts the next
+	// method rather than naming the result type.
+	if t := p.peek(); t.text != "" && t.text != "}" && t.text != "raises" && p.tokens[p.pos+1].text != "(" {
+		if method.Result, err = p.parseType(); err != nil {
+			return
+		}
+	}
+
+	if p.peek().text == "raises" {
+		p.next()
+
+		for {
+			var exception token
+			if exception, err = p.identifier(); err != nil {
+				return
+			}
+			method.Raises = append(method.Raises, exception.text)
+
+			if p.peek().text != "," {
+				break
+			}
+			p.next()
+		}
+	}
+
+	return
+}
+
+// Resolve and validate the types and names of the definition.
+//
+// Besides the names of the definition, the Go names generated from them must
+// be valid and distinct, and structures must not contain themselves by value.
+func (d *Definition) resolve() error {
+	names := make(map[string]Kind)
+	exceptions := make(map[string]bool)
+
+	declare := func(name string, line int, kind Kind) error {
+		if _, ok := names[name]; ok || exceptions[name] || primitiveTypes[name] {
+			return fmt.Errorf("line %d: %s is declared more than once", line, name)
+		}
+		names[name] = kind
+		return nil
+	}
+
+	// Go names of the package, and of the generated code for each name.
+	goNames := make(map[string]string)
+	declareGo := func(scope map[string]string, name string, line int, goNames ...string) error {
+		if exported := []rune(exportedName(name)); len(exported) == 0 || !unicode.IsUpper(exported[0]) {
+			return fmt.Errorf("line %d: name %s cannot be made into an exported Go name", line, name)
+		}
+
+		for _, goName := range goNames {
+			if other, ok := scope[goName]; ok {
+				return fmt.Errorf("line %d: Go name %s of %s is already used by %s", line, goName, name, other)
+			}
+			scope[goName] = name
+		}
+		return nil
+	}
+
+	for _, exception := range d.Exceptions {
+		if _, ok := names[exception.Name]; ok || exceptions[exception.Name] {
+			return fmt.Errorf("line %d: %s is declared more than once", exception.Line, exception.Name)
+		}
+		exceptions[exception.Name] = true
+
+		if err := declareGo(goNames, exception.Name, exception.Line, exceptionName(exception.Name)); err != nil {
+			return err
+		}
+	}
+
+	for _, enum := range d.Enums {
+		if err := declare(enum.Name, enum.Line, EnumKind); err != nil {
+			return err
+		}
+
+		name := exportedName(enum.Name)
+		if err := declareGo(goNames, enum.Name, enum.Line, name, "Deserialize"+name, "Deserialize"+name+"WithPolicy"); err != nil {
+			return err
+		}
+
+		members := make(map[string]bool)
+		values := make(map[int64]bool)
+		for _, member := range enum.Members {
+			if members[member.Name] || values[member.Value] {
+				return fmt.Errorf("line %d: member %s.%s is declared more than once", member.Line, enum.Name, member.Name)
+			}
+			members[member.Name] = true
+			values[member.Value] = true
+
+			if err := declareGo(goNames, enum.Name+"."+member.Name, member.Line, name+exportedName(member.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range d.Structs {
+		if err := declare(s.Name, s.Line, StructKind); err != nil {
+			return err
+		}
+
+		name := exportedName(s.Name)
+		if err := declareGo(goNames, s.Name, s.Line, name, "Serialize"+name, "Deserialize"+name, "Deserialize"+name+"WithPolicy"); err != nil {
+			return err
+		}
+	}
+
+	for _, service := range d.Services {
+		if err := declare(service.Name, service.Line, -1); err != nil {
+			return err
+		}
+
+		name := exportedName(service.Name)
+		if err := declareGo(goNames, service.Name, service.Line, name+"Server", "Register"+name+"Server", name+"Client", "New"+name+"Client"); err != nil {
+			return err
+		}
+	}
+
+	var resolveType func(t *Type) error
+	resolveType = func(t *Type) error {
+		switch t.Kind {
+		case PrimitiveKind:
+			if primitiveTypes[t.Name] {
+				return nil
+			}
+
+			kind, ok := names[t.Name]
+			if !ok || (kind != EnumKind && kind != StructKind) {
+				return fmt.Errorf("unknown type %s", t.Name)
+			}
+			t.Kind = kind
+			return nil
+
+		case MapKind:
+			if err := resolveType(t.Key); err != nil {
+				return err
+			}
+			if !(t.Key.Kind == EnumKind || (t.Key.Kind == PrimitiveKind && t.Key.Name != "binary")) {
+				return fmt.Errorf("invalid map key type %s", t.Key)
+			}
+		}
+
+		return resolveType(t.Elem)
+	}
+
+	structs := make(map[string]*Struct)
+	for _, s := range d.Structs {
+		structs[s.Name] = s
+
+		seen := make(map[string]bool)
+		fieldNames := make(map[string]string)
+		for _, field := range s.Fields {
+			if seen[field.Name] {
+				return fmt.Errorf("line %d: field %s.%s is declared more than once", field.Line, s.Name, field.Name)
+			}
+			seen[field.Name] = true
+
+			if err := declareGo(fieldNames, s.Name+"."+field.Name, field.Line, exportedName(field.Name)); err != nil {
+				return err
+			}
+
+			if err := resolveType(field.Type); err != nil {
+				return fmt.Errorf("line %d: field %s.%s: %v", field.Line, s.Name, field.Name, err)
+			}
+		}
+	}
+
+	// Structures containing themselves by value, directly or through other
+	// structures, would be of infinite size.
+	const (
+		visiting = iota + 1
+		visited
+	)
+	states := make(map[string]int)
+
+	var visit func(s *Struct) error
+	visit = func(s *Struct) error {
+		states[s.Name] = visiting
+		for _, field := range s.Fields {
+			if field.Type.Kind != StructKind {
+				continue
+			}
+
+			switch states[field.Type.Name] {
+			case visiting:
+				return fmt.Errorf("line %d: field %s.%s contains structure %s by value, which contains itself", field.Line, s.Name, field.Name, field.Type.Name)
+
+			case 0:
+				if err := visit(structs[field.Type.Name]); err != nil {
+					return err
+				}
+			}
+		}
+		states[s.Name] = visited
+		return nil
+	}
+
+	for _, s := range d.Structs {
+		if states[s.Name] == 0 {
+			if err := visit(s); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, service := range d.Services {
+		seen := make(map[string]bool)
+		methodNames := make(map[string]string)
+		for _, method := range service.Methods {
+			if seen[method.Name] {
+				return fmt.Errorf("line %d: method %s.%s is declared more than once", method.Line, service.Name, method.Name)
+			}
+			seen[method.Name] = true
+
+			if err := declareGo(methodNames, service.Name+"."+method.Name, method.Line, exportedName(method.Name)); err != nil {
+				return err
+			}
+
+			params := make(map[string]bool)
+			paramNames := make(map[string]string)
+			for _, param := range method.Params {
+				if params[param.Name] {
+					return fmt.Errorf("line %d: parameter %s of method %s.%s is declared more than once", param.Line, param.Name, service.Name, method.Name)
+				}
+				params[param.Name] = true
+
+				if err := declareGo(paramNames, param.Name, param.Line, localName(param.Name)); err != nil {
+					return err
+				}
+
+				if err := resolveType(param.Type); err != nil {
+					return fmt.Errorf("line %d: parameter %s of method %s.%s: %v", param.Line, param.Name, service.Name, method.Name, err)
+				}
+			}
+
+			if method.Result != nil {
+				if err := resolveType(method.Result); err != nil {
+					return fmt.Errorf("line %d: result of method %s.%s: %v", method.Line, service.Name, method.Name, err)
+				}
+			}
+
+			for _, exception := range method.Raises {
+				if !exceptions[exception] {
+					return fmt.Errorf("line %d: method %s.%s raises unknown exception %s", method.Line, service.Name, method.Name, exception)
+				}
+			}
+		}
+	}
+
+	return nil
+}
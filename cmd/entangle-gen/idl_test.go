@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func parseTestingDefinition(t *testing.T) *Definition {
+	source, err := os.ReadFile("testdata/accounts.entangle")
+	if err != nil {
+		t.Fatalf("Unexpected error reading definition: %v", err)
+	}
+
+	def, err := Parse("accounts", string(source))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing definition: %v", err)
+	}
+
+	return def
+}
+
+// Test parsing a definition.
+func TestParse(t *testing.T) {
+	def := parseTestingDefinition(t)
+
+	if len(def.Exceptions) != 2 || def.Exceptions[0].Name != "NotFound" || def.Exceptions[1].Name != "InvalidCredentials" {
+		t.Fatalf("Unexpected exceptions: %v", def.Exceptions)
+	}
+	if len(def.Exceptions[0].Doc) != 1 || def.Exceptions[0].Doc[0] != "User not found." {
+		t.Errorf("Unexpected exception documentation: %q", def.Exceptions[0].Doc)
+	}
+
+	if len(def.Enums) != 1 || len(def.Enums[0].Members) != 2 {
+		t.Fatalf("Unexpected enumerations: %v", def.Enums)
+	}
+	if member := def.Enums[0].Members[1]; member.Name != "Suspended" || member.Value != 2 {
+		t.Errorf("Unexpected enumeration member: %+v", member)
+	}
+
+	if len(def.Structs) != 1 || len(def.Structs[0].Fields) != 8 {
+		t.Fatalf("Unexpected structures: %v", def.Structs)
+	}
+
+	for i, expected := range []string{
+		"int64",
+		"string",
+		"?string",
+		"State",
+		"[]string",
+		"map[string]binary",
+		"[]User",
+		"map[State]?float64",
+	} {
+		if actual := def.Structs[0].Fields[i].Type.String(); actual != expected {
+			t.Errorf("Expected field %d to have type %s, but got %s", i, expected, actual)
+		}
+	}
+
+	if kind := def.Structs[0].Fields[3].Type.Kind; kind != EnumKind {
+		t.Errorf("Expected enumeration field type to resolve to EnumKind, but got %v", kind)
+	}
+	if kind := def.Structs[0].Fields[6].Type.Elem.Kind; kind != StructKind {
+		t.Errorf("Expected structure element type to resolve to StructKind, but got %v", kind)
+	}
+
+	if len(def.Services) != 1 || len(def.Services[0].Methods) != 4 {
+		t.Fatalf("Unexpected services: %v", def.Services)
+	}
+
+	logIn := def.Services[0].Methods[1]
+	if logIn.Name != "log_in" || len(logIn.Params) != 2 || logIn.Result.String() != "?User" {
+		t.Errorf("Unexpected method: %+v", logIn)
+	}
+	if len(logIn.Raises) != 2 || logIn.Raises[0] != "NotFound" || logIn.Raises[1] != "InvalidCredentials" {
+		t.Errorf("Unexpected raised exceptions: %v", logIn.Raises)
+	}
+
+	if ping := def.Services[0].Methods[2]; ping.Result != nil || len(ping.Params) != 0 {
+		t.Errorf("Unexpected method: %+v", ping)
+	}
+}
+
+// Test that invalid definitions are rejected.
+func TestParseErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		source string
+		err    string
+	}{
+		{"message Foo", "expected declaration"},
+		{"struct Foo { bar }", "line 1"},
+		{"struct Foo {\n bar baz\n}", "unknown type baz"},
+		{"struct Foo { bar int64\n bar string }", "declared more than once"},
+		{"enum Foo { A = 1\n B = 1 }", "declared more than once"},
+		{"exception Foo\nstruct Foo {}", "declared more than once"},
+		{"struct Foo { bar map[binary]string }", "invalid map key type"},
+		{"service Foo { bar() raises Baz }", "Baz"},
+		{"service Foo { bar(", "end of input"},
+		{"service Foo {\n f(_ int64) }", "line 2: name _ cannot be made into an exported Go name"},
+		{"struct _1 {}", "line 1: name _1"},
+		{"service Foo { get_user()\n getUser() }", "line 2: Go name GetUser of Foo.getUser is already used by Foo.get_user"},
+		{"struct Foo { a_b int64\n aB int64 }", "Go name AB"},
+		{"service Foo { bar(type string, type_ string) }", "Go name type_"},
+		{"struct Foo {}\nstruct foo {}", "line 2: Go name Foo"},
+		{"exception NotFound\nexception NotFoundError", "Go name NotFoundError"},
+		{"struct A {\n b B\n}\nstruct B {\n a A\n}", "line 5: field B.a contains structure A by value"},
+		{"struct A { a A }", "contains structure A by value"},
+	} {
+		_, err := Parse("test", testCase.source)
+		if err == nil {
+			t.Errorf("Expected error parsing %q", testCase.source)
+		} else if !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("Expected error parsing %q to contain %q, but got %v", testCase.source, testCase.err, err)
+		}
+	}
+}
+
+// Test that structures may refer to themselves through optional values, lists
+// and maps.
+func TestParseIndirectRecursion(t *testing.T) {
+	if _, err := Parse("test", "struct A { b ?B\n c []A\n d map[string]A }\nstruct B { a A }"); err != nil {
+		t.Errorf("Unexpected error parsing definition: %v", err)
+	}
+}
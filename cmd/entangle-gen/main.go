@@ -0,0 +1,115 @@
+// Command entangle-gen generates Go code from an Entangle interface
+// definition.
+//
+// Usage:
+//
+//	entangle-gen [flags] file
+//
+// The generated code declares exception definitions for the definition's
+// exceptions, Go types with serializers and deserializers for its
+// enumerations and structures, and for each service a server interface, a
+// function registering a server with a goentangle.Dispatcher, and a typed
+// client built on goentangle.Caller, such as goentangle.ClientConnHandler.
+//
+// # Interface definitions
+//
+// Interface definitions follow this grammar, in the EBNF notation of the Go
+// language specification:
+//
+//	Definition  = { Declaration } .
+//	Declaration = Exception | Enum | Struct | Service .
+//	Exception   = "exception" identifier .
+//	Enum        = "enum" identifier "{" { identifier "=" integer } "}" .
+//	Struct      = "struct" identifier "{" { Field } "}" .
+//	Service     = "service" identifier "{" { Method } "}" .
+//	Method      = identifier "(" [ Field { "," Field } ] ")" [ Type ] [ Raises ] .
+//	Raises      = "raises" identifier { "," identifier } .
+//	Field       = identifier Type .
+//	Type        = identifier | "[" "]" Type | "map" "[" Type "]" Type | "?" Type .
+//
+// Identifiers consist of letters, digits and underscores and do not start
+// with a digit. Integers are Go integer literals, optionally negated. White
+// space between tokens is ignored, and a line comment starts with // and runs
+// to the end of the line.
+//
+// Type identifiers are the primitive types bool, string, binary, int8, int16,
+// int32, int64, uint8, uint16, uint32, uint64, float32 and float64, or the
+// names of enumerations and structures of the definition. [] denotes a list,
+// map a map and ? an optional value. Map keys must be primitive types other
+// than binary, or enumerations. A method without a result type returns
+// nothing, and the exceptions it raises must be declared by the definition.
+// Structures can only contain themselves through lists, maps and optional
+// values.
+//
+// Names become Go names by joining their underscore-separated words and
+// capitalizing them, so that get_user and getUser both become GetUser. The
+// resulting Go names must start with an upper case letter and not collide.
+//
+// Comments on the lines directly preceding a declaration, enumeration
+// member, field or method document it, and are copied to the generated code.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	var (
+		output      = flag.String("o", "", "output file (default: the input file with a .go extension)")
+		packageName = flag.String("package", "", "package name (default: the definition name)")
+		name        = flag.String("definition", "", "definition name used for exceptions (default: the input file name without extension)")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	input := flag.Arg(0)
+	base := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+
+	if *name == "" {
+		*name = base
+	}
+	if *packageName == "" {
+		*packageName = strings.ToLower(strings.NewReplacer("-", "", ".", "").Replace(*name))
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(input, filepath.Ext(input)) + ".go"
+	}
+
+	if err := run(input, *output, *name, *packageName); err != nil {
+		fmt.Fprintf(os.Stderr, "entangle-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Generate Go code from an interface definition file.
+func run(input, output, name, packageName string) error {
+	source, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	def, err := Parse(name, string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %v", input, err)
+	}
+
+	code, err := Generate(def, packageName, filepath.Base(input))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, code, 0644)
+}
@@ -0,0 +1,129 @@
+package goentangle
+
+import (
+	"context"
+	"math"
+	"strconv"
+)
+
+// Coercion policy.
+//
+// Decides which conversions between value types deserialization performs.
+type CoercionPolicy uint8
+
+const (
+	// Default coercion.
+	//
+	// Integers of any width within range, floating point numbers of either
+	// width and strings as binary data are accepted.
+	DefaultCoercion CoercionPolicy = iota
+
+	// Strict coercion.
+	//
+	// Values must have the expected kind: binary data must be binary, and
+	// floating point numbers are only narrowed if no precision is lost.
+	// Integers of any width within range are still accepted, as the wire does
+	// not preserve integer widths.
+	StrictCoercion
+
+	// Lenient coercion.
+	//
+	// Like the default coercion, but whole floating point numbers are also
+	// accepted as integers, integers as floating point numbers, and numeric
+	// strings as either.
+	LenientCoercion
+)
+
+func (p CoercionPolicy) String() string {
+	switch p {
+	case DefaultCoercion:
+		return "default"
+	case StrictCoercion:
+		return "strict"
+	case LenientCoercion:
+		return "lenient"
+	}
+
+	return "CoercionPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Coercion policy context key.
+type coercionPolicyKey struct{}
+
+// Attach a coercion policy to a context.
+//
+// Servers attach their configured policy to the context of every call, which
+// interceptors can override for individual calls.
+func WithCoercionPolicy(ctx context.Context, policy CoercionPolicy) context.Context {
+	return context.WithValue(ctx, coercionPolicyKey{}, policy)
+}
+
+// Get the coercion policy from a context.
+//
+// Returns DefaultCoercion if the context has no coercion policy.
+func CoercionPolicyFromContext(ctx context.Context) CoercionPolicy {
+	policy, _ := ctx.Value(coercionPolicyKey{}).(CoercionPolicy)
+	return policy
+}
+
+// Coerce an input leniently into an integer.
+//
+// Whole floating point numbers and integer strings are converted into 64-bit
+// integers. Other inputs are returned as they are.
+func coerceLenientInteger(input interface{}) interface{} {
+	var f float64
+
+	switch v := input.(type) {
+	case float32:
+		f = float64(v)
+
+	case float64:
+		f = v
+
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		} else if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return u
+		}
+		return input
+
+	default:
+		return input
+	}
+
+	switch {
+	case f != math.Trunc(f):
+		return input
+
+	case f >= -(1<<63) && f < 1<<63:
+		return int64(f)
+
+	case f >= 0 && f < 1<<64:
+		return uint64(f)
+	}
+
+	return input
+}
+
+// Coerce an input leniently into a floating point number.
+//
+// Integers and numeric strings are converted into 64-bit floating point
+// numbers. Other inputs are returned as they are.
+func coerceLenientFloat(input interface{}) interface{} {
+	switch v := input.(type) {
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return f
+		}
+
+	default:
+		if i, err := deserializeInteger[int64](input); err == nil {
+			return float64(i)
+		} else if u, err := deserializeInteger[uint64](input); err == nil {
+			return float64(u)
+		}
+	}
+
+	return input
+}
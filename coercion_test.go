@@ -0,0 +1,153 @@
+package goentangle
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCoercionPolicies(t *testing.T) {
+	type deserializer func(input interface{}, policy CoercionPolicy) (interface{}, error)
+
+	int32Deserializer := func(input interface{}, policy CoercionPolicy) (interface{}, error) {
+		return DeserializeWithPolicy[int32](input, policy)
+	}
+	uint64Deserializer := func(input interface{}, policy CoercionPolicy) (interface{}, error) {
+		return DeserializeWithPolicy[uint64](input, policy)
+	}
+	float32Deserializer := func(input interface{}, policy CoercionPolicy) (interface{}, error) {
+		return DeserializeWithPolicy[float32](input, policy)
+	}
+	float64Deserializer := func(input interface{}, policy CoercionPolicy) (interface{}, error) {
+		return DeserializeWithPolicy[float64](input, policy)
+	}
+	binaryDeserializer := func(input interface{}, policy CoercionPolicy) (interface{}, error) {
+		b, err := DeserializeWithPolicy[[]byte](input, policy)
+		return string(b), err
+	}
+
+	for _, testCase := range []struct {
+		Deserializer deserializer
+		Input        interface{}
+		Expected     interface{}
+
+		// Whether deserialization succeeds with the strict, default and
+		// lenient policies.
+		Strict, Default, Lenient bool
+	}{
+		{int32Deserializer, int64(5), int32(5), true, true, true},
+		{int32Deserializer, uint64(5), int32(5), true, true, true},
+		{int32Deserializer, int64(math.MaxInt32 + 1), nil, false, false, false},
+		{int32Deserializer, float64(5), int32(5), false, false, true},
+		{int32Deserializer, float32(-5), int32(-5), false, false, true},
+		{int32Deserializer, float64(5.5), nil, false, false, false},
+		{int32Deserializer, float64(1 << 40), nil, false, false, false},
+		{int32Deserializer, "-12", int32(-12), false, false, true},
+		{int32Deserializer, "12.0", nil, false, false, false},
+		{uint64Deserializer, "18446744073709551615", uint64(math.MaxUint64), false, false, true},
+		{uint64Deserializer, float64(1 << 63), uint64(1 << 63), false, false, true},
+		{uint64Deserializer, float64(-1), nil, false, false, false},
+		{float32Deserializer, float32(1.5), float32(1.5), true, true, true},
+		{float32Deserializer, float64(1.5), float32(1.5), true, true, true},
+		{float32Deserializer, float64(0.1), float32(0.1), false, true, true},
+		{float32Deserializer, int64(3), float32(3), false, false, true},
+		{float64Deserializer, "2.5", float64(2.5), false, false, true},
+		{float64Deserializer, "NaN", nil, false, false, false},
+		{float64Deserializer, uint64(7), float64(7), false, false, true},
+		{binaryDeserializer, []byte("data"), "data", true, true, true},
+		{binaryDeserializer, "data", "data", false, true, true},
+	} {
+		for policy, ok := range map[CoercionPolicy]bool{
+			StrictCoercion:  testCase.Strict,
+			DefaultCoercion: testCase.Default,
+			LenientCoercion: testCase.Lenient,
+		} {
+			actual, err := testCase.Deserializer(testCase.Input, policy)
+			if !ok {
+				if !errors.Is(err, ErrDeserializationError) {
+					t.Errorf("Expected '%v' deserializing %#v with %s coercion, but got '%v'", ErrDeserializationError, testCase.Input, policy, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error deserializing %#v with %s coercion: %v", testCase.Input, policy, err)
+			} else if actual != testCase.Expected {
+				t.Errorf("Expected %#v deserializing %#v with %s coercion, but got %#v", testCase.Expected, testCase.Input, policy, actual)
+			}
+		}
+	}
+}
+
+func TestDeserializeIntoWithPolicy(t *testing.T) {
+	var target struct {
+		Count int16
+		Ratio float32
+	}
+
+	input := map[interface{}]interface{}{"Count": float64(3), "Ratio": "0.5"}
+
+	if err := DeserializeInto(input, &target); err == nil {
+		t.Errorf("Expected error deserializing %v with default coercion", input)
+	}
+
+	if err := DeserializeIntoWithPolicy(input, &target, LenientCoercion); err != nil {
+		t.Errorf("Unexpected error deserializing %v with lenient coercion: %v", input, err)
+	} else if target.Count != 3 || target.Ratio != 0.5 {
+		t.Errorf("Unexpected deserialized value: %+v", target)
+	}
+}
+
+// Test that servers and interceptors decide the coercion policy of calls.
+func TestServerCoercionPolicy(t *testing.T) {
+	increment := func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		var i int64
+		if err := DeserializeArgumentsWithPolicy(call.Arguments, CoercionPolicyFromContext(ctx), &i); err != nil {
+			return nil, BadMessageError.New(err.Error())
+		}
+		return i + 1, nil
+	}
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("increment", increment)
+	dispatcher.Handle("strictIncrement", increment)
+	dispatcher.Intercept(func(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+		if call.Method == "strictIncrement" {
+			ctx = WithCoercionPolicy(ctx, StrictCoercion)
+		}
+		return next(ctx, call)
+	})
+
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+
+	go NewServerWithSettings(dispatcher, ServerSettings{
+		CoercionPolicy: LenientCoercion,
+	}).ServeConn(serverConn)
+
+	client := NewClientConnHandler(clientConn)
+
+	for _, testCase := range []struct {
+		Method   string
+		Argument interface{}
+		Expected interface{}
+	}{
+		{"increment", float64(41), int64(42)},
+		{"increment", "41", int64(42)},
+		{"strictIncrement", int64(41), int64(42)},
+		{"strictIncrement", float64(41), nil},
+	} {
+		resp, err := client.Call(testCase.Method, []interface{}{testCase.Argument}, false, false)
+		if err != nil {
+			t.Fatalf("Unexpected error calling increment: %v", err)
+		}
+
+		if testCase.Expected == nil {
+			if exc, ok := resp.(*ExceptionMessage); !ok || !exc.Is(BadMessageError) {
+				t.Errorf("Expected bad message exception for %v, but got %v", testCase.Argument, resp)
+			}
+		} else if r, ok := resp.(*ResponseMessage); !ok {
+			t.Errorf("Expected response for %v, but got %v", testCase.Argument, resp)
+		} else if actual, err := DeserializeInt64(r.Result); err != nil || actual != testCase.Expected {
+			t.Errorf("Expected %v for %v, but got %v", testCase.Expected, testCase.Argument, r.Result)
+		}
+	}
+}
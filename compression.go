@@ -1,10 +1,22 @@
 package goentangle
 
 import (
-	"github.com/golang/snappy/snappy"
+	"errors"
+	"github.com/golang/snappy"
 	"fmt"
 )
 
+var (
+	ErrInvalidCompressionMethod = errors.New("invalid compression method")
+	ErrDecompressedTooLarge     = errors.New("decompressed data too large")
+)
+
+// Maximum length of decompressed data.
+//
+// Compressed data claiming a larger decompressed length is rejected before
+// any memory is allocated for it.
+const MaxDecompressedLen = 64 << 20
+
 // Compression method.
 type CompressionMethod uint8
 
@@ -39,32 +51,80 @@ func DeserializeCompressionMethod(input interface{}) (m CompressionMethod, ok bo
 }
 
 // Compress.
+//
+// Returns ErrInvalidCompressionMethod if the method is invalid.
 func (m CompressionMethod) Compress(input []byte) (output []byte, err error) {
+	return m.compress(nil, input)
+}
+
+// Maximum length of compressed data.
+func (m CompressionMethod) maxCompressedLen(inputLen int) int {
+	switch m {
+	case SnappyCompression:
+		return snappy.MaxEncodedLen(inputLen)
+	}
+
+	return 0
+}
+
+// Compress into a destination buffer.
+//
+// The destination buffer's capacity is used if it is large enough, otherwise
+// a new buffer is allocated.
+func (m CompressionMethod) compress(dst, input []byte) (output []byte, err error) {
 	switch m {
 	case SnappyCompression:
-		output = make([]byte, snappy.MaxEncodedLen(len(input)))
-		output, err = snappy.Encode(output, input)
+		if cap(dst) < snappy.MaxEncodedLen(len(input)) {
+			dst = make([]byte, snappy.MaxEncodedLen(len(input)))
+		}
+		output = snappy.Encode(dst[:cap(dst)], input)
 
 	default:
-		panic("invalid compression method")
+		err = ErrInvalidCompressionMethod
 	}
 
 	return
 }
 
 // Decompress.
+//
+// Returns ErrInvalidCompressionMethod if the method is invalid, and
+// ErrDecompressedTooLarge if the decompressed data would be longer than
+// MaxDecompressedLen.
 func (m CompressionMethod) Decompress(input []byte) (output []byte, err error) {
+	return m.decompress(nil, input)
+}
+
+// Decompress into a destination buffer.
+//
+// The destination buffer's capacity is used if it is large enough, otherwise
+// a new buffer is allocated.
+func (m CompressionMethod) decompress(dst, input []byte) (output []byte, err error) {
 	switch m {
 	case SnappyCompression:
 		var s int
 		if s, err = snappy.DecodedLen(input); err != nil {
 			return
 		}
-		output = make([]byte, s)
-		output, err = snappy.Decode(output, input)
+		if s > MaxDecompressedLen {
+			err = ErrDecompressedTooLarge
+			return
+		}
+
+		// Snappy expands 3 bytes into at most 64, so data claiming a longer
+		// decompressed length is corrupt and is rejected before the length
+		// is allocated.
+		if int64(s)*3 > int64(len(input))*64 {
+			err = snappy.ErrCorrupt
+			return
+		}
+		if cap(dst) < s {
+			dst = make([]byte, s)
+		}
+		output, err = snappy.Decode(dst[:cap(dst)], input)
 
 	default:
-		panic("invalid compression method")
+		err = ErrInvalidCompressionMethod
 	}
 
 	return
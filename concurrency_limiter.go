@@ -0,0 +1,194 @@
+package goentangle
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Smoothing factor applied to adaptive limit updates.
+	adaptiveLimitSmoothing = 0.1
+
+	// Number of samples after which the minimum latency is re-measured.
+	adaptiveLimitResetSamples = 1000
+)
+
+// Ticket that is already acquired.
+var acquiredLimiterTicket = &limiterTicket{
+	ready: make(chan struct{}),
+}
+
+func init() {
+	close(acquiredLimiterTicket.ready)
+}
+
+// Concurrency limiter ticket.
+type limiterTicket struct {
+	// Closed once the ticket has acquired a slot.
+	ready chan struct{}
+}
+
+// Concurrency limiter.
+//
+// Limits the number of concurrent in-flight requests, and holds a bounded
+// queue of requests waiting for a slot. A nil limiter imposes no limit.
+type concurrencyLimiter struct {
+	// Current limit.
+	limit int
+
+	// Maximum limit.
+	maxLimit int
+
+	// Maximum queue length.
+	maxQueued int
+
+	// Number of requests in flight.
+	inFlight int
+
+	// Queue of waiting tickets.
+	queue []*limiterTicket
+
+	// Adaptive limiting.
+	adaptive bool
+
+	// Adaptive limit prior to rounding.
+	adaptiveLimit float64
+
+	// Minimum observed latency.
+	minLatency time.Duration
+
+	// Samples since the minimum latency was last reset.
+	samples int
+
+	// Lock.
+	lock sync.Mutex
+}
+
+// New concurrency limiter.
+//
+// Returns nil if limit is not positive. In adaptive mode the limit starts at
+// the given limit and is lowered when observed latencies rise above the
+// lowest latency seen, and raised again when they fall.
+func newConcurrencyLimiter(limit, maxQueued int, adaptive bool) *concurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+
+	return &concurrencyLimiter{
+		limit:         limit,
+		maxLimit:      limit,
+		maxQueued:     maxQueued,
+		adaptive:      adaptive,
+		adaptiveLimit: float64(limit),
+	}
+}
+
+// Reserve a slot.
+//
+// Returns a ticket whose ready channel is closed once a slot is acquired, or
+// false if all slots are in use and the queue is full.
+func (l *concurrencyLimiter) reserve() (*limiterTicket, bool) {
+	if l == nil {
+		return acquiredLimiterTicket, true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.inFlight < l.limit {
+		l.inFlight++
+		return acquiredLimiterTicket, true
+	}
+
+	if len(l.queue) >= l.maxQueued {
+		return nil, false
+	}
+
+	ticket := &limiterTicket{
+		ready: make(chan struct{}),
+	}
+	l.queue = append(l.queue, ticket)
+	return ticket, true
+}
+
+// Cancel a reservation.
+//
+// Removes the ticket from the queue, or releases its slot if it has already
+// acquired one.
+func (l *concurrencyLimiter) cancel(ticket *limiterTicket) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	for i, queued := range l.queue {
+		if queued == ticket {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			l.lock.Unlock()
+			return
+		}
+	}
+	l.lock.Unlock()
+
+	l.release(0)
+}
+
+// Release a slot.
+//
+// The latency is the time the slot was held for, and is used to adjust the
+// limit in adaptive mode. A zero latency is not sampled.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+
+	if l.adaptive && latency > 0 {
+		l.sample(latency)
+	}
+
+	for l.inFlight < l.limit && len(l.queue) > 0 {
+		ticket := l.queue[0]
+		l.queue = l.queue[1:]
+		l.inFlight++
+		close(ticket.ready)
+	}
+}
+
+// Adjust the adaptive limit with a latency sample.
+//
+// Must be called with the lock held.
+func (l *concurrencyLimiter) sample(latency time.Duration) {
+	if l.samples++; l.samples >= adaptiveLimitResetSamples {
+		l.samples = 0
+		l.minLatency = 0
+	}
+
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+	}
+
+	// Scale the limit by the ratio of the minimum latency to the observed
+	// latency, leaving headroom for the limit to grow while latency is low.
+	gradient := math.Max(0.5, float64(l.minLatency)/float64(latency))
+	target := gradient*l.adaptiveLimit + math.Sqrt(l.adaptiveLimit)
+	l.adaptiveLimit = (1-adaptiveLimitSmoothing)*l.adaptiveLimit + adaptiveLimitSmoothing*target
+	l.adaptiveLimit = math.Max(1, math.Min(float64(l.maxLimit), l.adaptiveLimit))
+	l.limit = int(l.adaptiveLimit)
+}
+
+// Current limit.
+func (l *concurrencyLimiter) currentLimit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.limit
+}
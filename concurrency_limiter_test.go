@@ -0,0 +1,267 @@
+package goentangle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func isTicketReady(ticket *limiterTicket) bool {
+	select {
+	case <-ticket.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := newConcurrencyLimiter(1, 1, false)
+
+	first, ok := limiter.reserve()
+	if !ok || !isTicketReady(first) {
+		t.Fatalf("Expected first reservation to acquire a slot")
+	}
+
+	second, ok := limiter.reserve()
+	if !ok || isTicketReady(second) {
+		t.Fatalf("Expected second reservation to be queued")
+	}
+
+	if _, ok := limiter.reserve(); ok {
+		t.Fatalf("Expected third reservation to be rejected")
+	}
+
+	// Releasing the first slot hands it to the queued reservation.
+	limiter.release(time.Millisecond)
+	if !isTicketReady(second) {
+		t.Errorf("Expected queued reservation to acquire the released slot")
+	}
+
+	// Cancelling a queued reservation frees its queue position.
+	third, _ := limiter.reserve()
+	limiter.cancel(third)
+	if _, ok := limiter.reserve(); !ok {
+		t.Errorf("Expected reservation to be queued after cancellation")
+	}
+
+	// A nil limiter imposes no limit.
+	var unlimited *concurrencyLimiter
+	if ticket, ok := unlimited.reserve(); !ok || !isTicketReady(ticket) {
+		t.Errorf("Expected nil limiter to acquire immediately")
+	}
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	limiter := newConcurrencyLimiter(100, 0, true)
+
+	// Rising latency lowers the limit.
+	limiter.reserve()
+	limiter.release(time.Millisecond)
+	for i := 0; i < 100; i++ {
+		limiter.reserve()
+		limiter.release(10 * time.Millisecond)
+	}
+
+	lowered := limiter.currentLimit()
+	if lowered >= 100 {
+		t.Fatalf("Expected limit to be lowered, but it is %d", lowered)
+	}
+
+	// Latency returning to the minimum raises the limit again.
+	for i := 0; i < 100; i++ {
+		limiter.reserve()
+		limiter.release(time.Millisecond)
+	}
+
+	if raised := limiter.currentLimit(); raised <= lowered {
+		t.Errorf("Expected limit to be raised above %d, but it is %d", lowered, raised)
+	}
+}
+
+// Test that requests beyond the per-connection limit are rejected as
+// overloaded.
+func TestServerOverloaded(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("block", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	})
+
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+
+	go NewServerWithSettings(dispatcher, ServerSettings{
+		MaxInFlightPerConn: 1,
+	}).ServeConn(serverConn)
+
+	client := NewClientConnHandler(clientConn)
+
+	done := make(chan Message)
+	go func() {
+		resp, _ := client.Call("block", []interface{}{}, false, false)
+		done <- resp
+	}()
+	<-started
+
+	resp, err := client.Call("block", []interface{}{}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling block: %v", err)
+	}
+
+	if exc, ok := resp.(*ExceptionMessage); !ok || !exc.Is(OverloadedError) {
+		t.Errorf("Expected overloaded exception, but got %v", resp)
+	}
+
+	close(release)
+	if _, ok := (<-done).(*ResponseMessage); !ok {
+		t.Errorf("Expected first call to succeed")
+	}
+}
+
+// Test that requests queued on a busy connection do not hold server slots
+// needed by other connections.
+func TestServerConnQueueFairness(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("block", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	})
+	dispatcher.Handle("echo", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		return call.Arguments, nil
+	})
+
+	server := NewServerWithSettings(dispatcher, ServerSettings{
+		MaxInFlight:        2,
+		MaxInFlightPerConn: 1,
+		MaxQueuedPerConn:   1,
+	})
+
+	busyConn, busyServerConn := newTestingConnPipe()
+	defer busyConn.Close()
+	go server.ServeConn(busyServerConn)
+	busy := NewClientConnHandler(busyConn)
+
+	otherConn, otherServerConn := newTestingConnPipe()
+	defer otherConn.Close()
+	go server.ServeConn(otherServerConn)
+	other := NewClientConnHandler(otherConn)
+
+	// One call in flight and one queued on the busy connection, sent directly
+	// so that they are received in order. A third call is shed, as the
+	// connection's queue is full.
+	for i := 0; i < 2; i++ {
+		if _, err := busyConn.SendRequest("block", []interface{}{}, false); err != nil {
+			t.Fatalf("Error sending request: %v", err)
+		}
+	}
+	<-started
+
+	resp, err := busy.Call("echo", []interface{}{"a"}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling echo: %v", err)
+	}
+
+	if exc, ok := resp.(*ExceptionMessage); !ok || !exc.Is(OverloadedError) {
+		t.Errorf("Expected overloaded exception on the busy connection, but got %v", resp)
+	}
+
+	// The other connection still gets the remaining server slot.
+	if resp, err = other.Call("echo", []interface{}{"a"}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling echo: %v", err)
+	}
+
+	if _, ok := resp.(*ResponseMessage); !ok {
+		t.Errorf("Expected response on the other connection, but got %v", resp)
+	}
+
+	close(release)
+	<-started
+}
+
+func (l *concurrencyLimiter) queued() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.queue)
+}
+
+// Test that requests waiting for a slot are dropped once their connection is
+// no longer served.
+func TestServerQueuedCancellation(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("block", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	})
+
+	server := NewServerWithSettings(dispatcher, ServerSettings{
+		MaxInFlight: 1,
+		MaxQueued:   1,
+	}).(*server)
+
+	waitForQueued := func(n int) {
+		for deadline := time.Now().Add(time.Second); server.limiter.queued() != n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %d queued requests", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	busyConn, busyServerConn := newTestingConnPipe()
+	defer busyConn.Close()
+	go server.ServeConn(busyServerConn)
+	busy := NewClientConnHandler(busyConn)
+
+	done := make(chan Message)
+	go func() {
+		resp, _ := busy.Call("block", []interface{}{}, false, false)
+		done <- resp
+	}()
+	<-started
+
+	// A request queued on a connection that hangs up leaves the queue.
+	closedConn, closedServerConn := newTestingConnPipe()
+	go server.ServeConn(closedServerConn)
+	if _, err := closedConn.SendRequest("block", []interface{}{}, false); err != nil {
+		t.Fatalf("Error sending request: %v", err)
+	}
+	waitForQueued(1)
+
+	closedConn.Close()
+	waitForQueued(0)
+
+	// Another request can take its place in the queue.
+	otherConn, otherServerConn := newTestingConnPipe()
+	defer otherConn.Close()
+	go server.ServeConn(otherServerConn)
+	other := NewClientConnHandler(otherConn)
+
+	go func() {
+		resp, _ := other.Call("block", []interface{}{}, false, false)
+		done <- resp
+	}()
+	waitForQueued(1)
+
+	close(release)
+	<-started
+	for i := 0; i < 2; i++ {
+		if resp := <-done; resp == nil {
+			t.Errorf("Expected call to succeed")
+		} else if _, ok := resp.(*ResponseMessage); !ok {
+			t.Errorf("Expected response, but got %v", resp)
+		}
+	}
+}
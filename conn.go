@@ -4,10 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
-	"github.com/vmihailenco/msgpack"
 	"io"
-	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
@@ -19,70 +18,123 @@ var (
 	compressionThreshold = 1460 * 5
 )
 
-func encodeSlice(slice []interface{}) ([]byte, error) {
-	buffer := new(bytes.Buffer)
-	encoder := msgpack.NewEncoder(buffer)
-	err := encoder.Encode(slice)
-	return buffer.Bytes(), err
+// Maximum number of chunked messages being received at once.
+//
+// Chunks starting further messages are rejected as invalid message data.
+const maxChunkStreams = 16
+
+// Minimum chunk size.
+const minChunkSize = 1024
+
+// Maximum nesting level of compressed messages.
+//
+// Compressed messages may contain compressed messages, but more deeply nested
+// messages are rejected as bad messages to bound the work done per message.
+const maxCompressionNesting = 8
+
+// Decoder for decompressed messages.
+type decompressedDecoder struct {
+	// Reader of the decompressed data.
+	reader *bytes.Reader
+
+	// Decoder.
+	decoder *messageDecoder
+}
+
+// Encode a slice into a pooled buffer.
+//
+// Release the buffer once its contents have been written.
+func encodeSlice(slice []interface{}) (*encodeBuffer, error) {
+	buffer := getEncodeBuffer()
+	if err := buffer.encoder.Encode(slice); err != nil {
+		buffer.release()
+		return nil, err
+	}
+
+	return buffer, nil
 }
 
 // Connection.
 //
 // Reading is only safe from one goroutine while writing is safe in a blocking
-// manner form any number of goroutines.
+// manner form any number of goroutines. Concurrent writes are scheduled by
+// urgency, so exceptions and notification acknowledgements are written ahead
+// of queued regular messages, which are in turn written ahead of queued
+// compressed messages. With chunking enabled, large messages are written in
+// chunks, letting more urgent messages through between chunks.
 type Conn struct {
 	// Message ID counter.
 	messageIdCounter uint32
 
+	// Chunk stream ID counter.
+	chunkStreamIdCounter uint32
+
 	// Description.
 	description string
 
 	// Closer.
 	closer io.Closer
 
-	// Writer.
-	writer *bufio.Writer
-
-	// Reader.
-	reader *bufio.Reader
+	// Write scheduler.
+	writes *writeScheduler
 
 	// Decoder.
-	decoder *msgpack.Decoder
+	decoder *messageDecoder
+
+	// Lazy decoding.
+	lazyDecoding bool
+
+	// Decoders for decompressed messages by nesting level, created as
+	// needed.
+	decompressed []decompressedDecoder
+
+	// Nesting level of the compressed message being decoded.
+	compressionLevel int
+
+	// Size of chunks to write large messages in, or zero if messages are
+	// written whole.
+	chunkSize int
+
+	// Data of partially received chunked messages by chunk stream ID.
+	chunks map[MessageId][]byte
+
+	// Total length of the data of partially received chunked messages.
+	chunksLen int
+
+	// Decoder for reassembled chunked messages, created as needed.
+	reassembled decompressedDecoder
+
+	// A reassembled chunked message is being decoded.
+	reassembling bool
 
-	// Write lock.
-	writeLock sync.Mutex
+	// Send interceptors.
+	sendInterceptors []StreamInterceptor
+
+	// Receive interceptors.
+	receiveInterceptors []StreamInterceptor
 }
 
 // New connection.
+//
+// Extension types can no longer be registered once a connection is created, as
+// described in the package documentation.
 func NewConn(conn io.ReadWriteCloser, description string) *Conn {
 	reader := bufio.NewReader(conn)
 
+	closeExtTypeRegistration()
+
 	return &Conn{
 		description: description,
 		closer:      conn,
-		writer:      bufio.NewWriter(conn),
-		reader:      reader,
-		decoder:     msgpack.NewDecoder(reader),
+		writes:      newWriteScheduler(bufio.NewWriter(conn)),
+		decoder:     newMessageDecoder(reader),
 	}
 }
 
-// Lock for writing and get writer.
-//
-// Make absolutely sure to call UnlockWriter after writing is done, preferably
-// using a defer statement immediately after retrieving the writer.
-func (c *Conn) lockAndWriter() *bufio.Writer {
-	c.writeLock.Lock()
-	return c.writer
-}
-
-// Unlock writer.
-func (c *Conn) unlockWriter() {
-	c.writeLock.Unlock()
-}
-
 // Close connection.
 func (c *Conn) Close() {
 	c.closer.Close()
+	c.writes.close()
 }
 
 // Description.
@@ -90,94 +142,222 @@ func (c *Conn) Description() string {
 	return c.description
 }
 
-// Deserialize a message.
-func (c *Conn) deserializeMessage(opcode Opcode, messageId MessageId, messageData []interface{}) (msg Message, err error) {
-	// Parse the incoming message based on its opcode.
+// Enable write coalescing.
+//
+// By default every message is flushed to the underlying connection as soon as
+// it is written. With write coalescing enabled, messages sent concurrently are
+// written back to back and flushed together once no more messages are queued,
+// trading a little latency for fewer system calls. A positive linger makes the
+// connection wait that long for more messages before flushing. Sending still
+// blocks until the message has been flushed.
+func (c *Conn) EnableWriteCoalescing(linger time.Duration) {
+	c.writes.coalesceWrites(linger)
+}
+
+// Enable chunking.
+//
+// Messages larger than the chunk size are then written as a stream of message
+// chunks of at most that size, so that writing a large message only holds up
+// more urgent messages for the length of a chunk. Chunk sizes below 1 KiB are
+// raised to 1 KiB. The peer must support message chunks, which connections
+// always reassemble when receiving. Chunking must be enabled before the
+// connection is used.
+func (c *Conn) EnableChunking(chunkSize int) {
+	c.chunkSize = max(chunkSize, minChunkSize)
+}
+
+// Enable lazy decoding.
+//
+// Request and notification arguments and response results are then kept in
+// their raw encoding instead of being decoded into generic values, leaving
+// Arguments and Result nil. Decode them directly into Go values with
+// DecodeArguments and DecodeResult. Lazy decoding must be enabled before the
+// connection is used.
+func (c *Conn) EnableLazyDecoding() {
+	c.lazyDecoding = true
+}
+
+// Add send interceptors.
+//
+// Send interceptors see every message before it is written to the connection.
+// Interceptors must be added before the connection is used.
+func (c *Conn) InterceptSend(interceptors ...StreamInterceptor) {
+	c.sendInterceptors = append(c.sendInterceptors, interceptors...)
+}
+
+// Add receive interceptors.
+//
+// Receive interceptors see every message successfully read from the
+// connection. A receive interceptor that returns nil without invoking the next
+// handler drops the message. Interceptors must be added before the connection
+// is used.
+func (c *Conn) InterceptReceive(interceptors ...StreamInterceptor) {
+	c.receiveInterceptors = append(c.receiveInterceptors, interceptors...)
+}
+
+// Deserialize a message from its fields.
+func (c *Conn) deserializeMessage(opcode Opcode, messageId MessageId, fields *messageFields) (msg Message, err error) {
+	// Parse the incoming message based on its opcode. Fields are decoded one
+	// at a time; any left unread are skipped by the caller.
 	switch opcode {
 	case RequestOpcode:
-		if len(messageData) != 3 {
+		if fields.count() != 3 {
 			err = ErrBadMessage
 			return
 		}
 
-		method, methodOk := messageData[0].(string)
-		arguments, argumentsOk := messageData[1].([]interface{})
-		trace, traceOk := messageData[2].(bool)
+		var rawMethod, rawTrace interface{}
+		if rawMethod, err = fields.next(); err != nil {
+			return
+		}
+
+		var arguments []interface{}
+		var rawArguments []byte
+		argumentsOk := false
+		if c.lazyDecoding {
+			if rawArguments, err = fields.raw(); err != nil {
+				return
+			}
+			argumentsOk = isRawArray(rawArguments)
+		} else {
+			var raw interface{}
+			if raw, err = fields.next(); err != nil {
+				return
+			}
+			arguments, argumentsOk = raw.([]interface{})
+			argumentsOk = argumentsOk && arguments != nil
+		}
 
-		if !methodOk || method == "" || !argumentsOk || arguments == nil || !traceOk {
+		if rawTrace, err = fields.next(); err != nil {
+			return
+		}
+
+		method, methodOk := rawMethod.(string)
+		trace, traceOk := rawTrace.(bool)
+
+		if !methodOk || method == "" || !argumentsOk || !traceOk {
 			err = ErrBadMessage
 			return
 		}
 
 		msg = &RequestMessage{
-			messageId: messageId,
-			Method:    method,
-			Arguments: arguments,
-			Trace:     trace,
+			messageId:    messageId,
+			Method:       method,
+			Arguments:    arguments,
+			Trace:        trace,
+			rawArguments: rawArguments,
 		}
 
 	case NotificationOpcode:
-		if len(messageData) != 2 {
+		if fields.count() != 2 {
 			err = ErrBadMessage
 			return
 		}
 
-		method, methodOk := messageData[0].(string)
-		arguments, argumentsOk := messageData[1].([]interface{})
+		var rawMethod interface{}
+		if rawMethod, err = fields.next(); err != nil {
+			return
+		}
+
+		var arguments []interface{}
+		var rawArguments []byte
+		argumentsOk := false
+		if c.lazyDecoding {
+			if rawArguments, err = fields.raw(); err != nil {
+				return
+			}
+			argumentsOk = isRawArray(rawArguments)
+		} else {
+			var raw interface{}
+			if raw, err = fields.next(); err != nil {
+				return
+			}
+			arguments, argumentsOk = raw.([]interface{})
+			argumentsOk = argumentsOk && arguments != nil
+		}
+
+		method, methodOk := rawMethod.(string)
 
-		if !methodOk || method == "" || !argumentsOk || arguments == nil {
+		if !methodOk || method == "" || !argumentsOk {
 			err = ErrBadMessage
 			return
 		}
 
 		msg = &NotificationMessage{
-			messageId: messageId,
-			Method:    method,
-			Arguments: arguments,
+			messageId:    messageId,
+			Method:       method,
+			Arguments:    arguments,
+			rawArguments: rawArguments,
 		}
 
 	case ResponseOpcode:
-		if len(messageData) != 2 {
+		if fields.count() != 2 {
 			err = ErrBadMessage
 			return
 		}
 
-		var trace Trace
-		var traceErr error
-		result, resultOk := messageData[0].(interface{})
-		rawTrace, rawTraceOk := messageData[1].(interface{})
-		if rawTraceOk && rawTrace != nil {
-			trace, traceErr = DeserializeTrace(rawTrace)
+		var result, rawTrace interface{}
+		var rawResult []byte
+		if c.lazyDecoding {
+			if rawResult, err = fields.raw(); err != nil {
+				return
+			}
+		} else if result, err = fields.next(); err != nil {
+			return
 		}
 
-		if (!resultOk && messageData[0] != nil) || (!rawTraceOk && messageData[1] != nil) || (traceErr != nil) {
-			err = ErrBadMessage
+		if rawTrace, err = fields.next(); err != nil {
 			return
 		}
 
+		var trace Trace
+		if rawTrace != nil {
+			if trace, err = DeserializeTrace(rawTrace); err != nil {
+				err = ErrBadMessage
+				return
+			}
+		}
+
 		msg = &ResponseMessage{
 			messageId: messageId,
 			Result:    result,
 			Trace:     trace,
+			rawResult: rawResult,
 		}
 
 	case ExceptionOpcode:
-		if len(messageData) != 4 {
+		if fields.count() != 4 && fields.count() != 5 {
 			err = ErrBadMessage
 			return
 		}
 
+		// The retry-after hint is optional.
+		rawFields := make([]interface{}, fields.count())
+		for i := range rawFields {
+			if rawFields[i], err = fields.next(); err != nil {
+				return
+			}
+		}
+
+		var retryAfter int64
+		var retryAfterErr error
+		if len(rawFields) == 5 {
+			if retryAfter, retryAfterErr = DeserializeInt64(rawFields[4]); retryAfterErr == nil && retryAfter <= 0 {
+				retryAfterErr = ErrBadMessage
+			}
+		}
+
+		definition, definitionOk := rawFields[0].(string)
+		name, nameOk := rawFields[1].(string)
+		description, descriptionOk := rawFields[2].(string)
+
 		var trace Trace
 		var traceErr error
-		definition, definitionOk := messageData[0].(string)
-		name, nameOk := messageData[1].(string)
-		description, descriptionOk := messageData[2].(string)
-		rawTrace, rawTraceOk := messageData[3].(interface{})
-		if rawTraceOk {
-			trace, traceErr = DeserializeTrace(rawTrace)
+		if rawFields[3] != nil {
+			trace, traceErr = DeserializeTrace(rawFields[3])
 		}
 
-		if !definitionOk || !nameOk || !descriptionOk || (!rawTraceOk && messageData[3] != nil) || (traceErr != nil) {
+		if !definitionOk || !nameOk || !descriptionOk || traceErr != nil || retryAfterErr != nil {
 			err = ErrBadMessage
 			return
 		}
@@ -188,52 +368,179 @@ func (c *Conn) deserializeMessage(opcode Opcode, messageId MessageId, messageDat
 			Name:        name,
 			Description: description,
 			Trace:       trace,
+			RetryAfter:  time.Duration(retryAfter),
 		}
 
 	case NotificationAcknowledgementOpcode:
-		if len(messageData) != 0 {
+		if fields.count() != 0 {
 			err = ErrBadMessage
 			return
 		}
 
 		msg = &NotificationAcknowledgementMessage{
-			messageId:   messageId,
+			messageId: messageId,
 		}
 
 	case CompressedMessageOpcode:
-		if len(messageData) != 2 {
+		if fields.count() != 2 || c.compressionLevel >= maxCompressionNesting {
 			err = ErrBadMessage
 			return
 		}
 
-		method, methodOk := DeserializeCompressionMethod(messageData[0])
-		compressed, compressedErr := DeserializeBinary(messageData[1])
-		if !methodOk || compressedErr != nil {
+		var rawMethod interface{}
+		if rawMethod, err = fields.next(); err != nil {
+			return
+		}
+
+		method, methodOk := DeserializeCompressionMethod(rawMethod)
+		if !methodOk || !method.Valid() {
+			err = ErrBadMessage
+			return
+		}
+
+		// Read the compressed data and decompress it into pooled buffers,
+		// then decode the message using the connection's decompressed message
+		// decoder for the nesting level. Decoded values never refer to the
+		// buffers, so they can be reused once decoding is done.
+		compressed := getByteSlice(0)
+		defer putByteSlice(compressed)
+
+		var compressedOk bool
+		if *compressed, compressedOk, err = fields.binary(*compressed); err != nil {
+			return
+		} else if !compressedOk {
 			err = ErrBadMessage
 			return
 		}
 
-		decompressed, decompressionErr := method.Decompress(compressed)
-		if decompressionErr != nil {
+		decompressed := getByteSlice(0)
+		defer putByteSlice(decompressed)
+
+		var decompressionErr error
+		if *decompressed, decompressionErr = method.decompress(*decompressed, *compressed); decompressionErr != nil {
 			err = ErrBadMessage
 			return
 		}
 
-		reader := bytes.NewReader(decompressed)
-		msg, err = c.readMessage(msgpack.NewDecoder(reader))
+		if len(c.decompressed) <= c.compressionLevel {
+			reader := bytes.NewReader(nil)
+			c.decompressed = append(c.decompressed, decompressedDecoder{
+				reader:  reader,
+				decoder: newMessageDecoder(reader),
+			})
+		}
+
+		level := c.decompressed[c.compressionLevel]
+		level.reader.Reset(*decompressed)
+
+		c.compressionLevel++
+		msg, err = c.readMessage(level.decoder)
+		c.compressionLevel--
+
+	case MessageChunkOpcode:
+		msg, err = c.receiveChunk(messageId, fields)
 
 	default:
-		panic("implementation error in message parsing")
+		err = ErrInvalidMessageOpcode
+	}
+
+	return
+}
+
+// Receive a message chunk.
+//
+// Returns the reassembled message when the final chunk of a message is
+// received, or nil.
+func (c *Conn) receiveChunk(streamId MessageId, fields *messageFields) (msg Message, err error) {
+	// Chunks cannot be nested in compressed or chunked messages.
+	if fields.count() != 2 || c.compressionLevel > 0 || c.reassembling {
+		err = ErrBadMessage
+		return
+	}
+
+	data, open := c.chunks[streamId]
+
+	// Drop the partially received message if the chunk is rejected, as the
+	// message can no longer be reassembled.
+	defer func() {
+		if err != nil && open {
+			delete(c.chunks, streamId)
+			c.chunksLen -= len(data)
+		}
+	}()
+
+	var rawFinal interface{}
+	if rawFinal, err = fields.next(); err != nil {
+		return
+	}
+
+	final, finalOk := rawFinal.(bool)
+
+	chunk := getByteSlice(0)
+	defer putByteSlice(chunk)
+
+	var chunkOk bool
+	if *chunk, chunkOk, err = fields.binary(*chunk); err != nil {
+		return
+	} else if !finalOk || !chunkOk {
+		err = ErrBadMessage
+		return
+	}
+
+	// Bound the number of partially received messages and their total
+	// length.
+	if !open && len(c.chunks) >= maxChunkStreams || c.chunksLen+len(*chunk) > MaxDecompressedLen {
+		err = ErrInvalidMessageData
+		return
+	}
+
+	if !final {
+		if c.chunks == nil {
+			c.chunks = make(map[MessageId][]byte)
+		}
+
+		c.chunks[streamId] = append(data, *chunk...)
+		c.chunksLen += len(*chunk)
+		return
+	}
+
+	if open {
+		delete(c.chunks, streamId)
+		c.chunksLen -= len(data)
+		open = false
+	}
+
+	// Decode the reassembled message using the connection's reassembled
+	// message decoder.
+	if c.reassembled.decoder == nil {
+		reader := bytes.NewReader(nil)
+		c.reassembled = decompressedDecoder{
+			reader:  reader,
+			decoder: newMessageDecoder(reader),
+		}
+	}
+
+	c.reassembled.reader.Reset(append(data, *chunk...))
+
+	c.reassembling = true
+	msg, err = c.readMessage(c.reassembled.decoder)
+	c.reassembling = false
+
+	if err == io.EOF {
+		err = ErrBadMessage
 	}
 
 	return
 }
 
 // Read a message from a decoder.
-func (c *Conn) readMessage(decoder *msgpack.Decoder) (msg Message, err error) {
-	// Read the message.
-	var messageData []interface{}
-	if messageData, err = decoder.DecodeSlice(); err != nil {
+//
+// Returns a nil message without an error if a chunk of a message that is not
+// complete yet was read.
+func (c *Conn) readMessage(decoder *messageDecoder) (msg Message, err error) {
+	// Read the message header.
+	var n int
+	if n, err = decoder.decoder.DecodeSliceLen(); err != nil {
 		if err != io.EOF {
 			err = ErrInvalidMessageData
 		}
@@ -241,27 +548,53 @@ func (c *Conn) readMessage(decoder *msgpack.Decoder) (msg Message, err error) {
 		return
 	}
 
+	fields := &messageFields{
+		decoder:   decoder,
+		remaining: n,
+	}
+
+	// Skip any fields left unread, so that the stream stays in sync after a
+	// rejected message, unless the stream is already broken.
+	defer func() {
+		if err == ErrInvalidMessageData {
+			return
+		}
+
+		if skipErr := fields.skip(); skipErr != nil {
+			msg, err = nil, ErrInvalidMessageData
+		}
+	}()
+
 	// Make sure that we can parse an opcode and message ID from the message
 	// data.
-	if len(messageData) < 2 {
+	if n < 2 {
 		err = ErrInvalidMessageData
 		return
 	}
 
-	opcode, ok := ParseOpcode(messageData[0])
+	var rawOpcode, rawMessageId interface{}
+	if rawOpcode, err = fields.next(); err != nil {
+		return
+	}
+
+	opcode, ok := ParseOpcode(rawOpcode)
 	if !ok || !opcode.Valid() {
 		err = ErrInvalidMessageOpcode
 		return
 	}
 
-	messageId, ok := ParseMessageId(messageData[1])
+	if rawMessageId, err = fields.next(); err != nil {
+		return
+	}
+
+	messageId, ok := ParseMessageId(rawMessageId)
 	if !ok {
 		err = ErrInvalidMessageId
 		return
 	}
 
 	// Deserialize the message.
-	return c.deserializeMessage(opcode, messageId, messageData[2:])
+	return c.deserializeMessage(opcode, messageId, fields)
 }
 
 // Receive a message.
@@ -271,43 +604,94 @@ func (c *Conn) readMessage(decoder *msgpack.Decoder) (msg Message, err error) {
 // unrecoverable, or ErrBadMessage which doesn't prohibit the connection from
 // continuing.
 func (c *Conn) Receive() (msg Message, err error) {
-	return c.readMessage(c.decoder)
+	for {
+		if msg, err = c.readMessage(c.decoder); err != nil {
+			return
+		} else if msg == nil {
+			// Read a chunk of a message that is not complete yet.
+			continue
+		} else if len(c.receiveInterceptors) == 0 {
+			return
+		}
+
+		// Run the message through the receive interceptors, and read the next
+		// message if it was dropped.
+		var received Message
+		err = chainStreamHandler(c.receiveInterceptors, func(conn *Conn, msg Message) error {
+			received = msg
+			return nil
+		})(c, msg)
+
+		if err != nil || received != nil {
+			return received, err
+		}
+	}
 }
 
 // Write message data to the connection.
-func (c *Conn) writeMessageData(data []byte) (err error) {
-	writer := c.lockAndWriter()
-	defer c.unlockWriter()
+//
+// The data is written in chunks if chunking is enabled and the data is larger
+// than the chunk size.
+func (c *Conn) writeMessageData(data []byte, priority writePriority) (err error) {
+	if c.chunkSize == 0 || len(data) <= c.chunkSize {
+		return c.writes.write(data, priority)
+	}
 
-	var n int
+	streamId := MessageId(atomic.AddUint32(&c.chunkStreamIdCounter, 1))
 
-	for {
-		if n, err = writer.Write(data); err != nil {
-			break
+	var buffers []*encodeBuffer
+	defer func() {
+		for _, buffer := range buffers {
+			buffer.release()
 		}
-
-		if n == len(data) {
-			break
+	}()
+
+	var chunks [][]byte
+	for len(data) > 0 {
+		chunk := data[:min(len(data), c.chunkSize)]
+		data = data[len(chunk):]
+
+		var buffer *encodeBuffer
+		if buffer, err = encodeSlice([]interface{}{
+			MessageChunkOpcode,
+			streamId,
+			len(data) == 0,
+			chunk,
+		}); err != nil {
+			return
 		}
 
-		data = data[n:]
+		buffers = append(buffers, buffer)
+		chunks = append(chunks, buffer.Bytes())
 	}
 
-	if err == nil {
-		writer.Flush()
+	return c.writes.writeParts(chunks, priority)
+}
+
+// Send a message.
+//
+// The message is passed through the send interceptors before being written.
+func (c *Conn) send(msg Message) error {
+	if len(c.sendInterceptors) == 0 {
+		return c.sendMessage(msg)
 	}
 
-	return
+	return chainStreamHandler(c.sendInterceptors, func(conn *Conn, msg Message) error {
+		return conn.sendMessage(msg)
+	})(c, msg)
 }
 
-// Send a message.
-func (c *Conn) send(msg Message) (err error) {
+// Serialize and write a message.
+func (c *Conn) sendMessage(msg Message) (err error) {
 	// Serialize the message.
 	serialized := msg.Serialize()
-	var data []byte
-	if data, err = encodeSlice(serialized); err != nil {
+	var buffer *encodeBuffer
+	if buffer, err = encodeSlice(serialized); err != nil {
 		return
 	}
+	defer buffer.release()
+
+	data := buffer.Bytes()
 
 	// If the data size is over the compression threshold, let's compress it.
 	if len(data) >= compressionThreshold {
@@ -315,7 +699,7 @@ func (c *Conn) send(msg Message) (err error) {
 	}
 
 	// Write the message.
-	return c.writeMessageData(data)
+	return c.writeMessageData(data, messageWritePriority(msg))
 }
 
 // Send compressed message.
@@ -326,30 +710,44 @@ func (c *Conn) sendCompressed(msg Message, data []byte, compressionMethod Compre
 	// Serialize the message if it has not already been serialized.
 	if data == nil {
 		serialized := msg.Serialize()
-		if data, err = encodeSlice(serialized); err != nil {
+		var buffer *encodeBuffer
+		if buffer, err = encodeSlice(serialized); err != nil {
 			return
 		}
+		defer buffer.release()
+
+		data = buffer.Bytes()
 	}
 
-	// Compress the data.
-	var compressedData []byte
-	if compressedData, err = compressionMethod.Compress(data); err != nil {
+	// Compress the data into a pooled buffer.
+	compressedData := getByteSlice(compressionMethod.maxCompressedLen(len(data)))
+	defer putByteSlice(compressedData)
+
+	if *compressedData, err = compressionMethod.compress(*compressedData, data); err != nil {
 		return
 	}
 
 	// Serialize the compressed message.
-	var msgData []byte
-	if msgData, err = encodeSlice([]interface{}{
+	var msgBuffer *encodeBuffer
+	if msgBuffer, err = encodeSlice([]interface{}{
 		CompressedMessageOpcode,
 		msg.MessageId(),
 		compressionMethod,
-		compressedData,
+		*compressedData,
 	}); err != nil {
 		return
 	}
+	defer msgBuffer.release()
 
-	// Write the message.
-	return c.writeMessageData(msgData)
+	msgData := msgBuffer.Bytes()
+
+	// Write the message, behind regular messages unless it is urgent.
+	priority := messageWritePriority(msg)
+	if priority == normalWritePriority {
+		priority = bulkWritePriority
+	}
+
+	return c.writeMessageData(msgData, priority)
 }
 
 // Get the next message ID.
@@ -388,6 +786,11 @@ func (c *Conn) RaiseException(exception error, responseTo Message, trace Trace)
 		eErr = InternalServerError.New(exception.Error())
 	}
 
+	var retryAfter time.Duration
+	if retryAfterErr, ok := eErr.(RetryAfterException); ok {
+		retryAfter = retryAfterErr.RetryAfter()
+	}
+
 	// Create and send the response.
 	return c.send(&ExceptionMessage{
 		messageId:   responseTo.MessageId(),
@@ -395,6 +798,7 @@ func (c *Conn) RaiseException(exception error, responseTo Message, trace Trace)
 		Name:        eErr.Name(),
 		Description: eErr.Error(),
 		Trace:       trace,
+		RetryAfter:  retryAfter,
 	})
 }
 
@@ -1,7 +1,12 @@
 package goentangle
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -442,3 +447,432 @@ func TestConnAcknowledgeNotificationReceive(t *testing.T) {
 		return
 	}
 }
+
+// Test that the connection continues after a bad message.
+func TestConnReceiveAfterBadMessage(t *testing.T) {
+	clientPipe, serverPipe := newTestingPipe()
+	defer clientPipe.Close()
+	serverConn := NewConn(serverPipe, "test")
+
+	// A request with a missing field, followed by a notification
+	// acknowledgement.
+	if _, err := clientPipe.Write([]byte{0x94, 0x00, 0x01, 0xa1, 0x6d, 0x90, 0x92, 0x04, 0x02}); err != nil {
+		t.Fatalf("writing to client pipe failed unexpectedly: %v", err)
+	}
+
+	if _, err := serverConn.Receive(); err != ErrBadMessage {
+		t.Fatalf("Expected '%v' from Receive, but got '%v'", ErrBadMessage, err)
+	}
+
+	msg, err := serverConn.Receive()
+	if err != nil {
+		t.Fatalf("Error receiving message: %v", err)
+	}
+
+	if _, ok := msg.(*NotificationAcknowledgementMessage); !ok || msg.MessageId() != 2 {
+		t.Errorf("Expected notification acknowledgement 2, but got %v", msg)
+	}
+}
+
+// Test that nested compressed messages are accepted up to the nesting limit.
+func TestConnReceiveNestedCompressed(t *testing.T) {
+	clientPipe, serverPipe := newTestingPipe()
+	defer clientPipe.Close()
+	serverConn := NewConn(serverPipe, "test")
+
+	compress := func(data []byte, times int) []byte {
+		for i := 0; i < times; i++ {
+			compressed, err := SnappyCompression.Compress(data)
+			if err != nil {
+				t.Fatalf("Error compressing: %v", err)
+			}
+
+			buffer, err := encodeSlice([]interface{}{CompressedMessageOpcode, MessageId(1), SnappyCompression, compressed})
+			if err != nil {
+				t.Fatalf("Error encoding: %v", err)
+			}
+
+			data = append([]byte(nil), buffer.Bytes()...)
+			buffer.release()
+		}
+
+		return data
+	}
+
+	// A notification acknowledgement, compressed twice and compressed once
+	// more than the limit, followed by another notification acknowledgement.
+	for _, data := range [][]byte{
+		compress([]byte{0x92, 0x04, 0x01}, 2),
+		compress([]byte{0x92, 0x04, 0x02}, maxCompressionNesting+1),
+		{0x92, 0x04, 0x03},
+	} {
+		if _, err := clientPipe.Write(data); err != nil {
+			t.Fatalf("writing to client pipe failed unexpectedly: %v", err)
+		}
+	}
+
+	if msg, err := serverConn.Receive(); err != nil {
+		t.Errorf("Error receiving message: %v", err)
+	} else if _, ok := msg.(*NotificationAcknowledgementMessage); !ok || msg.MessageId() != 1 {
+		t.Errorf("Expected notification acknowledgement 1, but got %v", msg)
+	}
+
+	if _, err := serverConn.Receive(); err != ErrBadMessage {
+		t.Errorf("Expected '%v' from Receive, but got '%v'", ErrBadMessage, err)
+	}
+
+	if msg, err := serverConn.Receive(); err != nil {
+		t.Errorf("Error receiving message: %v", err)
+	} else if msg.MessageId() != 3 {
+		t.Errorf("Expected notification acknowledgement 3, but got %v", msg)
+	}
+}
+
+// Test that large messages are written in chunks and reassembled.
+func TestConnChunking(t *testing.T) {
+	buffer := &bufferConn{}
+	conn := NewConn(buffer, "test")
+	conn.EnableChunking(minChunkSize)
+
+	argument := strings.Repeat("0123456789abcdef", 256)
+	if _, err := conn.SendNotification("small", []interface{}{}); err != nil {
+		t.Fatalf("Error sending notification: %v", err)
+	}
+	if _, err := conn.SendNotification("large", []interface{}{argument}); err != nil {
+		t.Fatalf("Error sending notification: %v", err)
+	}
+
+	var chunks int
+	d := NewDissector(bytes.NewReader(buffer.Bytes()))
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Unexpected error dissecting: %v", err)
+		}
+
+		if m.Opcode == MessageChunkOpcode {
+			chunks++
+			if len(m.Raw) > minChunkSize+16 {
+				t.Errorf("Expected chunks of at most %d bytes of data, but got %d bytes", minChunkSize, len(m.Raw))
+			}
+		}
+	}
+	if chunks != 5 {
+		t.Errorf("Expected 5 chunks, but got %d", chunks)
+	}
+
+	for _, expected := range []string{"small", "large"} {
+		msg, err := conn.Receive()
+		if err != nil {
+			t.Fatalf("Error receiving message: %v", err)
+		}
+
+		notification, ok := msg.(*NotificationMessage)
+		if !ok || notification.Method != expected {
+			t.Fatalf("Expected notification %s, but got %v", expected, msg)
+		}
+		if expected == "large" && !reflect.DeepEqual(notification.Arguments, []interface{}{argument}) {
+			t.Errorf("Reassembled arguments do not match")
+		}
+	}
+}
+
+// Test that invalid message chunks are rejected.
+func TestConnReceiveBadChunks(t *testing.T) {
+	notification := encodeTestingMessage(t, NotificationAcknowledgementOpcode, MessageId(1))
+
+	// Chunks with a bad final flag, missing data or nested in a compressed
+	// message are bad messages.
+	for _, data := range [][]byte{
+		encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), "final", notification),
+		encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), true),
+		compressTestingMessage(t, 1, encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), true, notification)),
+	} {
+		testConnReceiveFails(t, data, ErrBadMessage)
+	}
+
+	// Opening more chunk streams than allowed is invalid message data.
+	var data []byte
+	for i := 0; i <= maxChunkStreams; i++ {
+		data = append(data, encodeTestingMessage(t, MessageChunkOpcode, MessageId(i), false, notification[:1])...)
+	}
+	testConnReceiveFails(t, data, ErrInvalidMessageData)
+
+	// A rejected chunk drops its partially received message.
+	clientPipe, serverPipe := newTestingPipe()
+	defer clientPipe.Close()
+	serverConn := NewConn(serverPipe, "test")
+
+	data = encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), false, notification[:1])
+	data = append(data, encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), "final", notification[1:])...)
+	data = append(data, encodeTestingMessage(t, MessageChunkOpcode, MessageId(1), true, notification)...)
+	if _, err := clientPipe.Write(data); err != nil {
+		t.Fatalf("writing to client pipe failed unexpectedly: %v", err)
+	}
+
+	if _, err := serverConn.Receive(); err != ErrBadMessage {
+		t.Errorf("Expected '%v' from Receive, but got '%v'", ErrBadMessage, err)
+	}
+
+	if msg, err := serverConn.Receive(); err != nil {
+		t.Errorf("Error receiving message: %v", err)
+	} else if _, ok := msg.(*NotificationAcknowledgementMessage); !ok || msg.MessageId() != 1 {
+		t.Errorf("Expected notification acknowledgement 1, but got %v", msg)
+	}
+}
+
+// Test lazy decoding of arguments and results.
+func TestConnLazyDecoding(t *testing.T) {
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	clientConn.EnableLazyDecoding()
+	serverConn.EnableLazyDecoding()
+
+	if _, err := clientConn.SendRequest("MethodName", []interface{}{"Foo", int64(123)}, false); err != nil {
+		t.Fatalf("Error sending request: %v", err)
+	}
+
+	msg, err := serverConn.Receive()
+	if err != nil {
+		t.Fatalf("Error receiving message: %v", err)
+	}
+
+	req := msg.(*RequestMessage)
+	if req.Arguments != nil {
+		t.Errorf("Expected lazily decoded request to have nil arguments")
+	}
+
+	var name string
+	var number int32
+	if err := req.DecodeArguments(&name, &number); err != nil {
+		t.Fatalf("Error decoding arguments: %v", err)
+	} else if name != "Foo" || number != 123 {
+		t.Errorf("Unexpected decoded arguments: %v, %v", name, number)
+	}
+
+	if err := req.DecodeArguments(&name); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' decoding too few arguments, but got '%v'", ErrDeserializationError, err)
+	}
+
+	if err := serverConn.Respond([]string{"a", "b"}, req, nil); err != nil {
+		t.Fatalf("Error responding: %v", err)
+	}
+
+	if msg, err = clientConn.Receive(); err != nil {
+		t.Fatalf("Error receiving message: %v", err)
+	}
+
+	var result []string
+	if err := msg.(*ResponseMessage).DecodeResult(&result); err != nil {
+		t.Fatalf("Error decoding result: %v", err)
+	} else if len(result) != 2 || result[0] != "a" || result[1] != "b" {
+		t.Errorf("Unexpected decoded result: %v", result)
+	}
+
+	// Eagerly decoded messages decode into Go values too.
+	eager := &ResponseMessage{
+		Result: []interface{}{"a", "b"},
+	}
+	result = nil
+	if err := eager.DecodeResult(&result); err != nil || len(result) != 2 {
+		t.Errorf("Unexpected eager decoding result: %v, %v", result, err)
+	}
+}
+
+// Test that lazily decoded messages are forwarded with their raw arguments
+// and results.
+func TestConnLazyForwarding(t *testing.T) {
+	clientConn, proxyConn := newTestingConnPipe()
+	defer clientConn.Close()
+	defer proxyConn.Close()
+
+	proxyConn.EnableLazyDecoding()
+
+	arguments := []interface{}{"Foo", int64(123)}
+	for _, msg := range []Message{
+		&RequestMessage{messageId: 1, Method: "method", Arguments: arguments},
+		&NotificationMessage{messageId: 2, Method: "method", Arguments: arguments},
+		&ResponseMessage{messageId: 3, Result: arguments},
+	} {
+		if err := clientConn.send(msg); err != nil {
+			t.Fatalf("Error sending message: %v", err)
+		}
+
+		received, err := proxyConn.Receive()
+		if err != nil {
+			t.Fatalf("Error receiving message: %v", err)
+		}
+
+		// Forward the lazily decoded message back.
+		if err = proxyConn.send(received); err != nil {
+			t.Fatalf("Error forwarding message: %v", err)
+		}
+
+		forwarded, err := clientConn.Receive()
+		if err != nil {
+			t.Fatalf("Error receiving forwarded message: %v", err)
+		}
+
+		if !reflect.DeepEqual(forwarded.Serialize(), msg.Serialize()) {
+			t.Errorf("Expected forwarded message %v, but got %v", msg.Serialize(), forwarded.Serialize())
+		}
+	}
+}
+
+type discardConn struct{}
+
+func (discardConn) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (discardConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (discardConn) Close() error {
+	return nil
+}
+
+type bufferConn struct {
+	bytes.Buffer
+}
+
+func (*bufferConn) Close() error {
+	return nil
+}
+
+// Reader endlessly repeating the same data.
+type repeatingConn struct {
+	data   []byte
+	offset int
+}
+
+func (c *repeatingConn) Read(p []byte) (n int, err error) {
+	n = copy(p, c.data[c.offset:])
+	c.offset = (c.offset + n) % len(c.data)
+	return
+}
+
+func (c *repeatingConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (c *repeatingConn) Close() error {
+	return nil
+}
+
+// Benchmark arguments.
+var benchmarkArguments = map[string][]interface{}{
+	"Small":      {"Foo", int64(123)},
+	"Medium":     {strings.Repeat("medium argument ", 64), int64(123), []interface{}{true, 1.5, "nested"}},
+	"Compressed": {strings.Repeat("compressible argument ", compressionThreshold/16)},
+	"Nested":     {benchmarkNested(64), benchmarkWide(256)},
+}
+
+// Arrays nested levels deep.
+func benchmarkNested(levels int) interface{} {
+	var value interface{} = "leaf"
+	for i := 0; i < levels; i++ {
+		value = []interface{}{int64(i), value}
+	}
+	return value
+}
+
+// Map of n small arrays.
+func benchmarkWide(n int) interface{} {
+	value := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		value[strconv.Itoa(i)] = []interface{}{int64(i), 1.5, true}
+	}
+	return value
+}
+
+func benchmarkConnSend(b *testing.B, arguments []interface{}) {
+	conn := NewConn(discardConn{}, "benchmark")
+	defer conn.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.SendRequest("MethodName", arguments, false); err != nil {
+			b.Fatalf("Error sending request: %v", err)
+		}
+	}
+}
+
+func benchmarkConnReceive(b *testing.B, arguments []interface{}, lazy bool) {
+	// Serialize the message.
+	sent := new(bufferConn)
+	sender := NewConn(sent, "benchmark")
+	defer sender.Close()
+
+	if _, err := sender.SendRequest("MethodName", arguments, false); err != nil {
+		b.Fatalf("Error sending request: %v", err)
+	}
+
+	conn := NewConn(&repeatingConn{data: sent.Bytes()}, "benchmark")
+	defer conn.Close()
+
+	if lazy {
+		conn.EnableLazyDecoding()
+	}
+
+	b.SetBytes(int64(sent.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.Receive(); err != nil {
+			b.Fatalf("Error receiving request: %v", err)
+		}
+	}
+}
+
+func BenchmarkConnSendSmall(b *testing.B) {
+	benchmarkConnSend(b, benchmarkArguments["Small"])
+}
+
+func BenchmarkConnSendMedium(b *testing.B) {
+	benchmarkConnSend(b, benchmarkArguments["Medium"])
+}
+
+func BenchmarkConnSendCompressed(b *testing.B) {
+	benchmarkConnSend(b, benchmarkArguments["Compressed"])
+}
+
+func BenchmarkConnReceiveSmall(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Small"], false)
+}
+
+func BenchmarkConnReceiveSmallLazy(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Small"], true)
+}
+
+func BenchmarkConnReceiveMedium(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Medium"], false)
+}
+
+func BenchmarkConnReceiveMediumLazy(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Medium"], true)
+}
+
+func BenchmarkConnReceiveCompressed(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Compressed"], false)
+}
+
+func BenchmarkConnReceiveCompressedLazy(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Compressed"], true)
+}
+
+func BenchmarkConnReceiveNested(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Nested"], false)
+}
+
+func BenchmarkConnReceiveNestedLazy(b *testing.B) {
+	benchmarkConnReceive(b, benchmarkArguments["Nested"], true)
+}
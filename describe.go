@@ -0,0 +1,164 @@
+package goentangle
+
+import (
+	"context"
+)
+
+// Describe method.
+//
+// Built-in method of every dispatcher returning the descriptions of its
+// methods.
+const DescribeMethod = "entangle.describe"
+
+// Method description.
+//
+// Describes a method for tools and dynamic clients discovering a service at
+// runtime. Types are given in interface definition syntax, for example
+// "int64", "[]string" or "map[string]?User".
+type MethodDescription struct {
+	// Method name.
+	Name string
+
+	// Documentation.
+	Doc string
+
+	// Arguments.
+	Arguments []ArgumentDescription
+
+	// Result type. Empty if the method has no result.
+	Result string
+
+	// Exceptions the method can raise.
+	Exceptions []ExceptionDefinition
+}
+
+// Argument description.
+type ArgumentDescription struct {
+	// Argument name.
+	Name string
+
+	// Type.
+	Type string
+}
+
+// Serialize a method description.
+func (d MethodDescription) Serialize() interface{} {
+	args := make([]interface{}, len(d.Arguments))
+	for i, arg := range d.Arguments {
+		args[i] = []interface{}{
+			arg.Name,
+			arg.Type,
+		}
+	}
+
+	exceptions := make([]interface{}, len(d.Exceptions))
+	for i, definition := range d.Exceptions {
+		definitionName, name := ExceptionDefinitionNames(definition)
+		exceptions[i] = []interface{}{
+			definitionName,
+			name,
+		}
+	}
+
+	var result interface{}
+	if d.Result != "" {
+		result = d.Result
+	}
+
+	return []interface{}{
+		d.Name,
+		d.Doc,
+		args,
+		result,
+		exceptions,
+	}
+}
+
+// Deserialize a method description.
+//
+// Returns ErrDeserializationError if deserialization failed.
+func DeserializeMethodDescription(input interface{}) (d MethodDescription, err error) {
+	fields, ok := input.([]interface{})
+	if !ok || len(fields) < 5 {
+		return d, ErrDeserializationError
+	}
+
+	if d.Name, err = DeserializeString(fields[0]); err != nil {
+		return
+	}
+
+	if d.Doc, err = DeserializeString(fields[1]); err != nil {
+		return
+	}
+
+	if d.Arguments, err = DeserializeList(fields[2], func(input interface{}) (arg ArgumentDescription, err error) {
+		pair, ok := input.([]interface{})
+		if !ok || len(pair) < 2 {
+			return arg, ErrDeserializationError
+		}
+
+		if arg.Name, err = DeserializeString(pair[0]); err != nil {
+			return
+		}
+
+		arg.Type, err = DeserializeString(pair[1])
+		return
+	}); err != nil {
+		return
+	}
+
+	if fields[3] != nil {
+		if d.Result, err = DeserializeString(fields[3]); err != nil {
+			return
+		}
+	}
+
+	d.Exceptions, err = DeserializeList(fields[4], func(input interface{}) (ExceptionDefinition, error) {
+		pair, ok := input.([]interface{})
+		if !ok || len(pair) < 2 {
+			return nil, ErrDeserializationError
+		}
+
+		definition, err := DeserializeString(pair[0])
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := DeserializeString(pair[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return NewExceptionDefinition(definition, name), nil
+	})
+	return
+}
+
+// Describe the methods of the service on the other end of the connection.
+//
+// Calls the built-in describe method. Exceptions raised by the server are
+// returned as Exception errors.
+func (h *ClientConnHandler) Describe(ctx context.Context) ([]MethodDescription, error) {
+	resp, err := h.CallContext(ctx, DescribeMethod, []interface{}{}, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp := resp.(type) {
+	case *ResponseMessage:
+		// Lazily decoded results are only available through DecodeResult.
+		var result interface{}
+		if err = resp.DecodeResult(&result); err != nil {
+			return nil, err
+		} else if result == nil {
+			return nil, NewDeserializationError("[]goentangle.MethodDescription", nil)
+		}
+
+		return DeserializeList(result, DeserializeMethodDescription)
+
+	case *ExceptionMessage:
+		return nil, resp.Exception()
+	}
+
+	return nil, ErrBadMessage
+}
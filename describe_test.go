@@ -0,0 +1,115 @@
+package goentangle
+
+import (
+	"context"
+	"testing"
+)
+
+// Test describing the methods of a dispatcher over a connection.
+func TestDescribe(t *testing.T) {
+	notFound := NewExceptionDefinition("test", "NotFound")
+
+	dispatcher := newTestingEchoDispatcher()
+	dispatcher.Handle("get", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		return nil, nil
+	})
+	dispatcher.Describe(MethodDescription{
+		Name: "get",
+		Doc:  "Get a value.",
+		Arguments: []ArgumentDescription{
+			{Name: "key", Type: "string"},
+		},
+		Result:     "?binary",
+		Exceptions: []ExceptionDefinition{notFound},
+	})
+
+	// Descriptions of methods without a handler are not listed.
+	dispatcher.Describe(MethodDescription{
+		Name: "missing",
+	})
+
+	client, clientConn, _ := newTestingClientServer(dispatcher)
+	defer clientConn.Close()
+
+	descriptions, err := client.Describe(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error describing: %v", err)
+	}
+
+	if len(descriptions) != 3 {
+		t.Fatalf("Expected 3 descriptions, but got %v", descriptions)
+	}
+
+	for i, expected := range []string{"echo", DescribeMethod, "get"} {
+		if descriptions[i].Name != expected {
+			t.Errorf("Expected description %d to be of %s, but got %s", i, expected, descriptions[i].Name)
+		}
+	}
+
+	if echo := descriptions[0]; echo.Doc != "" || len(echo.Arguments) != 0 || echo.Result != "" || len(echo.Exceptions) != 0 {
+		t.Errorf("Unexpected description of undescribed method: %+v", echo)
+	}
+
+	get := descriptions[2]
+	if get.Doc != "Get a value." || get.Result != "?binary" {
+		t.Errorf("Unexpected description: %+v", get)
+	}
+	if len(get.Arguments) != 1 || get.Arguments[0] != (ArgumentDescription{"key", "string"}) {
+		t.Errorf("Unexpected arguments: %v", get.Arguments)
+	}
+	if len(get.Exceptions) != 1 {
+		t.Fatalf("Unexpected exceptions: %v", get.Exceptions)
+	}
+	if definitionName, name := ExceptionDefinitionNames(get.Exceptions[0]); definitionName != "test" || name != "NotFound" {
+		t.Errorf("Unexpected exception %s.%s", definitionName, name)
+	}
+}
+
+// Test describing the methods of a dispatcher over a connection decoding
+// lazily.
+func TestDescribeLazy(t *testing.T) {
+	client, clientConn, _ := newTestingClientServer(newTestingEchoDispatcher())
+	defer clientConn.Close()
+	clientConn.EnableLazyDecoding()
+
+	descriptions, err := client.Describe(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error describing: %v", err)
+	}
+
+	if len(descriptions) != 2 {
+		t.Errorf("Expected 2 descriptions, but got %v", descriptions)
+	}
+}
+
+// Test that the describe method can be disabled.
+func TestDescribeDisabled(t *testing.T) {
+	dispatcher := NewDispatcherWithSettings(DispatcherSettings{DisableDescribe: true})
+	if descriptions := dispatcher.Descriptions(); len(descriptions) != 0 {
+		t.Errorf("Expected no descriptions, but got %v", descriptions)
+	}
+
+	client, clientConn, _ := newTestingClientServer(dispatcher)
+	defer clientConn.Close()
+
+	_, err := client.Describe(context.Background())
+	if exc, ok := err.(Exception); !ok || exc.Definition() != "entangle" || exc.Name() != "UnknownMethod" {
+		t.Errorf("Expected unknown method exception, but got %v", err)
+	}
+}
+
+// Test that method descriptions reject invalid input.
+func TestDeserializeMethodDescriptionErrors(t *testing.T) {
+	for _, input := range []interface{}{
+		nil,
+		"describe",
+		[]interface{}{"get", "", []interface{}{}, nil},
+		[]interface{}{"get", "", []interface{}{[]interface{}{"key"}}, nil, []interface{}{}},
+		[]interface{}{"get", "", []interface{}{}, int64(1), []interface{}{}},
+		[]interface{}{"get", "", []interface{}{}, nil, []interface{}{"test.NotFound"}},
+	} {
+		if _, err := DeserializeMethodDescription(input); err == nil {
+			t.Errorf("Expected error deserializing %v", input)
+		}
+	}
+}
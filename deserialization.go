@@ -3,501 +3,410 @@ package goentangle
 import (
 	"errors"
 	"math"
+	"reflect"
+	"strings"
 )
 
 var (
 	ErrDeserializationError = errors.New("deserialization error")
 )
 
-// Deserialize a string.
+// Deserialization error.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeString(input interface{}) (string, error) {
-	switch input.(type) {
-	case string:
-		return input.(string), nil
-	}
-
-	return "", ErrDeserializationError
+// Detailed deserialization error, which satisfies
+// errors.Is(err, ErrDeserializationError).
+type DeserializationError struct {
+	// Path to the value that failed deserialization, for example
+	// args[2].items[5].id. Empty for the top-level value.
+	Path string
+
+	// Expected type.
+	Expected string
+
+	// Actual type.
+	Actual string
 }
 
-// Deserialize a boolean.
+// New deserialization error for an input that could not be deserialized into
+// the expected type.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeBool(input interface{}) (bool, error) {
-	switch input.(type) {
-	case bool:
-		return input.(bool), nil
+// Used by deserializers outside of this package, such as generated ones.
+func NewDeserializationError(expected string, input interface{}) *DeserializationError {
+	actual := "nil"
+	if input != nil {
+		actual = reflect.TypeOf(input).String()
 	}
 
-	return false, ErrDeserializationError
+	return &DeserializationError{
+		Expected: expected,
+		Actual:   actual,
+	}
 }
 
-// Deserialize a binary.
-//
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeBinary(input interface{}) ([]byte, error) {
-	switch input.(type) {
-	case []byte:
-		if result := input.([]byte); result != nil {
-			return result, nil
-		}
+// New deserialization error for an input that could not be deserialized into
+// the expected Go type.
+func newDeserializationError(expected reflect.Type, input interface{}) *DeserializationError {
+	return NewDeserializationError(expected.String(), input)
+}
 
-	case string:
-		return []byte(input.(string)), nil
+func (e *DeserializationError) Error() string {
+	if e.Path == "" {
+		return "deserialization error: expected " + e.Expected + ", got " + e.Actual
 	}
 
-	return nil, ErrDeserializationError
+	return "deserialization error at " + e.Path + ": expected " + e.Expected + ", got " + e.Actual
 }
 
-// Deserialize a signed 8-bit integer.
-//
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeInt8(input interface{}) (int8, error) {
-	switch input.(type) {
-	case int8:
-		return input.(int8), nil
-
-	case int16:
-		if input.(int16) >= math.MinInt8 && input.(int16) <= math.MaxInt8 {
-			return int8(input.(int16)), nil
-		}
-
-	case int32:
-		if input.(int32) >= math.MinInt8 && input.(int32) <= math.MaxInt8 {
-			return int8(input.(int32)), nil
-		}
-
-	case int64:
-		if input.(int64) >= math.MinInt8 && input.(int64) <= math.MaxInt8 {
-			return int8(input.(int64)), nil
-		}
+func (e *DeserializationError) Unwrap() error {
+	return ErrDeserializationError
+}
 
-	case int:
-		if input.(int) >= math.MinInt8 && input.(int) <= math.MaxInt8 {
-			return int8(input.(int)), nil
+// Prefix the path of a deserialization error.
+//
+// Segments are either field names, which are joined with dots, or indexes in
+// brackets.
+func prefixDeserializationError(err error, segment string) error {
+	if e, ok := err.(*DeserializationError); ok && segment != "" {
+		if e.Path == "" || strings.HasPrefix(e.Path, "[") {
+			e.Path = segment + e.Path
+		} else {
+			e.Path = segment + "." + e.Path
 		}
+	}
 
-	case uint8:
-		if input.(uint8) <= math.MaxInt8 {
-			return int8(input.(uint8)), nil
-		}
+	return err
+}
 
-	case uint16:
-		if input.(uint16) <= math.MaxInt8 {
-			return int8(input.(uint16)), nil
-		}
+// Deserializable types.
+type Deserializable interface {
+	bool | string | []byte |
+		int8 | int16 | int32 | int64 | int |
+		uint8 | uint16 | uint32 | uint64 | uint |
+		float32 | float64
+}
 
-	case uint32:
-		if input.(uint32) <= math.MaxInt8 {
-			return int8(input.(uint32)), nil
-		}
+// Integer types.
+type integer interface {
+	int8 | int16 | int32 | int64 | int | uint8 | uint16 | uint32 | uint64 | uint
+}
 
-	case uint64:
-		if input.(uint64) <= math.MaxInt8 {
-			return int8(input.(uint64)), nil
-		}
+// Deserialize a value.
+//
+// Deserializes with the default coercion policy: integers are deserialized
+// from integers of any width and signedness that are within the range of T,
+// floating point numbers from floating point numbers of either width, and
+// binary data from binary data or strings.
+//
+// Returns a *DeserializationError if deserialization failed.
+func Deserialize[T Deserializable](input interface{}) (T, error) {
+	return DeserializeWithPolicy[T](input, DefaultCoercion)
+}
 
-	case uint:
-		if input.(uint) <= math.MaxInt8 {
-			return int8(input.(uint)), nil
-		}
+// Deserialize a value with a coercion policy.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeWithPolicy[T Deserializable](input interface{}, policy CoercionPolicy) (T, error) {
+	result, err := deserializeScalar[T](input, policy)
+	if err != nil {
+		return result, newDeserializationError(reflect.TypeOf((*T)(nil)).Elem(), input)
 	}
 
-	return 0, ErrDeserializationError
+	return result, nil
 }
 
-// Deserialize a signed 16-bit integer.
+// Deserialize a scalar value with a coercion policy.
 //
 // Returns ErrDeserializationError if deserialization failed.
-func DeserializeInt16(input interface{}) (int16, error) {
-	switch input.(type) {
-	case int8:
-		return int16(input.(int8)), nil
-
-	case int16:
-		return input.(int16), nil
-
-	case int32:
-		if input.(int32) >= math.MinInt16 && input.(int32) <= math.MaxInt16 {
-			return int16(input.(int32)), nil
-		}
-
-	case int64:
-		if input.(int64) >= math.MinInt16 && input.(int64) <= math.MaxInt16 {
-			return int16(input.(int64)), nil
-		}
-
-	case int:
-		if input.(int) >= math.MinInt16 && input.(int) <= math.MaxInt16 {
-			return int16(input.(int)), nil
+func deserializeScalar[T Deserializable](input interface{}, policy CoercionPolicy) (result T, err error) {
+	switch any(result).(type) {
+	case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+		if policy == LenientCoercion {
+			input = coerceLenientInteger(input)
 		}
 
-	case uint8:
-		return int16(input.(uint8)), nil
-
-	case uint16:
-		if input.(uint16) <= math.MaxInt16 {
-			return int16(input.(uint16)), nil
+	case float32, float64:
+		if policy == LenientCoercion {
+			input = coerceLenientFloat(input)
 		}
 
-	case uint32:
-		if input.(uint32) <= math.MaxInt16 {
-			return int16(input.(uint32)), nil
-		}
-
-	case uint64:
-		if input.(uint64) <= math.MaxInt16 {
-			return int16(input.(uint64)), nil
+	case []byte:
+		if _, ok := input.(string); ok && policy == StrictCoercion {
+			return result, ErrDeserializationError
 		}
+	}
 
-	case uint:
-		if input.(uint) <= math.MaxInt16 {
-			return int16(input.(uint)), nil
-		}
+	switch p := any(&result).(type) {
+	case *bool:
+		*p, err = deserializeBool(input)
+	case *string:
+		*p, err = deserializeString(input)
+	case *[]byte:
+		*p, err = deserializeBinary(input)
+	case *int8:
+		*p, err = deserializeInteger[int8](input)
+	case *int16:
+		*p, err = deserializeInteger[int16](input)
+	case *int32:
+		*p, err = deserializeInteger[int32](input)
+	case *int64:
+		*p, err = deserializeInteger[int64](input)
+	case *int:
+		*p, err = deserializeInteger[int](input)
+	case *uint8:
+		*p, err = deserializeInteger[uint8](input)
+	case *uint16:
+		*p, err = deserializeInteger[uint16](input)
+	case *uint32:
+		*p, err = deserializeInteger[uint32](input)
+	case *uint64:
+		*p, err = deserializeInteger[uint64](input)
+	case *uint:
+		*p, err = deserializeInteger[uint](input)
+	case *float32:
+		var f float64
+		if f, err = deserializeFloat(input); err == nil {
+			*p = float32(f)
+			if _, ok := input.(float64); ok && policy == StrictCoercion && float64(*p) != f && !math.IsNaN(f) {
+				*p, err = 0, ErrDeserializationError
+			}
+		}
+	case *float64:
+		*p, err = deserializeFloat(input)
 	}
 
-	return 0, ErrDeserializationError
+	return
 }
 
-// Deserialize a signed 32-bit integer.
+// Serialize a value.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeInt32(input interface{}) (int32, error) {
-	switch input.(type) {
+// Signed integers are serialized as 64-bit signed integers and unsigned
+// integers as 64-bit unsigned integers, matching what is deserialized from
+// the wire. Other values are serialized as they are.
+func Serialize[T Deserializable](value T) interface{} {
+	switch v := any(value).(type) {
 	case int8:
-		return int32(input.(int8)), nil
-
+		return int64(v)
 	case int16:
-		return int32(input.(int16)), nil
-
+		return int64(v)
 	case int32:
-		return input.(int32), nil
-
-	case int64:
-		if input.(int64) >= math.MinInt32 && input.(int64) <= math.MaxInt32 {
-			return int32(input.(int64)), nil
-		}
-
+		return int64(v)
 	case int:
-		if input.(int) >= math.MinInt32 && input.(int) <= math.MaxInt32 {
-			return int32(input.(int)), nil
-		}
-
+		return int64(v)
 	case uint8:
-		return int32(input.(uint8)), nil
-
+		return uint64(v)
 	case uint16:
-		return int32(input.(uint16)), nil
-
+		return uint64(v)
 	case uint32:
-		if input.(uint32) <= math.MaxInt32 {
-			return int32(input.(uint32)), nil
-		}
-
-	case uint64:
-		if input.(uint64) <= math.MaxInt32 {
-			return int32(input.(uint64)), nil
-		}
-
+		return uint64(v)
 	case uint:
-		if input.(uint) <= math.MaxInt32 {
-			return int32(input.(uint)), nil
-		}
+		return uint64(v)
 	}
 
-	return 0, ErrDeserializationError
+	return value
 }
 
-// Deserialize a signed 64-bit integer.
-//
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeInt64(input interface{}) (int64, error) {
-	switch input.(type) {
-	case int8:
-		return int64(input.(int8)), nil
-
-	case int16:
-		return int64(input.(int16)), nil
-
-	case int32:
-		return int64(input.(int32)), nil
-
-	case int64:
-		return input.(int64), nil
-
-	case int:
-		if input.(int) >= math.MinInt64 && input.(int) <= math.MaxInt64 {
-			return int64(input.(int)), nil
-		}
+// Deserialize a boolean.
+func deserializeBool(input interface{}) (bool, error) {
+	if b, ok := input.(bool); ok {
+		return b, nil
+	}
 
-	case uint8:
-		return int64(input.(uint8)), nil
+	return false, ErrDeserializationError
+}
 
-	case uint16:
-		return int64(input.(uint16)), nil
+// Deserialize a string.
+func deserializeString(input interface{}) (string, error) {
+	if s, ok := input.(string); ok {
+		return s, nil
+	}
 
-	case uint32:
-		return int64(input.(uint32)), nil
+	return "", ErrDeserializationError
+}
 
-	case uint64:
-		if input.(uint64) <= math.MaxInt64 {
-			return int64(input.(uint64)), nil
+// Deserialize binary data.
+func deserializeBinary(input interface{}) ([]byte, error) {
+	switch input.(type) {
+	case []byte:
+		if result := input.([]byte); result != nil {
+			return result, nil
 		}
 
-	case uint:
-		if input.(uint) <= math.MaxInt64 {
-			return int64(input.(uint)), nil
-		}
+	case string:
+		return []byte(input.(string)), nil
 	}
 
-	return 0, ErrDeserializationError
+	return nil, ErrDeserializationError
 }
 
-// Deserialize an unsigned 8-bit integer.
+// Deserialize an integer.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeUint8(input interface{}) (uint8, error) {
-	switch input.(type) {
-	case int8:
-		if input.(int8) >= 0 {
-			return uint8(input.(int8)), nil
-		}
+// The input is converted to T and back to detect values out of range.
+func deserializeInteger[T integer](input interface{}) (T, error) {
+	var signed int64
+	var unsigned uint64
+	isSigned := true
 
+	switch v := input.(type) {
+	case int8:
+		signed = int64(v)
 	case int16:
-		if input.(int16) >= 0 && input.(int16) <= math.MaxUint8 {
-			return uint8(input.(int16)), nil
-		}
-
+		signed = int64(v)
 	case int32:
-		if input.(int32) >= 0 && input.(int32) <= math.MaxUint8 {
-			return uint8(input.(int32)), nil
-		}
-
+		signed = int64(v)
 	case int64:
-		if input.(int64) >= 0 && input.(int64) <= math.MaxUint8 {
-			return uint8(input.(int64)), nil
-		}
-
+		signed = v
 	case int:
-		if input.(int) >= 0 && input.(int) <= math.MaxUint8 {
-			return uint8(input.(int)), nil
-		}
-
+		signed = int64(v)
 	case uint8:
-		if input.(uint8) <= math.MaxUint8 {
-			return uint8(input.(uint8)), nil
-		}
-
+		unsigned, isSigned = uint64(v), false
 	case uint16:
-		if input.(uint16) <= math.MaxUint8 {
-			return uint8(input.(uint16)), nil
-		}
-
+		unsigned, isSigned = uint64(v), false
 	case uint32:
-		if input.(uint32) <= math.MaxUint8 {
-			return uint8(input.(uint32)), nil
-		}
-
+		unsigned, isSigned = uint64(v), false
 	case uint64:
-		if input.(uint64) <= math.MaxUint8 {
-			return uint8(input.(uint64)), nil
-		}
-
+		unsigned, isSigned = v, false
 	case uint:
-		if input.(uint) <= math.MaxUint8 {
-			return uint8(input.(uint)), nil
-		}
+		unsigned, isSigned = uint64(v), false
+	default:
+		return 0, ErrDeserializationError
 	}
 
-	return 0, ErrDeserializationError
-}
-
-// Deserialize an unsigned 16-bit integer.
-//
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeUint16(input interface{}) (uint16, error) {
-	switch input.(type) {
-	case int8:
-		if input.(int8) >= 0 {
-			return uint16(input.(int8)), nil
-		}
-
-	case int16:
-		if input.(int16) >= 0 {
-			return uint16(input.(int16)), nil
-		}
-
-	case int32:
-		if input.(int32) >= 0 && input.(int32) <= math.MaxUint16 {
-			return uint16(input.(int32)), nil
-		}
-
-	case int64:
-		if input.(int64) >= 0 && input.(int64) <= math.MaxUint16 {
-			return uint16(input.(int64)), nil
-		}
-
-	case int:
-		if input.(int) >= 0 && input.(int) <= math.MaxUint16 {
-			return uint16(input.(int)), nil
+	if isSigned {
+		if result := T(signed); int64(result) == signed && (result < 0) == (signed < 0) {
+			return result, nil
 		}
-
-	case uint8:
-		return uint16(input.(uint8)), nil
-
-	case uint16:
-		return uint16(input.(uint16)), nil
-
-	case uint32:
-		if input.(uint32) <= math.MaxUint16 {
-			return uint16(input.(uint32)), nil
+	} else {
+		if result := T(unsigned); uint64(result) == unsigned && result >= 0 {
+			return result, nil
 		}
+	}
 
-	case uint64:
-		if input.(uint64) <= math.MaxUint16 {
-			return uint16(input.(uint64)), nil
-		}
+	return 0, ErrDeserializationError
+}
 
-	case uint:
-		if input.(uint) <= math.MaxUint16 {
-			return uint16(input.(uint)), nil
-		}
+// Deserialize a floating point number.
+func deserializeFloat(input interface{}) (float64, error) {
+	switch v := input.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
 	}
 
 	return 0, ErrDeserializationError
 }
 
-// Deserialize an unsigned 32-bit integer.
+// Deserialize a string.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeUint32(input interface{}) (uint32, error) {
-	switch input.(type) {
-	case int8:
-		if input.(int8) >= 0 {
-			return uint32(input.(int8)), nil
-		}
-
-	case int16:
-		if input.(int16) >= 0 {
-			return uint32(input.(int16)), nil
-		}
-
-	case int32:
-		if input.(int32) >= 0 {
-			return uint32(input.(int32)), nil
-		}
-
-	case int64:
-		if input.(int64) >= 0 && input.(int64) <= math.MaxUint32 {
-			return uint32(input.(int64)), nil
-		}
-
-	case int:
-		if input.(int) >= 0 && input.(int) <= math.MaxUint32 {
-			return uint32(input.(int)), nil
-		}
-
-	case uint8:
-		return uint32(input.(uint8)), nil
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeString(input interface{}) (string, error) {
+	return Deserialize[string](input)
+}
 
-	case uint16:
-		return uint32(input.(uint16)), nil
+// Deserialize a boolean.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeBool(input interface{}) (bool, error) {
+	return Deserialize[bool](input)
+}
 
-	case uint32:
-		return uint32(input.(uint32)), nil
+// Deserialize a binary.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeBinary(input interface{}) ([]byte, error) {
+	return Deserialize[[]byte](input)
+}
 
-	case uint64:
-		if input.(uint64) <= math.MaxUint32 {
-			return uint32(input.(uint64)), nil
-		}
+// Deserialize a fixed-length byte array.
+//
+// T must be an array of bytes, for example [32]byte. Binary data is
+// deserialized as with DeserializeBinary and must have the array's length.
+//
+// Returns a *DeserializationError if deserialization failed, or
+// ErrDeserializationError if T is not an array of bytes.
+func DeserializeByteArray[T any](input interface{}) (T, error) {
+	var result T
+
+	value := reflect.ValueOf(&result).Elem()
+	if value.Kind() != reflect.Array || value.Type().Elem().Kind() != reflect.Uint8 {
+		return result, ErrDeserializationError
+	}
 
-	case uint:
-		if input.(uint) <= math.MaxUint32 {
-			return uint32(input.(uint)), nil
-		}
+	b, err := DeserializeBinary(input)
+	if err != nil || len(b) != value.Len() {
+		return result, newDeserializationError(value.Type(), input)
 	}
 
-	return 0, ErrDeserializationError
+	reflect.Copy(value, reflect.ValueOf(b))
+	return result, nil
 }
 
-// Deserialize an unsigned 64-bit integer.
+// Deserialize a signed 8-bit integer.
 //
-// Returns ErrDeserializationError if deserialization failed.
-func DeserializeUint64(input interface{}) (uint64, error) {
-	switch input.(type) {
-	case int8:
-		if input.(int8) >= 0 {
-			return uint64(input.(int8)), nil
-		}
-
-	case int16:
-		if input.(int16) >= 0 {
-			return uint64(input.(int16)), nil
-		}
-
-	case int32:
-		if input.(int32) >= 0 {
-			return uint64(input.(int32)), nil
-		}
-
-	case int64:
-		if input.(int64) >= 0 {
-			return uint64(input.(int64)), nil
-		}
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeInt8(input interface{}) (int8, error) {
+	return Deserialize[int8](input)
+}
 
-	case int:
-		if input.(int) >= 0 {
-			return uint64(input.(int)), nil
-		}
+// Deserialize a signed 16-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeInt16(input interface{}) (int16, error) {
+	return Deserialize[int16](input)
+}
 
-	case uint8:
-		return uint64(input.(uint8)), nil
+// Deserialize a signed 32-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeInt32(input interface{}) (int32, error) {
+	return Deserialize[int32](input)
+}
 
-	case uint16:
-		return uint64(input.(uint16)), nil
+// Deserialize a signed 64-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeInt64(input interface{}) (int64, error) {
+	return Deserialize[int64](input)
+}
 
-	case uint32:
-		return uint64(input.(uint32)), nil
+// Deserialize an unsigned 8-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeUint8(input interface{}) (uint8, error) {
+	return Deserialize[uint8](input)
+}
 
-	case uint64:
-		return uint64(input.(uint64)), nil
+// Deserialize an unsigned 16-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeUint16(input interface{}) (uint16, error) {
+	return Deserialize[uint16](input)
+}
 
-	case uint:
-		if input.(uint) <= math.MaxUint64 {
-			return uint64(input.(uint)), nil
-		}
-	}
+// Deserialize an unsigned 32-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeUint32(input interface{}) (uint32, error) {
+	return Deserialize[uint32](input)
+}
 
-	return 0, ErrDeserializationError
+// Deserialize an unsigned 64-bit integer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeUint64(input interface{}) (uint64, error) {
+	return Deserialize[uint64](input)
 }
 
 // Deserialize a 64-bit floating point number.
 //
-// Returns ErrDeserializationError if deserialization failed.
+// Returns a *DeserializationError if deserialization failed.
 func DeserializeFloat64(input interface{}) (float64, error) {
-	switch input.(type) {
-	case float32:
-		return float64(input.(float32)), nil
-
-	case float64:
-		return input.(float64), nil
-	}
-
-	return 0, ErrDeserializationError
+	return Deserialize[float64](input)
 }
 
 // Deserialize a 32-bit floating point number.
 //
-// Returns ErrDeserializationError if deserialization failed.
+// Returns a *DeserializationError if deserialization failed.
 func DeserializeFloat32(input interface{}) (float32, error) {
-	switch input.(type) {
-	case float32:
-		return input.(float32), nil
-
-	case float64:
-		return float32(input.(float64)), nil
-	}
-
-	return 0, ErrDeserializationError
+	return Deserialize[float32](input)
 }
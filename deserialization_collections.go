@@ -0,0 +1,155 @@
+package goentangle
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Element deserializer.
+//
+// Deserializes a single element of a collection, like the Deserialize*
+// functions.
+type ElementDeserializer[T any] func(input interface{}) (T, error)
+
+// Deserialize an element of a collection.
+//
+// Failures reported as the ErrDeserializationError sentinel are turned into a
+// *DeserializationError with the element's type, and the error path is
+// prefixed with the given segment.
+func deserializeElement[T any](input interface{}, element ElementDeserializer[T], segment string) (T, error) {
+	value, err := element(input)
+	if err != nil {
+		if err == ErrDeserializationError {
+			err = newDeserializationError(reflect.TypeOf((*T)(nil)).Elem(), input)
+		}
+		return value, prefixDeserializationError(err, segment)
+	}
+
+	return value, nil
+}
+
+// Deserialize a list.
+//
+// Each element is deserialized with the element deserializer. Nil
+// deserializes into a nil list.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeList[T any](input interface{}, element ElementDeserializer[T]) ([]T, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	elements, ok := input.([]interface{})
+	if !ok {
+		return nil, newDeserializationError(reflect.TypeOf([]T(nil)), input)
+	}
+
+	result := make([]T, len(elements))
+	for i, e := range elements {
+		value, err := deserializeElement(e, element, "["+strconv.Itoa(i)+"]")
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+
+	return result, nil
+}
+
+// Deserialize a set.
+//
+// Sets are transmitted as lists, and each element is deserialized with the
+// element deserializer. Duplicate elements are ignored. Nil deserializes into
+// a nil set.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeSet[T comparable](input interface{}, element ElementDeserializer[T]) (map[T]struct{}, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	elements, ok := input.([]interface{})
+	if !ok {
+		return nil, newDeserializationError(reflect.TypeOf(map[T]struct{}(nil)), input)
+	}
+
+	result := make(map[T]struct{}, len(elements))
+	for i, e := range elements {
+		value, err := deserializeElement(e, element, "["+strconv.Itoa(i)+"]")
+		if err != nil {
+			return nil, err
+		}
+		result[value] = struct{}{}
+	}
+
+	return result, nil
+}
+
+// Deserialize a map.
+//
+// Keys and values are deserialized with the key and value deserializers,
+// which normalizes keys across the types the decoder produces; an integer key
+// may for example arrive as any integer width. Keys that are equal once
+// deserialized are rejected, as are inputs that are not maps. Nil
+// deserializes into a nil map.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeMap[K comparable, V any](input interface{}, key ElementDeserializer[K], value ElementDeserializer[V]) (map[K]V, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	inputValue := reflect.ValueOf(input)
+	if inputValue.Kind() != reflect.Map {
+		return nil, newDeserializationError(reflect.TypeOf(map[K]V(nil)), input)
+	}
+
+	result := make(map[K]V, inputValue.Len())
+
+	iter := inputValue.MapRange()
+	for iter.Next() {
+		k, err := deserializeElement(iter.Key().Interface(), key, "")
+		if err != nil {
+			return nil, err
+		}
+
+		segment := fmt.Sprintf("[%v]", k)
+
+		if _, exists := result[k]; exists {
+			return nil, &DeserializationError{
+				Path:     segment,
+				Expected: "unique key",
+				Actual:   "duplicate key",
+			}
+		}
+
+		v, err := deserializeElement(iter.Value().Interface(), value, segment)
+		if err != nil {
+			return nil, err
+		}
+
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+// Deserialize an optional value.
+//
+// Nil deserializes into a nil pointer, and any other input is deserialized
+// with the element deserializer.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeOptional[T any](input interface{}, element ElementDeserializer[T]) (*T, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	value, err := deserializeElement(input, element, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
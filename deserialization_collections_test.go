@@ -0,0 +1,122 @@
+package goentangle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDeserializeList(t *testing.T) {
+	// Valid.
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected []int32
+	}{
+		{nil, nil},
+		{[]interface{}{}, []int32{}},
+		{[]interface{}{int8(1), int64(-2), uint64(3)}, []int32{1, -2, 3}},
+	} {
+		actual, err := DeserializeList(testCase.Input, DeserializeInt32)
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", testCase.Input, err)
+		} else if !reflect.DeepEqual(actual, testCase.Expected) {
+			t.Errorf("Expected deserialized value to be %v, but it is %v", testCase.Expected, actual)
+		}
+	}
+
+	// Nested.
+	nested, err := DeserializeList([]interface{}{[]interface{}{"a"}, nil}, func(input interface{}) ([]string, error) {
+		return DeserializeList(input, DeserializeString)
+	})
+	if err != nil {
+		t.Errorf("Unexpected error deserializing nested list: %v", err)
+	} else if expected := [][]string{{"a"}, nil}; !reflect.DeepEqual(nested, expected) {
+		t.Errorf("Expected deserialized value to be %v, but it is %v", expected, nested)
+	}
+
+	// Invalid.
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected DeserializationError
+	}{
+		{"list", DeserializationError{"", "[]int32", "string"}},
+		{map[interface{}]interface{}{}, DeserializationError{"", "[]int32", "map[interface {}]interface {}"}},
+		{[]interface{}{int64(1), "2"}, DeserializationError{"[1]", "int32", "string"}},
+		{[]interface{}{int64(1 << 40)}, DeserializationError{"[0]", "int32", "int64"}},
+	} {
+		_, err := DeserializeList(testCase.Input, DeserializeInt32)
+		var actual *DeserializationError
+		if !errors.As(err, &actual) {
+			t.Errorf("Expected *DeserializationError deserializing %v, but got %v", testCase.Input, err)
+		} else if *actual != testCase.Expected {
+			t.Errorf("Expected error %+v deserializing %v, but got %+v", testCase.Expected, testCase.Input, *actual)
+		}
+	}
+}
+
+func TestDeserializeSet(t *testing.T) {
+	actual, err := DeserializeSet([]interface{}{"a", "b", "a"}, DeserializeString)
+	if err != nil {
+		t.Errorf("Unexpected error deserializing set: %v", err)
+	} else if expected := map[string]struct{}{"a": {}, "b": {}}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected deserialized value to be %v, but it is %v", expected, actual)
+	}
+
+	if _, err := DeserializeSet([]interface{}{"a", true}, DeserializeString); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing invalid set, but got '%v'", ErrDeserializationError, err)
+	}
+}
+
+func TestDeserializeMap(t *testing.T) {
+	// Valid.
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected map[uint16]string
+	}{
+		{nil, nil},
+		{map[interface{}]interface{}{}, map[uint16]string{}},
+		{map[interface{}]interface{}{int8(1): "a", uint64(2): "b", int64(3): "c"}, map[uint16]string{1: "a", 2: "b", 3: "c"}},
+		{map[int64]interface{}{1: "a"}, map[uint16]string{1: "a"}},
+	} {
+		actual, err := DeserializeMap(testCase.Input, DeserializeUint16, DeserializeString)
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", testCase.Input, err)
+		} else if !reflect.DeepEqual(actual, testCase.Expected) {
+			t.Errorf("Expected deserialized value to be %v, but it is %v", testCase.Expected, actual)
+		}
+	}
+
+	// Invalid.
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected DeserializationError
+	}{
+		{[]interface{}{}, DeserializationError{"", "map[uint16]string", "[]interface {}"}},
+		{map[interface{}]interface{}{int64(-1): "a"}, DeserializationError{"", "uint16", "int64"}},
+		{map[interface{}]interface{}{"1": "a"}, DeserializationError{"", "uint16", "string"}},
+		{map[interface{}]interface{}{int64(1): int64(1)}, DeserializationError{"[1]", "string", "int64"}},
+		{map[interface{}]interface{}{int8(1): "a", uint64(1): "b"}, DeserializationError{"[1]", "unique key", "duplicate key"}},
+	} {
+		_, err := DeserializeMap(testCase.Input, DeserializeUint16, DeserializeString)
+		var actual *DeserializationError
+		if !errors.As(err, &actual) {
+			t.Errorf("Expected *DeserializationError deserializing %v, but got %v", testCase.Input, err)
+		} else if *actual != testCase.Expected {
+			t.Errorf("Expected error %+v deserializing %v, but got %+v", testCase.Expected, testCase.Input, *actual)
+		}
+	}
+}
+
+func TestDeserializeOptional(t *testing.T) {
+	if actual, err := DeserializeOptional(nil, DeserializeBool); err != nil || actual != nil {
+		t.Errorf("Expected nil deserializing nil, but got %v, %v", actual, err)
+	}
+
+	if actual, err := DeserializeOptional(true, DeserializeBool); err != nil || actual == nil || !*actual {
+		t.Errorf("Expected true deserializing true, but got %v, %v", actual, err)
+	}
+
+	if _, err := DeserializeOptional("true", DeserializeBool); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing invalid optional, but got '%v'", ErrDeserializationError, err)
+	}
+}
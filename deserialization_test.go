@@ -2,6 +2,7 @@ package goentangle
 
 import (
 	"bytes"
+	"errors"
 	"math"
 	"testing"
 )
@@ -34,7 +35,7 @@ func TestDeserializeString(t *testing.T) {
 		_, err := DeserializeString(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -67,7 +68,7 @@ func TestDeserializeBool(t *testing.T) {
 		_, err := DeserializeBool(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -101,7 +102,7 @@ func TestDeserializeBinary(t *testing.T) {
 		_, err := DeserializeBinary(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -163,7 +164,7 @@ func TestDeserializeInt8(t *testing.T) {
 		_, err := DeserializeInt8(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -222,7 +223,7 @@ func TestDeserializeInt16(t *testing.T) {
 		_, err := DeserializeInt16(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -278,7 +279,7 @@ func TestDeserializeInt32(t *testing.T) {
 		_, err := DeserializeInt32(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -331,7 +332,7 @@ func TestDeserializeInt64(t *testing.T) {
 		_, err := DeserializeInt64(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -389,7 +390,7 @@ func TestDeserializeUint8(t *testing.T) {
 		_, err := DeserializeUint8(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -445,7 +446,7 @@ func TestDeserializeUint16(t *testing.T) {
 		_, err := DeserializeUint16(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -499,7 +500,7 @@ func TestDeserializeUint32(t *testing.T) {
 		_, err := DeserializeUint32(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -551,7 +552,7 @@ func TestDeserializeUint64(t *testing.T) {
 		_, err := DeserializeUint64(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -590,7 +591,7 @@ func TestDeserializeFloat32(t *testing.T) {
 		_, err := DeserializeFloat32(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
@@ -629,8 +630,82 @@ func TestDeserializeFloat64(t *testing.T) {
 		_, err := DeserializeFloat64(input)
 		if err == nil {
 			t.Errorf("Expected error while deserializing %v", input)
-		} else if err != ErrDeserializationError {
+		} else if !errors.Is(err, ErrDeserializationError) {
 			t.Errorf("Unexpected error while deserializing %v: %v", input, err)
 		}
 	}
 }
+
+func TestDeserializeGeneric(t *testing.T) {
+	// Platform-sized integers.
+	if actual, err := Deserialize[int](int8(-5)); err != nil || actual != -5 {
+		t.Errorf("Unexpected deserialized int: %v, %v", actual, err)
+	}
+	if actual, err := Deserialize[uint](uint64(math.MaxUint32)); err != nil || actual != math.MaxUint32 {
+		t.Errorf("Unexpected deserialized uint: %v, %v", actual, err)
+	}
+
+	// Boundaries.
+	if actual, err := Deserialize[int64](int64(math.MinInt64)); err != nil || actual != math.MinInt64 {
+		t.Errorf("Unexpected deserialized int64: %v, %v", actual, err)
+	}
+	if _, err := Deserialize[int64](uint64(math.MaxInt64) + 1); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected error deserializing %v into int64, but got %v", uint64(math.MaxInt64) + 1, err)
+	}
+	if _, err := Deserialize[uint](-1); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected error deserializing -1 into uint, but got %v", err)
+	}
+}
+
+func TestDeserializeScalarErrorDetails(t *testing.T) {
+	for _, testCase := range []struct{
+		Deserialize func() error
+		Expected    string
+		Actual      string
+	} {
+		{func() error { _, err := DeserializeString(true); return err }, "string", "bool"},
+		{func() error { _, err := DeserializeInt32(nil); return err }, "int32", "nil"},
+		{func() error { _, err := Deserialize[uint8](int64(256)); return err }, "uint8", "int64"},
+	} {
+		err := testCase.Deserialize()
+
+		var deserializationErr *DeserializationError
+		if !errors.As(err, &deserializationErr) {
+			t.Errorf("Expected *DeserializationError, but got %T: %v", err, err)
+			continue
+		}
+
+		if deserializationErr.Expected != testCase.Expected || deserializationErr.Actual != testCase.Actual {
+			t.Errorf("Expected error expecting %s and getting %s, but got '%v'", testCase.Expected, testCase.Actual, err)
+		}
+		if !errors.Is(err, ErrDeserializationError) {
+			t.Errorf("Expected '%v' to match '%v'", err, ErrDeserializationError)
+		}
+	}
+}
+
+func TestSerializeGeneric(t *testing.T) {
+	for _, testCase := range []struct{
+		Serialized interface{}
+		Expected   interface{}
+	} {
+		{Serialize(int8(-1)), int64(-1)},
+		{Serialize(int(1)), int64(1)},
+		{Serialize(uint16(2)), uint64(2)},
+		{Serialize(float32(1.5)), float32(1.5)},
+		{Serialize("string"), "string"},
+		{Serialize(true), true},
+	} {
+		if testCase.Serialized != testCase.Expected {
+			t.Errorf("Expected serialized value to be %#v, but it is %#v", testCase.Expected, testCase.Serialized)
+		}
+	}
+
+	// Round trip.
+	if actual, err := Deserialize[uint8](roundTripExtValue(t, Serialize(uint8(200)))); err != nil || actual != 200 {
+		t.Errorf("Unexpected round-tripped uint8: %v, %v", actual, err)
+	}
+	if actual, err := Deserialize[[]byte](roundTripExtValue(t, Serialize([]byte("binary")))); err != nil || !bytes.Equal(actual, []byte("binary")) {
+		t.Errorf("Unexpected round-tripped binary: %v, %v", actual, err)
+	}
+}
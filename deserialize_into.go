@@ -0,0 +1,469 @@
+package goentangle
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct tag key.
+//
+// The tag value is the field's name in maps, optionally followed by
+// ",index=N" giving the field's position in arrays. A name of "-" skips the
+// field.
+const structTagKey = "entangle"
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	bigIntType    = reflect.TypeOf(big.Int{})
+	decimalType   = reflect.TypeOf(Decimal{})
+	uuidType      = reflect.TypeOf(UUID{})
+	byteSliceType = reflect.TypeOf([]byte(nil))
+	stringType    = reflect.TypeOf("")
+)
+
+// Deserialize into a Go value.
+//
+// The target must be a non-nil pointer. Scalars are deserialized using the
+// range-checked Deserialize* functions. Slices and arrays are deserialized from
+// arrays, maps from maps with keys deserialized into the map's key type, and
+// pointers are allocated as needed, with nil deserializing into a nil pointer.
+// Structs are deserialized from maps by field name or from arrays by field
+// position, both of which can be controlled with the "entangle" struct tag.
+// Times, durations, arbitrary-precision integers, decimals and UUIDs are
+// deserialized as with DeserializeTime, DeserializeDuration, DeserializeBigInt,
+// DeserializeDecimal and DeserializeUUID.
+//
+// Returns a *DeserializationError locating the failure if deserialization
+// failed, or ErrDeserializationError if the target is not a non-nil pointer.
+func DeserializeInto(input interface{}, target interface{}) error {
+	return DeserializeIntoWithPolicy(input, target, DefaultCoercion)
+}
+
+// Deserialize into a Go value with a coercion policy.
+//
+// Behaves like DeserializeInto, deserializing scalars with the coercion policy.
+func DeserializeIntoWithPolicy(input interface{}, target interface{}, policy CoercionPolicy) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return ErrDeserializationError
+	}
+
+	return deserializeValue(input, value.Elem(), policy)
+}
+
+// Deserialize arguments into Go values.
+//
+// Deserializes each argument into the corresponding target as with
+// DeserializeInto, with failures located by argument, for example
+// args[2].items[5].id.
+func DeserializeArguments(arguments []interface{}, targets ...interface{}) error {
+	return DeserializeArgumentsWithPolicy(arguments, DefaultCoercion, targets...)
+}
+
+// Deserialize arguments into Go values with a coercion policy.
+//
+// Behaves like DeserializeArguments, deserializing scalars with the coercion
+// policy. Method handlers typically use the policy of the call's context,
+// given by CoercionPolicyFromContext.
+func DeserializeArgumentsWithPolicy(arguments []interface{}, policy CoercionPolicy, targets ...interface{}) error {
+	if len(arguments) != len(targets) {
+		return &DeserializationError{
+			Path:     "args",
+			Expected: strconv.Itoa(len(targets)) + " arguments",
+			Actual:   strconv.Itoa(len(arguments)) + " arguments",
+		}
+	}
+
+	for i, argument := range arguments {
+		if err := DeserializeIntoWithPolicy(argument, targets[i], policy); err != nil {
+			return prefixDeserializationError(err, "args["+strconv.Itoa(i)+"]")
+		}
+	}
+
+	return nil
+}
+
+// Deserialize into a settable value.
+//
+// Returns a *DeserializationError if deserialization failed.
+func deserializeValue(input interface{}, target reflect.Value, policy CoercionPolicy) error {
+	if err := deserializeKind(input, target, policy); err != nil {
+		if err == ErrDeserializationError {
+			return newDeserializationError(target.Type(), input)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Deserialize into a settable value by kind.
+func deserializeKind(input interface{}, target reflect.Value, policy CoercionPolicy) (err error) {
+	// Values of the target type are assigned directly.
+	if input != nil && reflect.TypeOf(input) == target.Type() {
+		target.Set(reflect.ValueOf(input))
+		return nil
+	}
+
+	switch target.Type() {
+	case timeType:
+		var t time.Time
+		if t, err = DeserializeTime(input); err == nil {
+			target.Set(reflect.ValueOf(t))
+		}
+		return
+
+	case durationType:
+		var d time.Duration
+		if d, err = DeserializeDuration(input); err == nil {
+			target.SetInt(int64(d))
+		}
+		return
+
+	case bigIntType:
+		var i *big.Int
+		if i, err = DeserializeBigInt(input); err == nil {
+			target.Addr().Interface().(*big.Int).Set(i)
+		}
+		return
+
+	case uuidType:
+		var u UUID
+		if u, err = DeserializeUUID(input); err == nil {
+			target.Set(reflect.ValueOf(u))
+		}
+		return
+
+	case decimalType:
+		var d Decimal
+		if d, err = DeserializeDecimal(input); err == nil {
+			target.Set(reflect.ValueOf(d))
+		}
+		return
+
+	case byteSliceType:
+		if input == nil {
+			target.SetBytes(nil)
+			return
+		}
+
+		var b []byte
+		if b, err = DeserializeWithPolicy[[]byte](input, policy); err == nil {
+			target.SetBytes(b)
+		}
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.Interface:
+		if input == nil {
+			target.Set(reflect.Zero(target.Type()))
+		} else if reflect.TypeOf(input).Implements(target.Type()) {
+			target.Set(reflect.ValueOf(input))
+		} else {
+			err = ErrDeserializationError
+		}
+
+	case reflect.Ptr:
+		if input == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return
+		}
+
+		value := reflect.New(target.Type().Elem())
+		if err = deserializeValue(input, value.Elem(), policy); err == nil {
+			target.Set(value)
+		}
+
+	case reflect.Bool:
+		var b bool
+		if b, err = DeserializeWithPolicy[bool](input, policy); err == nil {
+			target.SetBool(b)
+		}
+
+	case reflect.String:
+		var s string
+		if s, err = DeserializeWithPolicy[string](input, policy); err == nil {
+			target.SetString(s)
+		}
+
+	case reflect.Int8:
+		var i int8
+		if i, err = DeserializeWithPolicy[int8](input, policy); err == nil {
+			target.SetInt(int64(i))
+		}
+
+	case reflect.Int16:
+		var i int16
+		if i, err = DeserializeWithPolicy[int16](input, policy); err == nil {
+			target.SetInt(int64(i))
+		}
+
+	case reflect.Int32:
+		var i int32
+		if i, err = DeserializeWithPolicy[int32](input, policy); err == nil {
+			target.SetInt(int64(i))
+		}
+
+	case reflect.Int64, reflect.Int:
+		var i int64
+		if i, err = DeserializeWithPolicy[int64](input, policy); err == nil {
+			if target.OverflowInt(i) {
+				return ErrDeserializationError
+			}
+			target.SetInt(i)
+		}
+
+	case reflect.Uint8:
+		var u uint8
+		if u, err = DeserializeWithPolicy[uint8](input, policy); err == nil {
+			target.SetUint(uint64(u))
+		}
+
+	case reflect.Uint16:
+		var u uint16
+		if u, err = DeserializeWithPolicy[uint16](input, policy); err == nil {
+			target.SetUint(uint64(u))
+		}
+
+	case reflect.Uint32:
+		var u uint32
+		if u, err = DeserializeWithPolicy[uint32](input, policy); err == nil {
+			target.SetUint(uint64(u))
+		}
+
+	case reflect.Uint64, reflect.Uint:
+		var u uint64
+		if u, err = DeserializeWithPolicy[uint64](input, policy); err == nil {
+			if target.OverflowUint(u) {
+				return ErrDeserializationError
+			}
+			target.SetUint(u)
+		}
+
+	case reflect.Float32:
+		var f float32
+		if f, err = DeserializeWithPolicy[float32](input, policy); err == nil {
+			target.SetFloat(float64(f))
+		}
+
+	case reflect.Float64:
+		var f float64
+		if f, err = DeserializeWithPolicy[float64](input, policy); err == nil {
+			target.SetFloat(f)
+		}
+
+	case reflect.Slice:
+		err = deserializeSlice(input, target, policy)
+
+	case reflect.Array:
+		err = deserializeArray(input, target, policy)
+
+	case reflect.Map:
+		err = deserializeMap(input, target, policy)
+
+	case reflect.Struct:
+		err = deserializeStruct(input, target, policy)
+
+	default:
+		err = ErrDeserializationError
+	}
+
+	return
+}
+
+// Deserialize a slice.
+func deserializeSlice(input interface{}, target reflect.Value, policy CoercionPolicy) error {
+	if input == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	elements, ok := input.([]interface{})
+	if !ok {
+		return ErrDeserializationError
+	}
+
+	slice := reflect.MakeSlice(target.Type(), len(elements), len(elements))
+	for i, element := range elements {
+		if err := deserializeValue(element, slice.Index(i), policy); err != nil {
+			return prefixDeserializationError(err, "["+strconv.Itoa(i)+"]")
+		}
+	}
+
+	target.Set(slice)
+	return nil
+}
+
+// Deserialize an array.
+//
+// Byte arrays are also deserialized from binary data of the same length.
+func deserializeArray(input interface{}, target reflect.Value, policy CoercionPolicy) error {
+	if target.Type().Elem().Kind() == reflect.Uint8 {
+		if b, err := DeserializeWithPolicy[[]byte](input, policy); err == nil {
+			if len(b) != target.Len() {
+				return ErrDeserializationError
+			}
+
+			reflect.Copy(target, reflect.ValueOf(b))
+			return nil
+		}
+	}
+
+	elements, ok := input.([]interface{})
+	if !ok || len(elements) != target.Len() {
+		return ErrDeserializationError
+	}
+
+	for i, element := range elements {
+		if err := deserializeValue(element, target.Index(i), policy); err != nil {
+			return prefixDeserializationError(err, "["+strconv.Itoa(i)+"]")
+		}
+	}
+
+	return nil
+}
+
+// Deserialize a map.
+func deserializeMap(input interface{}, target reflect.Value, policy CoercionPolicy) error {
+	if input == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	inputValue := reflect.ValueOf(input)
+	if inputValue.Kind() != reflect.Map {
+		return ErrDeserializationError
+	}
+
+	mapType := target.Type()
+	result := reflect.MakeMap(mapType)
+
+	iter := inputValue.MapRange()
+	for iter.Next() {
+		key := reflect.New(mapType.Key()).Elem()
+		if err := deserializeValue(iter.Key().Interface(), key, policy); err != nil {
+			return err
+		}
+
+		value := reflect.New(mapType.Elem()).Elem()
+		if err := deserializeValue(iter.Value().Interface(), value, policy); err != nil {
+			return prefixDeserializationError(err, fmt.Sprintf("[%v]", iter.Key().Interface()))
+		}
+
+		result.SetMapIndex(key, value)
+	}
+
+	target.Set(result)
+	return nil
+}
+
+// Struct field.
+type structField struct {
+	// Name in maps.
+	name string
+
+	// Position in arrays.
+	index int
+
+	// Field index in the struct.
+	field int
+}
+
+// Get the deserializable fields of a struct type.
+func structFields(structType reflect.Type) (fields []structField) {
+	position := 0
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		index := position
+
+		if tag, ok := field.Tag.Lookup(structTagKey); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			} else if parts[0] != "" {
+				name = parts[0]
+			}
+
+			for _, option := range parts[1:] {
+				if strings.HasPrefix(option, "index=") {
+					if n, err := strconv.Atoi(option[len("index="):]); err == nil {
+						index = n
+					}
+				}
+			}
+		}
+
+		fields = append(fields, structField{
+			name:  name,
+			index: index,
+			field: i,
+		})
+		position++
+	}
+
+	return
+}
+
+// Deserialize a struct.
+//
+// Fields missing from the input are left untouched, and input without a
+// corresponding field is ignored.
+func deserializeStruct(input interface{}, target reflect.Value, policy CoercionPolicy) error {
+	fields := structFields(target.Type())
+
+	// Positional fields.
+	if elements, ok := input.([]interface{}); ok {
+		for _, field := range fields {
+			if field.index < 0 || field.index >= len(elements) {
+				continue
+			}
+
+			if err := deserializeValue(elements[field.index], target.Field(field.field), policy); err != nil {
+				return prefixDeserializationError(err, field.name)
+			}
+		}
+
+		return nil
+	}
+
+	// Named fields.
+	inputValue := reflect.ValueOf(input)
+	if input == nil || inputValue.Kind() != reflect.Map {
+		return ErrDeserializationError
+	}
+
+	named := make(map[string]interface{}, inputValue.Len())
+	iter := inputValue.MapRange()
+	for iter.Next() {
+		key, err := DeserializeString(iter.Key().Interface())
+		if err != nil {
+			return newDeserializationError(stringType, iter.Key().Interface())
+		}
+		named[key] = iter.Value().Interface()
+	}
+
+	for _, field := range fields {
+		value, ok := named[field.name]
+		if !ok {
+			continue
+		}
+
+		if err := deserializeValue(value, target.Field(field.field), policy); err != nil {
+			return prefixDeserializationError(err, field.name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package goentangle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type deserializeIntoItem struct {
+	Id   int32    `entangle:"id"`
+	Name string   `entangle:"name,index=2"`
+	Tags []string `entangle:",index=1"`
+	Skip string   `entangle:"-"`
+}
+
+type deserializeIntoOrder struct {
+	Items    []deserializeIntoItem
+	Counts   map[string]uint16
+	Parent   *deserializeIntoItem
+	Created  time.Time
+	Checksum [4]byte
+	Extra    interface{}
+}
+
+func TestDeserializeInto(t *testing.T) {
+	input := map[interface{}]interface{}{
+		"Items": []interface{}{
+			map[interface{}]interface{}{
+				"id":   int64(1),
+				"name": "first",
+				"Tags": []interface{}{"a", "b"},
+				"Skip": "ignored",
+			},
+			[]interface{}{int64(2), []interface{}{}, "second"},
+		},
+		"Counts":   map[interface{}]interface{}{"x": int64(3), "y": uint64(4)},
+		"Parent":   nil,
+		"Created":  []interface{}{int64(1400000000), int64(5)},
+		"Checksum": []byte{1, 2, 3, 4},
+		"Extra":    "anything",
+	}
+
+	expected := deserializeIntoOrder{
+		Items: []deserializeIntoItem{
+			{Id: 1, Name: "first", Tags: []string{"a", "b"}},
+			{Id: 2, Name: "second", Tags: []string{}},
+		},
+		Counts:   map[string]uint16{"x": 3, "y": 4},
+		Created:  time.Unix(1400000000, 5).UTC(),
+		Checksum: [4]byte{1, 2, 3, 4},
+		Extra:    "anything",
+	}
+
+	var actual deserializeIntoOrder
+	if err := DeserializeInto(input, &actual); err != nil {
+		t.Fatalf("Unexpected error deserializing: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected deserialized value to be %+v, but it is %+v", expected, actual)
+	}
+
+	// Pointers are allocated.
+	var parent *deserializeIntoItem
+	if err := DeserializeInto([]interface{}{int64(7)}, &parent); err != nil {
+		t.Errorf("Unexpected error deserializing pointer: %v", err)
+	} else if parent == nil || parent.Id != 7 {
+		t.Errorf("Unexpected deserialized pointer: %+v", parent)
+	}
+
+	// Times are deserialized from nanoseconds.
+	var created time.Time
+	if err := DeserializeInto(int64(1400000000000000005), &created); err != nil || !created.Equal(time.Unix(1400000000, 5)) {
+		t.Errorf("Unexpected deserialized time %v: %v", created, err)
+	}
+
+	// Invalid.
+	for _, testCase := range []struct {
+		Input  interface{}
+		Target interface{}
+	}{
+		{int64(1), nil},
+		{int64(1), actual},
+		{int64(300), new(int8)},
+		{"abc", new(int32)},
+		{[]interface{}{int64(1)}, new([2]int)},
+		{[]byte{1, 2}, new([4]byte)},
+		{map[interface{}]interface{}{int64(1): "a"}, new(map[string]string)},
+		{[]interface{}{"abc"}, new(deserializeIntoItem)},
+		{"abc", new(deserializeIntoItem)},
+		{int64(1), new(error)},
+	} {
+		if err := DeserializeInto(testCase.Input, testCase.Target); !errors.Is(err, ErrDeserializationError) {
+			t.Errorf("Expected '%v' deserializing %v into %T, but got '%v'", ErrDeserializationError, testCase.Input, testCase.Target, err)
+		}
+	}
+}
+
+func TestDeserializeArgumentsErrorPath(t *testing.T) {
+	var (
+		name  string
+		count uint8
+		order deserializeIntoOrder
+	)
+
+	for _, testCase := range []struct {
+		Arguments []interface{}
+		Expected  DeserializationError
+	}{
+		{
+			[]interface{}{"name"},
+			DeserializationError{"args", "3 arguments", "1 arguments"},
+		},
+		{
+			[]interface{}{int64(1), int64(1), nil},
+			DeserializationError{"args[0]", "string", "int64"},
+		},
+		{
+			[]interface{}{"name", int64(256), nil},
+			DeserializationError{"args[1]", "uint8", "int64"},
+		},
+		{
+			[]interface{}{"name", int64(1), map[interface{}]interface{}{
+				"Items": []interface{}{
+					[]interface{}{int64(1)},
+					map[interface{}]interface{}{"id": "abc"},
+				},
+			}},
+			DeserializationError{"args[2].Items[1].id", "int32", "string"},
+		},
+		{
+			[]interface{}{"name", int64(1), map[interface{}]interface{}{
+				"Counts": map[interface{}]interface{}{"x": int64(-1)},
+			}},
+			DeserializationError{"args[2].Counts[x]", "uint16", "int64"},
+		},
+		{
+			[]interface{}{"name", int64(1), map[interface{}]interface{}{
+				int64(1): nil,
+			}},
+			DeserializationError{"args[2]", "string", "int64"},
+		},
+	} {
+		err := DeserializeArguments(testCase.Arguments, &name, &count, &order)
+		if !errors.Is(err, ErrDeserializationError) {
+			t.Errorf("Expected '%v' deserializing %v, but got '%v'", ErrDeserializationError, testCase.Arguments, err)
+			continue
+		}
+
+		var actual *DeserializationError
+		if !errors.As(err, &actual) {
+			t.Errorf("Expected *DeserializationError deserializing %v, but got %T", testCase.Arguments, err)
+		} else if *actual != testCase.Expected {
+			t.Errorf("Expected error %+v deserializing %v, but got %+v", testCase.Expected, testCase.Arguments, *actual)
+		}
+	}
+
+	err := &DeserializationError{"args[2].items[5].id", "int32", "string"}
+	if expected := "deserialization error at args[2].items[5].id: expected int32, got string"; err.Error() != expected {
+		t.Errorf("Expected error message %q, but got %q", expected, err.Error())
+	}
+}
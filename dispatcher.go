@@ -0,0 +1,237 @@
+package goentangle
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Method handler.
+//
+// Handles a request or notification. The trace is nil unless the caller
+// requested tracing. The result is discarded for notifications.
+type MethodHandler func(ctx context.Context, call *Call, trace Trace) (result interface{}, err error)
+
+// Dispatcher.
+//
+// Server-side method registry that dispatches incoming requests and
+// notifications to their method handlers, and sends the resulting response,
+// exception or notification acknowledgement.
+type Dispatcher struct {
+	// Method handlers.
+	handlers map[string]MethodHandler
+
+	// Method descriptions.
+	descriptions map[string]MethodDescription
+
+	// Interceptors.
+	interceptors []UnaryInterceptor
+
+	// Lock.
+	lock sync.RWMutex
+}
+
+// Dispatcher settings.
+type DispatcherSettings struct {
+	// Do not handle the built-in describe method.
+	//
+	// Calls of the describe method then raise an UnknownMethodError
+	// exception, so that the methods of the service are not disclosed.
+	DisableDescribe bool
+}
+
+// New dispatcher.
+//
+// The dispatcher handles the built-in describe method.
+func NewDispatcher() *Dispatcher {
+	return NewDispatcherWithSettings(DispatcherSettings{})
+}
+
+// New dispatcher with settings.
+func NewDispatcherWithSettings(settings DispatcherSettings) *Dispatcher {
+	d := &Dispatcher{
+		handlers:     make(map[string]MethodHandler),
+		descriptions: make(map[string]MethodDescription),
+	}
+
+	if settings.DisableDescribe {
+		return d
+	}
+
+	d.Handle(DescribeMethod, func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		descriptions := d.Descriptions()
+		result := make([]interface{}, len(descriptions))
+		for i, description := range descriptions {
+			result[i] = description.Serialize()
+		}
+		return result, nil
+	})
+
+	d.Describe(MethodDescription{
+		Name:   DescribeMethod,
+		Doc:    "Describe the methods of the service.",
+		Result: "[]MethodDescription",
+	})
+
+	return d
+}
+
+// Register a method handler.
+//
+// Registering a handler for a method that already has one replaces it.
+func (d *Dispatcher) Handle(method string, handler MethodHandler) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.handlers[method] = handler
+}
+
+// Describe a method.
+//
+// The description is returned by the describe method along with the
+// descriptions of the other methods, once a handler is registered for the
+// method. Describing a method that already has a description replaces it.
+func (d *Dispatcher) Describe(description MethodDescription) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.descriptions[description.Name] = description
+}
+
+// Get the descriptions of the registered methods, sorted by name.
+//
+// Methods registered without a description are described by their name only.
+func (d *Dispatcher) Descriptions() []MethodDescription {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	descriptions := make([]MethodDescription, 0, len(d.handlers))
+	for method := range d.handlers {
+		description, ok := d.descriptions[method]
+		if !ok {
+			description.Name = method
+		}
+		descriptions = append(descriptions, description)
+	}
+
+	sort.Slice(descriptions, func(i, j int) bool {
+		return descriptions[i].Name < descriptions[j].Name
+	})
+
+	return descriptions
+}
+
+// Add interceptors.
+//
+// Interceptors wrap the dispatch of every subsequent call, the first added
+// being the outermost.
+func (d *Dispatcher) Intercept(interceptors ...UnaryInterceptor) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.interceptors = append(d.interceptors[:len(d.interceptors):len(d.interceptors)], interceptors...)
+}
+
+// Dispatch a message received on a connection.
+//
+// Requests and notifications are passed through the interceptors to their
+// method handler, and the reply is sent on the connection. Nothing is sent if
+// an interceptor swallows the call by returning neither a message nor an
+// error. Notifications of unknown methods are only acknowledged. Other
+// messages are ignored. Returns any error from sending the reply.
+func (d *Dispatcher) Dispatch(ctx context.Context, conn *Conn, msg Message) error {
+	var call *Call
+	var err error
+
+	// Lazily decoded arguments are decoded for the handler, and messages
+	// decode arguments with the context's coercion policy.
+	switch m := msg.(type) {
+	case *RequestMessage:
+		if m.Arguments == nil && m.rawArguments != nil {
+			m.Arguments, err = decodeRawArguments(m.rawArguments)
+		}
+		m.coercionPolicy = CoercionPolicyFromContext(ctx)
+
+		call = &Call{
+			Conn:      conn,
+			Method:    m.Method,
+			Arguments: m.Arguments,
+			Trace:     m.Trace,
+		}
+
+	case *NotificationMessage:
+		if m.Arguments == nil && m.rawArguments != nil {
+			m.Arguments, err = decodeRawArguments(m.rawArguments)
+		}
+		m.coercionPolicy = CoercionPolicyFromContext(ctx)
+
+		call = &Call{
+			Conn:         conn,
+			Method:       m.Method,
+			Arguments:    m.Arguments,
+			Notification: true,
+		}
+
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return conn.RaiseException(BadMessageError.New("invalid arguments"), msg, nil)
+	}
+
+	d.lock.RLock()
+	interceptors := d.interceptors
+	d.lock.RUnlock()
+
+	// Invoke the handler. The trace is kept outside of the invoker so that it
+	// can be attached to an exception as well.
+	var trace Trace
+
+	reply, err := chainUnaryInvoker(interceptors, func(ctx context.Context, call *Call) (Message, error) {
+		d.lock.RLock()
+		handler, ok := d.handlers[call.Method]
+		d.lock.RUnlock()
+
+		// Notifications of unknown methods are acknowledged without being
+		// handled, as notifications do not expect exceptions.
+		if !ok && call.Notification {
+			return &NotificationAcknowledgementMessage{
+				messageId: msg.MessageId(),
+			}, nil
+		} else if !ok {
+			return nil, UnknownMethodError.Newf("unknown method: %s", call.Method)
+		}
+
+		if call.Trace {
+			trace = NewTrace(call.Method)
+		}
+
+		result, err := handler(ctx, call, trace)
+
+		if trace != nil {
+			trace.End()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if call.Notification {
+			return &NotificationAcknowledgementMessage{
+				messageId: msg.MessageId(),
+			}, nil
+		}
+
+		return &ResponseMessage{
+			messageId: msg.MessageId(),
+			Result:    result,
+			Trace:     trace,
+		}, nil
+	})(ctx, call)
+
+	if err != nil {
+		return conn.RaiseException(err, msg, trace)
+	} else if reply == nil {
+		return nil
+	}
+
+	return conn.send(reply)
+}
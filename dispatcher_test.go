@@ -0,0 +1,87 @@
+package goentangle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that notifications of unknown methods are acknowledged, while requests
+// raise an exception.
+func TestDispatcherUnknownMethod(t *testing.T) {
+	client, clientConn, _ := newTestingClientServer(NewDispatcher())
+	defer clientConn.Close()
+
+	if resp, err := client.Call("missing", []interface{}{}, true, false); err != nil {
+		t.Fatalf("Unexpected error notifying: %v", err)
+	} else if _, ok := resp.(*NotificationAcknowledgementMessage); !ok {
+		t.Errorf("Expected notification acknowledgement, but got %v", resp)
+	}
+
+	if resp, err := client.Call("missing", []interface{}{}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if exc, ok := resp.(*ExceptionMessage); !ok || !exc.Is(UnknownMethodError) {
+		t.Errorf("Expected unknown method exception, but got %v", resp)
+	}
+}
+
+// Test that the contexts of calls are cancelled when the connection closes.
+func TestServerConnContextCancelled(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("wait", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+
+	client, clientConn, _ := newTestingClientServer(dispatcher)
+
+	go client.Call("wait", []interface{}{}, false, false)
+	<-started
+
+	clientConn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the call's context to be cancelled when the connection closed")
+	}
+}
+
+// Test that dispatched messages decode arguments with the context's coercion
+// policy.
+func TestDispatcherCoercionPolicy(t *testing.T) {
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("noop", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		return nil, nil
+	})
+
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+	go func() {
+		for {
+			if _, err := clientConn.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for policy, accepted := range map[CoercionPolicy]bool{
+		DefaultCoercion: false,
+		LenientCoercion: true,
+	} {
+		msg := &NotificationMessage{Method: "noop", Arguments: []interface{}{float64(2)}}
+		if err := dispatcher.Dispatch(WithCoercionPolicy(context.Background(), policy), serverConn, msg); err != nil {
+			t.Fatalf("Unexpected error dispatching: %v", err)
+		}
+
+		var value int32
+		if err := msg.DecodeArguments(&value); (err == nil) != accepted {
+			t.Errorf("Expected acceptance of a whole float with %s coercion to be %v, but got %v", policy, accepted, err)
+		}
+	}
+}
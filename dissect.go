@@ -0,0 +1,346 @@
+package goentangle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dissection error.
+//
+// Error dissecting a message, wrapping ErrInvalidMessageData,
+// ErrInvalidMessageOpcode, ErrInvalidMessageId or ErrBadMessage as Conn's
+// Receive would return it.
+type DissectionError struct {
+	// Byte offset of the message in the stream.
+	Offset int64
+
+	// Error.
+	Err error
+}
+
+func (e *DissectionError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+func (e *DissectionError) Unwrap() error {
+	return e.Err
+}
+
+// Dissected message field.
+type DissectedField struct {
+	// Field name.
+	Name string
+
+	// Value.
+	Value interface{}
+}
+
+// Dissected message.
+type DissectedMessage struct {
+	// Byte offset of the message in the stream, or in the decompressed data
+	// of the compressed message containing it.
+	Offset int64
+
+	// Raw encoding.
+	Raw []byte
+
+	// Opcode.
+	Opcode Opcode
+
+	// Message ID.
+	MessageId MessageId
+
+	// Fields following the opcode and message ID.
+	//
+	// Fields are named after their role for the message's opcode if it has the
+	// expected number of fields.
+	Fields []DissectedField
+
+	// Decoded message. Nil if the message is invalid or a message chunk, as
+	// chunked messages are not reassembled.
+	Message Message
+
+	// Decompressed message of compressed messages.
+	Decompressed *DissectedMessage
+}
+
+// Field names by opcode.
+var dissectedFieldNames = map[Opcode][]string{
+	RequestOpcode:                     {"method", "arguments", "trace"},
+	NotificationOpcode:                {"method", "arguments"},
+	ResponseOpcode:                    {"result", "trace"},
+	ExceptionOpcode:                   {"definition", "name", "description", "trace", "retry after"},
+	NotificationAcknowledgementOpcode: {},
+	MessageChunkOpcode:                {"final", "data"},
+	CompressedMessageOpcode:           {"compression method", "data"},
+}
+
+// Number of optional trailing fields by opcode.
+var dissectedOptionalFields = map[Opcode]int{
+	ExceptionOpcode: 1,
+}
+
+// Counting reader.
+//
+// Byte reader counting the bytes read through it.
+type countingReader struct {
+	// Underlying reader.
+	reader byteReader
+
+	// Number of bytes read.
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.count += int64(n)
+	return
+}
+
+func (r *countingReader) ReadByte() (b byte, err error) {
+	if b, err = r.reader.ReadByte(); err == nil {
+		r.count++
+	}
+	return
+}
+
+func (r *countingReader) UnreadByte() (err error) {
+	if err = r.reader.UnreadByte(); err == nil {
+		r.count--
+	}
+	return
+}
+
+// Dissector.
+//
+// Reads messages from a raw byte stream, such as a capture of a connection,
+// and dissects them for inspection.
+type Dissector struct {
+	// Counting reader the decoder reads from.
+	counter *countingReader
+
+	// Decoder.
+	decoder *messageDecoder
+
+	// Unrecoverable error.
+	err error
+}
+
+// New dissector.
+func NewDissector(r io.Reader) *Dissector {
+	counter := &countingReader{
+		reader: bufio.NewReader(r),
+	}
+
+	return &Dissector{
+		counter: counter,
+		decoder: newMessageDecoder(counter),
+	}
+}
+
+// Dissect the next message.
+//
+// Returns io.EOF at the end of the stream. Messages that are invalid, but can
+// be delimited in the stream, are returned along with a *DissectionError, and
+// dissection can continue with the next message. If a message cannot be
+// delimited, only the *DissectionError is returned, which is then returned by
+// every subsequent call.
+func (d *Dissector) Next() (*DissectedMessage, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	offset := d.counter.count
+
+	raw, err := d.decoder.raw()
+	if err != nil {
+		if err == io.EOF && len(raw) == 0 {
+			d.err = io.EOF
+		} else {
+			d.err = &DissectionError{offset, ErrInvalidMessageData}
+		}
+		return nil, d.err
+	}
+
+	return dissectMessage(raw, offset, 0)
+}
+
+// Dissect the raw encoding of a message at a compression nesting level.
+func dissectMessage(raw []byte, offset int64, level int) (m *DissectedMessage, err error) {
+	m = &DissectedMessage{
+		Offset: offset,
+		Raw:    raw,
+	}
+
+	value, err := decodeRawValue(raw)
+	values, _ := value.([]interface{})
+	if err != nil || len(values) < 2 {
+		return m, &DissectionError{offset, ErrInvalidMessageData}
+	}
+
+	var ok bool
+	if m.Opcode, ok = ParseOpcode(values[0]); !ok || !m.Opcode.Valid() {
+		return m, &DissectionError{offset, ErrInvalidMessageOpcode}
+	}
+
+	if m.MessageId, ok = ParseMessageId(values[1]); !ok {
+		return m, &DissectionError{offset, ErrInvalidMessageId}
+	}
+
+	names := dissectedFieldNames[m.Opcode]
+	named := len(values)-2 <= len(names) && len(values)-2 >= len(names)-dissectedOptionalFields[m.Opcode]
+	for i, value := range values[2:] {
+		name := strconv.Itoa(i + 2)
+		if named {
+			name = names[i]
+		}
+
+		m.Fields = append(m.Fields, DissectedField{name, value})
+	}
+
+	// Compressed messages are dissected as well as decoded, to expose their
+	// decompressed fields.
+	if m.Opcode == CompressedMessageOpcode {
+		if level >= maxCompressionNesting || len(m.Fields) != 2 {
+			return m, &DissectionError{offset, ErrBadMessage}
+		}
+
+		method, methodOk := DeserializeCompressionMethod(m.Fields[0].Value)
+		data, dataErr := DeserializeBinary(m.Fields[1].Value)
+		if !methodOk || !method.Valid() || dataErr != nil {
+			return m, &DissectionError{offset, ErrBadMessage}
+		}
+
+		decompressed, decompressErr := method.Decompress(data)
+		if decompressErr != nil {
+			return m, &DissectionError{offset, ErrBadMessage}
+		}
+
+		if m.Decompressed, err = dissectMessage(decompressed, 0, level+1); err != nil {
+			return m, &DissectionError{offset, err.(*DissectionError).Err}
+		}
+	}
+
+	// Message chunks are only checked, as they carry part of a message.
+	if m.Opcode == MessageChunkOpcode {
+		if len(m.Fields) != 2 || level > 0 {
+			return m, &DissectionError{offset, ErrBadMessage}
+		}
+
+		_, finalOk := m.Fields[0].Value.(bool)
+		if _, dataErr := DeserializeBinary(m.Fields[1].Value); !finalOk || dataErr != nil {
+			return m, &DissectionError{offset, ErrBadMessage}
+		}
+
+		return m, nil
+	}
+
+	if m.Message, err = decodeMessage(raw); err != nil {
+		return m, &DissectionError{offset, err}
+	}
+
+	return m, nil
+}
+
+// Decode the raw encoding of a message as a connection would.
+func decodeMessage(raw []byte) (Message, error) {
+	return new(Conn).readMessage(newMessageDecoder(bytes.NewReader(raw)))
+}
+
+// Dump the messages of a raw byte stream.
+//
+// Prints every message with its offset, length, opcode, message ID and
+// fields, expanding compressed messages. Invalid messages are printed with
+// their error. Returns the first error, or any error that stopped dissection.
+func Dump(w io.Writer, r io.Reader) error {
+	var firstErr error
+
+	d := NewDissector(r)
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return firstErr
+		}
+
+		if m != nil {
+			dumpMessage(w, m, "")
+		}
+
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			if m == nil {
+				return firstErr
+			}
+		}
+	}
+}
+
+// Dump a dissected message with an indentation.
+func dumpMessage(w io.Writer, m *DissectedMessage, indent string) {
+	fmt.Fprintf(w, "%soffset %d, %d bytes: %s, message ID %d\n", indent, m.Offset, len(m.Raw), m.Opcode, m.MessageId)
+
+	for _, field := range m.Fields {
+		if m.Opcode == CompressedMessageOpcode && field.Name == "compression method" {
+			if method, ok := DeserializeCompressionMethod(field.Value); ok {
+				fmt.Fprintf(w, "%s  %s: %s\n", indent, field.Name, method)
+				continue
+			}
+		}
+
+		fmt.Fprintf(w, "%s  %s: %s\n", indent, field.Name, formatDumpValue(field.Value))
+	}
+
+	if m.Decompressed != nil {
+		fmt.Fprintf(w, "%s  decompressed:\n", indent)
+		dumpMessage(w, m.Decompressed, indent+"    ")
+	}
+}
+
+// Format a value for dumping.
+func formatDumpValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+
+	case string:
+		return strconv.Quote(v)
+
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+
+	case bool, int64, uint64, float32, float64:
+		return fmt.Sprint(v)
+
+	case []interface{}:
+		elements := make([]string, len(v))
+		for i, e := range v {
+			elements[i] = formatDumpValue(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case map[interface{}]interface{}:
+		entries := make([]string, 0, len(v))
+		for k, e := range v {
+			entries = append(entries, formatDumpValue(k)+": "+formatDumpValue(e))
+		}
+		sort.Strings(entries)
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+
+	if typeName, formatted, ok := FormatExtValue(value); ok {
+		return typeName + " " + formatted
+	}
+
+	return fmt.Sprintf("%T %v", value, value)
+}
@@ -0,0 +1,158 @@
+package goentangle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encodeTestingMessage(t *testing.T, fields ...interface{}) []byte {
+	buffer, err := encodeSlice(fields)
+	if err != nil {
+		t.Fatalf("Error encoding: %v", err)
+	}
+	defer buffer.release()
+
+	return append([]byte(nil), buffer.Bytes()...)
+}
+
+func compressTestingMessage(t *testing.T, messageId MessageId, data []byte) []byte {
+	compressed, err := SnappyCompression.Compress(data)
+	if err != nil {
+		t.Fatalf("Error compressing: %v", err)
+	}
+
+	return encodeTestingMessage(t, CompressedMessageOpcode, messageId, SnappyCompression, compressed)
+}
+
+// Test dissecting a stream of messages.
+func TestDissector(t *testing.T) {
+	request := encodeTestingMessage(t, RequestOpcode, MessageId(1), "echo", []interface{}{"a", int64(2)}, false)
+	response := encodeTestingMessage(t, ResponseOpcode, MessageId(1), []interface{}{"a", int64(2)}, nil)
+	compressed := compressTestingMessage(t, 2, encodeTestingMessage(t, NotificationOpcode, MessageId(2), "notify", []interface{}{}))
+
+	d := NewDissector(bytes.NewReader(append(append(append([]byte(nil), request...), response...), compressed...)))
+
+	m, err := d.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Offset != 0 || len(m.Raw) != len(request) || m.Opcode != RequestOpcode || m.MessageId != 1 {
+		t.Errorf("Unexpected request: %+v", m)
+	}
+	if len(m.Fields) != 3 || m.Fields[0].Name != "method" || m.Fields[0].Value != "echo" || m.Fields[2].Name != "trace" {
+		t.Errorf("Unexpected request fields: %v", m.Fields)
+	}
+	if req, ok := m.Message.(*RequestMessage); !ok || req.Method != "echo" {
+		t.Errorf("Unexpected request message: %v", m.Message)
+	}
+
+	m, err = d.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Offset != int64(len(request)) || m.Opcode != ResponseOpcode {
+		t.Errorf("Unexpected response: %+v", m)
+	}
+
+	m, err = d.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Offset != int64(len(request)+len(response)) || m.Opcode != CompressedMessageOpcode || m.Decompressed == nil {
+		t.Fatalf("Unexpected compressed message: %+v", m)
+	}
+	if m.Decompressed.Opcode != NotificationOpcode || m.Decompressed.Fields[0].Value != "notify" {
+		t.Errorf("Unexpected decompressed message: %+v", m.Decompressed)
+	}
+	if notification, ok := m.Message.(*NotificationMessage); !ok || notification.Method != "notify" {
+		t.Errorf("Unexpected compressed message decoding: %v", m.Message)
+	}
+
+	if _, err = d.Next(); err != io.EOF {
+		t.Errorf("Expected EOF, but got %v", err)
+	}
+}
+
+// Test that invalid messages are reported with their offsets.
+func TestDissectorErrors(t *testing.T) {
+	// A request with a missing field, a message with an invalid opcode, a
+	// message with an invalid message ID, a compressed message nested too
+	// deeply and a truncated message.
+	stream := []byte{0x94, 0x00, 0x01, 0xa1, 0x6d, 0x90}
+	stream = append(stream, 0x92, 0x10, 0x01)
+	stream = append(stream, 0x92, 0x04, 0xa1, 0x78)
+	nested := []byte{0x92, 0x04, 0x01}
+	for i := 0; i <= maxCompressionNesting; i++ {
+		nested = compressTestingMessage(t, 1, nested)
+	}
+	stream = append(stream, nested...)
+	stream = append(stream, 0x92, 0x04)
+
+	d := NewDissector(bytes.NewReader(stream))
+
+	offset := int64(0)
+	for _, testCase := range []struct {
+		length   int
+		expected error
+	}{
+		{6, ErrBadMessage},
+		{3, ErrInvalidMessageOpcode},
+		{4, ErrInvalidMessageId},
+		{len(nested), ErrBadMessage},
+	} {
+		m, err := d.Next()
+		if m == nil || len(m.Raw) != testCase.length {
+			t.Fatalf("Expected message of %d bytes at offset %d, but got %+v", testCase.length, offset, m)
+		}
+
+		var dissectionErr *DissectionError
+		if !errors.As(err, &dissectionErr) || dissectionErr.Offset != offset || !errors.Is(err, testCase.expected) {
+			t.Errorf("Expected %v at offset %d, but got %v", testCase.expected, offset, err)
+		}
+
+		offset += int64(testCase.length)
+	}
+
+	m, err := d.Next()
+	if m != nil || !errors.Is(err, ErrInvalidMessageData) || err.(*DissectionError).Offset != offset {
+		t.Errorf("Expected %v at offset %d, but got %v, %v", ErrInvalidMessageData, offset, m, err)
+	}
+
+	if _, again := d.Next(); again != err {
+		t.Errorf("Expected the error to persist, but got %v", again)
+	}
+}
+
+// Test dumping a stream of messages.
+func TestDump(t *testing.T) {
+	stream := encodeTestingMessage(t, ExceptionOpcode, MessageId(3), "entangle", "BadMessage", "bad", nil)
+	stream = append(stream, compressTestingMessage(t, 4, encodeTestingMessage(t, ResponseOpcode, MessageId(4), map[string]interface{}{"b": []byte{1, 2}}, nil))...)
+
+	var out bytes.Buffer
+	if err := Dump(&out, bytes.NewReader(stream)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"offset 0, 28 bytes: exception, message ID 3\n",
+		"  name: \"BadMessage\"\n",
+		"  trace: nil\n",
+		"offset 28, 19 bytes: compressed message, message ID 4\n  compression method: Snappy\n",
+		"  decompressed:\n    offset 0, 11 bytes: response, message ID 4\n      result: {\"b\": 0x0102}\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected dump to contain %q, but got:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := Dump(&out, bytes.NewReader([]byte{0x92, 0x04, 0x01, 0x91})); !errors.Is(err, ErrInvalidMessageData) {
+		t.Errorf("Expected %v, but got %v", ErrInvalidMessageData, err)
+	}
+	if !strings.HasSuffix(out.String(), "error: invalid message data received at offset 3\n") {
+		t.Errorf("Unexpected dump:\n%s", out.String())
+	}
+}
@@ -12,4 +12,10 @@ var (
 
 	// Unknown exception.
 	UnknownExceptionError = NewExceptionDefinition("entangle", "UnknownException")
+
+	// Server overloaded.
+	OverloadedError = NewExceptionDefinition("entangle", "Overloaded")
+
+	// Rate limit exceeded.
+	RateLimitedError = NewExceptionDefinition("entangle", "RateLimited")
 )
@@ -0,0 +1,101 @@
+package entangletest
+
+import (
+	"context"
+	"github.com/entangle/goentangle"
+	"sync"
+)
+
+// Fake server.
+//
+// Server with programmable method responses and exceptions, recording the
+// calls it receives. Requests to methods without a response raise
+// goentangle.UnknownMethodError.
+type FakeServer struct {
+	// Dispatcher.
+	dispatcher *goentangle.Dispatcher
+
+	// Received calls.
+	calls []*goentangle.Call
+
+	// Lock.
+	lock sync.Mutex
+}
+
+// New fake server.
+func NewFakeServer() *FakeServer {
+	s := &FakeServer{
+		dispatcher: goentangle.NewDispatcher(),
+	}
+
+	s.dispatcher.Intercept(func(ctx context.Context, call *goentangle.Call, next goentangle.UnaryInvoker) (goentangle.Message, error) {
+		s.lock.Lock()
+		s.calls = append(s.calls, call)
+		s.lock.Unlock()
+
+		return next(ctx, call)
+	})
+
+	return s
+}
+
+// Respond to calls of a method with a result.
+func (s *FakeServer) Respond(method string, result interface{}) {
+	s.dispatcher.Handle(method, func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// Raise an exception for calls of a method.
+func (s *FakeServer) Raise(method string, exception goentangle.Exception) {
+	s.dispatcher.Handle(method, func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {
+		return nil, exception
+	})
+}
+
+// Handle calls of a method with a handler.
+func (s *FakeServer) Handle(method string, handler goentangle.MethodHandler) {
+	s.dispatcher.Handle(method, handler)
+}
+
+// Dispatcher.
+//
+// Interceptors and method descriptions can be added to the dispatcher.
+func (s *FakeServer) Dispatcher() *goentangle.Dispatcher {
+	return s.dispatcher
+}
+
+// Calls received so far, in the order they were received.
+func (s *FakeServer) Calls() []*goentangle.Call {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	calls := make([]*goentangle.Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// Serve a connection.
+//
+// Blocks until the connection is closed.
+func (s *FakeServer) ServeConn(conn *goentangle.Conn) {
+	goentangle.NewServer(s.dispatcher).ServeConn(conn)
+}
+
+// Connect a client.
+//
+// Serves the server end of a new pipe and returns a client connection handler
+// for the client end.
+func (s *FakeServer) Connect() *goentangle.ClientConnHandler {
+	return s.ConnectPipe(NewPipe())
+}
+
+// Connect a client over a pipe.
+//
+// Serves the server end of the pipe and returns a client connection handler
+// for the client end. Faults can be injected into the pipe.
+func (s *FakeServer) ConnectPipe(pipe *Pipe) *goentangle.ClientConnHandler {
+	client, server := pipe.Conns()
+	go s.ServeConn(server)
+	return goentangle.NewClientConnHandler(client)
+}
@@ -0,0 +1,85 @@
+package entangletest
+
+import (
+	"context"
+	"github.com/entangle/goentangle"
+	"testing"
+	"time"
+)
+
+var testingError = goentangle.NewExceptionDefinition("test", "Failure")
+
+// Test programmed responses and exceptions.
+func TestFakeServer(t *testing.T) {
+	server := NewFakeServer()
+	server.Respond("get", "value")
+	server.Raise("fail", testingError.New("failed"))
+	server.Handle("echo", func(ctx context.Context, call *goentangle.Call, trace goentangle.Trace) (interface{}, error) {
+		return call.Arguments, nil
+	})
+
+	client := server.Connect()
+	defer client.Close()
+
+	if resp, err := client.Call("get", []interface{}{"key"}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if result := resp.(*goentangle.ResponseMessage).Result; result != "value" {
+		t.Errorf("Expected value, but got %v", result)
+	}
+
+	if resp, err := client.Call("fail", []interface{}{}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if exc, ok := resp.(*goentangle.ExceptionMessage); !ok || !exc.Is(testingError) || exc.Description != "failed" {
+		t.Errorf("Expected failure exception, but got %v", resp)
+	}
+
+	if resp, err := client.Call("missing", []interface{}{}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if exc, ok := resp.(*goentangle.ExceptionMessage); !ok || !exc.Is(goentangle.UnknownMethodError) {
+		t.Errorf("Expected unknown method exception, but got %v", resp)
+	}
+
+	if resp, err := client.Call("echo", []interface{}{"a"}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if result, _ := resp.(*goentangle.ResponseMessage).Result.([]interface{}); len(result) != 1 || result[0] != "a" {
+		t.Errorf("Unexpected result: %v", resp)
+	}
+
+	calls := server.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("Expected 4 calls, but got %d", len(calls))
+	}
+	for i, method := range []string{"get", "fail", "missing", "echo"} {
+		if calls[i].Method != method {
+			t.Errorf("Expected call %d to be of %s, but got %s", i, method, calls[i].Method)
+		}
+	}
+	if len(calls[0].Arguments) != 1 || calls[0].Arguments[0] != "key" {
+		t.Errorf("Unexpected arguments: %v", calls[0].Arguments)
+	}
+}
+
+// Test calling a fake server over a pipe dropping requests.
+func TestFakeServerDroppedRequest(t *testing.T) {
+	server := NewFakeServer()
+	server.Respond("get", "value")
+
+	pipe := NewPipe()
+	pipe.InjectFaults(ClientToServer, Faults{
+		DropRate: 1,
+	})
+
+	client := server.ConnectPipe(pipe)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.CallContext(ctx, "get", []interface{}{}, false, false); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no calls, but got %v", calls)
+	}
+}
@@ -0,0 +1,261 @@
+package entangletest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/entangle/goentangle"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnexpectedCall = errors.New("unexpected call")
+)
+
+// Testing interface.
+//
+// Subset of testing.TB used to report failures.
+type TestingT interface {
+	// Mark the calling function as a helper.
+	Helper()
+
+	// Report a failure.
+	Errorf(format string, args ...interface{})
+}
+
+// Argument matcher.
+type ArgumentMatcher interface {
+	// Test if an argument matches.
+	Match(arg interface{}) bool
+
+	// Describe the matched arguments.
+	String() string
+}
+
+// Function argument matcher.
+type funcMatcher struct {
+	description string
+	match       func(arg interface{}) bool
+}
+
+func (m *funcMatcher) Match(arg interface{}) bool {
+	return m.match(arg)
+}
+
+func (m *funcMatcher) String() string {
+	return m.description
+}
+
+// Match any argument.
+func Any() ArgumentMatcher {
+	return &funcMatcher{"any", func(arg interface{}) bool {
+		return true
+	}}
+}
+
+// Match arguments equal to a value.
+//
+// The value and the argument are compared as transmitted, so that integers of
+// different widths, and structures and their serializations, can be equal.
+func Eq(value interface{}) ArgumentMatcher {
+	expected, expectedErr := goentangle.Normalize(value)
+
+	return &funcMatcher{fmt.Sprintf("%v", value), func(arg interface{}) bool {
+		actual, err := goentangle.Normalize(arg)
+		return expectedErr == nil && err == nil && reflect.DeepEqual(expected, actual)
+	}}
+}
+
+// Match arguments with a function.
+func MatchFunc(description string, match func(arg interface{}) bool) ArgumentMatcher {
+	return &funcMatcher{description, match}
+}
+
+// Expectation of calls to a mock client.
+type Expectation struct {
+	// Method.
+	method string
+
+	// Argument matchers.
+	matchers []ArgumentMatcher
+
+	// Result.
+	result interface{}
+
+	// Exception.
+	exception goentangle.Exception
+
+	// Number of expected calls. Negative for any number.
+	times int
+
+	// Number of calls.
+	calls int
+}
+
+// Return a result.
+//
+// The result is returned as transmitted, so generated clients can deserialize
+// it as they would deserialize a server's result.
+func (e *Expectation) Return(result interface{}) *Expectation {
+	e.result = result
+	return e
+}
+
+// Raise an exception.
+func (e *Expectation) Raise(exception goentangle.Exception) *Expectation {
+	e.exception = exception
+	return e
+}
+
+// Expect a number of calls.
+//
+// Expectations expect one call by default.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Expect any number of calls, including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// Test if a call matches the expectation.
+func (e *Expectation) matches(method string, args []interface{}) bool {
+	if method != e.method || len(args) != len(e.matchers) {
+		return false
+	}
+
+	for i, matcher := range e.matchers {
+		if !matcher.Match(args[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *Expectation) String() string {
+	matchers := make([]string, len(e.matchers))
+	for i, matcher := range e.matchers {
+		matchers[i] = matcher.String()
+	}
+
+	return e.method + "(" + strings.Join(matchers, ", ") + ")"
+}
+
+// Mock client.
+//
+// Implements goentangle.Caller, answering calls that match expectations with
+// their results or exceptions. Unexpected calls are reported as failures and
+// return ErrUnexpectedCall.
+type MockClient struct {
+	// Testing interface.
+	t TestingT
+
+	// Expectations.
+	expectations []*Expectation
+
+	// Lock.
+	lock sync.Mutex
+}
+
+// New mock client.
+func NewMockClient(t TestingT) *MockClient {
+	return &MockClient{
+		t: t,
+	}
+}
+
+// Expect a call.
+//
+// The call must have an argument for every matcher, each matching its
+// matcher. Calls are matched with the expectations in the order they were
+// declared, skipping those that have been called the expected number of times.
+// The expectation returns nil unless told otherwise.
+func (m *MockClient) Expect(method string, matchers ...ArgumentMatcher) *Expectation {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e := &Expectation{
+		method:   method,
+		matchers: matchers,
+		times:    1,
+	}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Verify that all expectations were met.
+//
+// Reports expectations called fewer times than expected as failures.
+func (m *MockClient) Verify() {
+	m.t.Helper()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, e := range m.expectations {
+		if e.times >= 0 && e.calls < e.times {
+			m.t.Errorf("Expected %d calls of %s, but got %d", e.times, e, e.calls)
+		}
+	}
+}
+
+// Call a remote function.
+func (m *MockClient) Call(method string, args []interface{}, notify bool, trace bool) (goentangle.Message, error) {
+	return m.CallContext(context.Background(), method, args, notify, trace)
+}
+
+// Call a remote function with a context.
+//
+// Returns the context's error if it is done. Notifications are acknowledged
+// unless the expectation raises an exception.
+func (m *MockClient) CallContext(ctx context.Context, method string, args []interface{}, notify bool, trace bool) (goentangle.Message, error) {
+	m.t.Helper()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	var expectation *Expectation
+	for _, e := range m.expectations {
+		if (e.times < 0 || e.calls < e.times) && e.matches(method, args) {
+			expectation = e
+			e.calls++
+			break
+		}
+	}
+	m.lock.Unlock()
+
+	if expectation == nil {
+		m.t.Errorf("Unexpected call of %s with arguments %v", method, args)
+		return nil, ErrUnexpectedCall
+	}
+
+	if expectation.exception != nil {
+		return &goentangle.ExceptionMessage{
+			Definition:  expectation.exception.Definition(),
+			Name:        expectation.exception.Name(),
+			Description: expectation.exception.Error(),
+		}, nil
+	}
+
+	if notify {
+		return &goentangle.NotificationAcknowledgementMessage{}, nil
+	}
+
+	result, err := goentangle.Normalize(expectation.result)
+	if err != nil {
+		m.t.Errorf("Invalid result for %s: %v", expectation, err)
+		return nil, err
+	}
+
+	return &goentangle.ResponseMessage{
+		Result: result,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package entangletest
+
+import (
+	"context"
+	"fmt"
+	"github.com/entangle/goentangle"
+	"testing"
+)
+
+// Testing interface recording failures.
+type recordingT struct {
+	failures []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+var _ goentangle.Caller = (*MockClient)(nil)
+var _ goentangle.Caller = (*goentangle.ClientConnHandler)(nil)
+
+// Test answering expected calls.
+func TestMockClient(t *testing.T) {
+	client := NewMockClient(t)
+	client.Expect("get", Eq(1)).Return([]int{1, 2})
+	client.Expect("get", Any()).Raise(testingError.New("missing")).Times(2)
+	client.Expect("notify", MatchFunc("string", func(arg interface{}) bool {
+		_, ok := arg.(string)
+		return ok
+	})).AnyTimes()
+
+	resp, err := client.Call("get", []interface{}{int64(1)}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	}
+	if result, _ := resp.(*goentangle.ResponseMessage).Result.([]interface{}); len(result) != 2 || result[0] != int64(1) {
+		t.Errorf("Expected transmitted result, but got %#v", resp.(*goentangle.ResponseMessage).Result)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = client.Call("get", []interface{}{int64(1)}, false, false)
+		if exc, ok := resp.(*goentangle.ExceptionMessage); err != nil || !ok || !exc.Is(testingError) || exc.Description != "missing" {
+			t.Errorf("Expected exception, but got %v, %v", resp, err)
+		}
+	}
+
+	if resp, err = client.Call("notify", []interface{}{"a"}, true, false); err != nil {
+		t.Errorf("Unexpected error notifying: %v", err)
+	} else if _, ok := resp.(*goentangle.NotificationAcknowledgementMessage); !ok {
+		t.Errorf("Expected notification acknowledgement, but got %v", resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = client.CallContext(ctx, "notify", []interface{}{"a"}, true, false); err != context.Canceled {
+		t.Errorf("Expected %v, but got %v", context.Canceled, err)
+	}
+
+	client.Verify()
+}
+
+// Test that unexpected and missing calls are reported.
+func TestMockClientFailures(t *testing.T) {
+	recorder := new(recordingT)
+	client := NewMockClient(recorder)
+	client.Expect("get", Eq("key")).Return("value")
+	client.Expect("set", Any(), Any())
+
+	if _, err := client.Call("get", []interface{}{"other"}, false, false); err != ErrUnexpectedCall {
+		t.Errorf("Expected %v, but got %v", ErrUnexpectedCall, err)
+	}
+
+	if _, err := client.Call("get", []interface{}{"key"}, false, false); err != nil {
+		t.Errorf("Unexpected error calling: %v", err)
+	}
+
+	if _, err := client.Call("get", []interface{}{"key"}, false, false); err != ErrUnexpectedCall {
+		t.Errorf("Expected %v for an exhausted expectation, but got %v", ErrUnexpectedCall, err)
+	}
+
+	client.Verify()
+
+	expected := []string{
+		"Unexpected call of get with arguments [other]",
+		"Unexpected call of get with arguments [key]",
+		"Expected 1 calls of set(any, any), but got 0",
+	}
+	if fmt.Sprint(recorder.failures) != fmt.Sprint(expected) {
+		t.Errorf("Expected failures %q, but got %q", expected, recorder.failures)
+	}
+}
@@ -0,0 +1,242 @@
+// Package entangletest provides utilities for testing code using goentangle:
+// connected in-memory connections with fault injection, and a fake server
+// with programmable method responses.
+package entangletest
+
+import (
+	"bytes"
+	"github.com/entangle/goentangle"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Pipe direction.
+type Direction uint8
+
+// Pipe directions.
+const (
+	// From the client end to the server end.
+	ClientToServer Direction = iota
+
+	// From the server end to the client end.
+	ServerToClient
+)
+
+// Faults.
+//
+// Faults injected into the data written in one direction of a pipe. Faults
+// apply to every write, which a connection makes for every message it sends
+// unless write coalescing is enabled.
+type Faults struct {
+	// Latency added to every write.
+	Latency time.Duration
+
+	// Probability of silently dropping a write.
+	DropRate float64
+
+	// Probability of corrupting a write by flipping the bits of a random
+	// byte.
+	CorruptRate float64
+
+	// Number of bytes after which the pipe disconnects. The write reaching the
+	// limit is cut off at the limit, so that the pipe can be disconnected in
+	// the middle of a message. Zero never disconnects.
+	DisconnectAfter int
+
+	// Random source. Nil uses the default source. Sources are not safe for
+	// concurrent use, so a source must not be shared between directions.
+	Rand *rand.Rand
+}
+
+// One direction of a pipe.
+type halfPipe struct {
+	// Buffered data.
+	buffer bytes.Buffer
+
+	// Closed.
+	closed bool
+
+	// Faults.
+	faults Faults
+
+	// Number of bytes written.
+	written int
+
+	// Lock.
+	lock sync.Mutex
+
+	// Condition signaled when data is written or the pipe is closed.
+	cond *sync.Cond
+}
+
+// New half pipe.
+func newHalfPipe() *halfPipe {
+	h := new(halfPipe)
+	h.cond = sync.NewCond(&h.lock)
+	return h
+}
+
+func (h *halfPipe) read(p []byte) (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for h.buffer.Len() == 0 && !h.closed {
+		h.cond.Wait()
+	}
+
+	if h.buffer.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	return h.buffer.Read(p)
+}
+
+// Write data, injecting faults.
+//
+// Returns whether the pipe must be disconnected after the write.
+func (h *halfPipe) write(p []byte) (n int, disconnect bool, err error) {
+	h.lock.Lock()
+	faults := h.faults
+	h.lock.Unlock()
+
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return 0, false, io.ErrClosedPipe
+	}
+
+	random := rand.Float64
+	intn := rand.Intn
+	if faults.Rand != nil {
+		random, intn = faults.Rand.Float64, faults.Rand.Intn
+	}
+
+	data := p
+	if faults.DisconnectAfter > 0 && h.written+len(data) >= faults.DisconnectAfter {
+		data, disconnect = data[:faults.DisconnectAfter-h.written], true
+	}
+	h.written += len(data)
+
+	if faults.DropRate > 0 && random() < faults.DropRate {
+		data = nil
+	} else if faults.CorruptRate > 0 && len(data) > 0 && random() < faults.CorruptRate {
+		data = append([]byte(nil), data...)
+		data[intn(len(data))] ^= 0xff
+	}
+
+	h.buffer.Write(data)
+	h.cond.Broadcast()
+
+	if disconnect && len(data) < len(p) {
+		return len(data), true, io.ErrClosedPipe
+	}
+
+	return len(p), disconnect, nil
+}
+
+func (h *halfPipe) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.closed = true
+	h.cond.Broadcast()
+}
+
+// Pipe.
+//
+// Connected, buffered in-memory byte streams between a client end and a
+// server end, with injectable faults. Closing either end disconnects the pipe:
+// both ends then read the remaining buffered data followed by io.EOF, and
+// writes fail with io.ErrClosedPipe.
+type Pipe struct {
+	// Client to server direction.
+	clientToServer *halfPipe
+
+	// Server to client direction.
+	serverToClient *halfPipe
+}
+
+// New pipe.
+func NewPipe() *Pipe {
+	return &Pipe{
+		clientToServer: newHalfPipe(),
+		serverToClient: newHalfPipe(),
+	}
+}
+
+// Client end.
+func (p *Pipe) Client() io.ReadWriteCloser {
+	return &pipeEnd{p, p.serverToClient, p.clientToServer}
+}
+
+// Server end.
+func (p *Pipe) Server() io.ReadWriteCloser {
+	return &pipeEnd{p, p.clientToServer, p.serverToClient}
+}
+
+// Inject faults into a direction.
+//
+// Replaces any faults previously injected into the direction. The number of
+// bytes after which the pipe disconnects counts from the injection.
+func (p *Pipe) InjectFaults(direction Direction, faults Faults) {
+	h := p.clientToServer
+	if direction == ServerToClient {
+		h = p.serverToClient
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.faults = faults
+	h.written = 0
+}
+
+// Disconnect the pipe.
+func (p *Pipe) Disconnect() {
+	p.clientToServer.close()
+	p.serverToClient.close()
+}
+
+// New connections over the pipe.
+func (p *Pipe) Conns() (client, server *goentangle.Conn) {
+	return goentangle.NewConn(p.Client(), "entangletest client"), goentangle.NewConn(p.Server(), "entangletest server")
+}
+
+// Pipe end.
+type pipeEnd struct {
+	// Pipe.
+	pipe *Pipe
+
+	// Direction read from.
+	reader *halfPipe
+
+	// Direction written to.
+	writer *halfPipe
+}
+
+func (e *pipeEnd) Read(p []byte) (int, error) {
+	return e.reader.read(p)
+}
+
+func (e *pipeEnd) Write(p []byte) (int, error) {
+	n, disconnect, err := e.writer.write(p)
+	if disconnect {
+		e.pipe.Disconnect()
+	}
+	return n, err
+}
+
+func (e *pipeEnd) Close() error {
+	e.pipe.Disconnect()
+	return nil
+}
+
+// New pair of connected connections.
+func NewConnPair() (client, server *goentangle.Conn) {
+	return NewPipe().Conns()
+}
@@ -0,0 +1,128 @@
+package entangletest
+
+import (
+	"bytes"
+	"github.com/entangle/goentangle"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Test sending messages between a connection pair.
+func TestNewConnPair(t *testing.T) {
+	client, server := NewConnPair()
+	defer client.Close()
+
+	if _, err := client.SendRequest("echo", []interface{}{"a"}, false); err != nil {
+		t.Fatalf("Unexpected error sending: %v", err)
+	}
+
+	msg, err := server.Receive()
+	if err != nil {
+		t.Fatalf("Unexpected error receiving: %v", err)
+	}
+
+	if req, ok := msg.(*goentangle.RequestMessage); !ok || req.Method != "echo" {
+		t.Errorf("Unexpected message: %v", msg)
+	}
+
+	client.Close()
+	if _, err = server.Receive(); err != io.EOF {
+		t.Errorf("Expected EOF after closing, but got %v", err)
+	}
+}
+
+// Test that reads return buffered data before the end of the stream.
+func TestPipeDisconnect(t *testing.T) {
+	pipe := NewPipe()
+	client, server := pipe.Client(), pipe.Server()
+
+	if _, err := client.Write([]byte("abc")); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+	pipe.Disconnect()
+
+	if data, err := io.ReadAll(server); err != nil || string(data) != "abc" {
+		t.Errorf("Expected to read abc, but got %q, %v", data, err)
+	}
+
+	if _, err := server.Write([]byte("d")); err != io.ErrClosedPipe {
+		t.Errorf("Expected %v writing, but got %v", io.ErrClosedPipe, err)
+	}
+}
+
+// Test injecting latency.
+func TestFaultsLatency(t *testing.T) {
+	pipe := NewPipe()
+	pipe.InjectFaults(ServerToClient, Faults{
+		Latency: 20 * time.Millisecond,
+	})
+
+	start := time.Now()
+	if _, err := pipe.Server().Write([]byte("a")); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected write to take at least 20ms, but took %v", elapsed)
+	}
+}
+
+// Test injecting dropped and corrupted writes.
+func TestFaultsDropCorrupt(t *testing.T) {
+	pipe := NewPipe()
+	client, server := pipe.Client(), pipe.Server()
+
+	pipe.InjectFaults(ClientToServer, Faults{
+		DropRate: 1,
+	})
+	if n, err := client.Write([]byte("dropped")); n != 7 || err != nil {
+		t.Errorf("Expected dropped write to succeed, but got %d, %v", n, err)
+	}
+
+	pipe.InjectFaults(ClientToServer, Faults{
+		CorruptRate: 1,
+		Rand:        rand.New(rand.NewSource(1)),
+	})
+	data := []byte("corrupted")
+	if _, err := client.Write(data); err != nil {
+		t.Fatalf("Unexpected error writing: %v", err)
+	}
+	if string(data) != "corrupted" {
+		t.Errorf("Expected written data to be left intact, but got %q", data)
+	}
+
+	pipe.Disconnect()
+	received, _ := io.ReadAll(server)
+	if len(received) != len(data) || bytes.Equal(received, data) {
+		t.Fatalf("Expected corrupted data, but got %q", received)
+	}
+
+	differences := 0
+	for i := range data {
+		if received[i] != data[i] {
+			differences++
+		}
+	}
+	if differences != 1 {
+		t.Errorf("Expected one corrupted byte, but got %d", differences)
+	}
+}
+
+// Test disconnecting in the middle of a message.
+func TestFaultsDisconnectAfter(t *testing.T) {
+	pipe := NewPipe()
+	pipe.InjectFaults(ClientToServer, Faults{
+		DisconnectAfter: 5,
+	})
+	client, server := pipe.Conns()
+
+	if _, err := client.SendRequest("method", []interface{}{}, false); err == nil {
+		t.Errorf("Expected error sending across the disconnection")
+	}
+
+	if _, err := server.Receive(); err != goentangle.ErrInvalidMessageData {
+		t.Errorf("Expected %v receiving a partial message, but got %v", goentangle.ErrInvalidMessageData, err)
+	}
+}
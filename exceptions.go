@@ -2,6 +2,7 @@ package goentangle
 
 import (
 	"fmt"
+	"time"
 )
 
 // Entangle exception.
@@ -15,6 +16,37 @@ type Exception interface {
 	Name() string
 }
 
+// Entangle exception with a retry-after hint.
+//
+// Raised exceptions carry their hint in the exception message, and exceptions
+// of received exception messages with a hint implement RetryAfterException.
+type RetryAfterException interface {
+	Exception
+
+	// Time after which the failed call may be retried.
+	RetryAfter() time.Duration
+}
+
+// Add a retry-after hint to an exception.
+func WithRetryAfter(exception Exception, retryAfter time.Duration) RetryAfterException {
+	return &retryAfterException{
+		Exception:  exception,
+		retryAfter: retryAfter,
+	}
+}
+
+// Entangle exception with a retry-after hint implementation.
+type retryAfterException struct {
+	Exception
+
+	// Retry-after hint.
+	retryAfter time.Duration
+}
+
+func (e *retryAfterException) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
 // Entangle exception definition.
 //
 // Exception definition that can produce an exception of a specific type.
@@ -28,6 +60,34 @@ type ExceptionDefinition interface {
 	Newf(format string, a ...interface{}) Exception
 }
 
+// Named exception definition.
+//
+// Exception definition that provides the definition and exception names of its
+// exceptions without producing one. Implemented by the definitions of
+// NewExceptionDefinition.
+type NamedExceptionDefinition interface {
+	ExceptionDefinition
+
+	// Definition.
+	Definition() string
+
+	// Name.
+	Name() string
+}
+
+// Get the definition and exception names of an exception definition.
+//
+// The names of definitions not implementing NamedExceptionDefinition are taken
+// from an exception produced by the definition.
+func ExceptionDefinitionNames(definition ExceptionDefinition) (definitionName, name string) {
+	if named, ok := definition.(NamedExceptionDefinition); ok {
+		return named.Definition(), named.Name()
+	}
+
+	exc := definition.New("")
+	return exc.Definition(), exc.Name()
+}
+
 // Entangle exception implementation.
 type entangleException struct {
 	definition  string
@@ -53,6 +113,14 @@ type entangleExceptionDefinition struct {
 	name       string
 }
 
+func (d *entangleExceptionDefinition) Definition() string {
+	return d.definition
+}
+
+func (d *entangleExceptionDefinition) Name() string {
+	return d.name
+}
+
 func (d *entangleExceptionDefinition) New(description string) Exception {
 	return &entangleException{
 		d.definition,
@@ -8,6 +8,12 @@ func TestExceptionDefinition(t *testing.T) {
 	// Make a definition.
 	def := NewExceptionDefinition("test", "NameException")
 
+	if definitionName, name := ExceptionDefinitionNames(def); definitionName != "test" {
+		t.Errorf("invalid definition: %s", definitionName)
+	} else if name != "NameException" {
+		t.Errorf("invalid name: %s", name)
+	}
+
 	// Make an exception.
 	var err Exception = def.New("Description")
 	if err.Definition() != "test" {
@@ -28,3 +34,25 @@ func TestExceptionDefinition(t *testing.T) {
 		t.Errorf("invalid exception message: %s", err.Error())
 	}
 }
+
+// Exception definition only implementing ExceptionDefinition.
+type testingExceptionDefinition struct{}
+
+func (testingExceptionDefinition) New(description string) Exception {
+	return NewExceptionDefinition("custom", "CustomException").New(description)
+}
+
+func (d testingExceptionDefinition) Newf(format string, a ...interface{}) Exception {
+	return d.New(format)
+}
+
+func TestExceptionDefinitionNames(t *testing.T) {
+	if definitionName, name := ExceptionDefinitionNames(testingExceptionDefinition{}); definitionName != "custom" || name != "CustomException" {
+		t.Errorf("invalid names: %s.%s", definitionName, name)
+	}
+
+	msg := &ExceptionMessage{Definition: "custom", Name: "CustomException"}
+	if !msg.Is(testingExceptionDefinition{}) {
+		t.Errorf("Expected exception message to be produced from the custom definition")
+	}
+}
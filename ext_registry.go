@@ -0,0 +1,130 @@
+package goentangle
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"reflect"
+	"sync"
+)
+
+var ErrExtTypeRegistrationClosed = errors.New("extension type registration is closed")
+
+// Lowest extension type ID available to applications.
+//
+// Lower IDs are reserved for Entangle's own extension types.
+const MinApplicationExtType int8 = 16
+
+// Extension type encoder.
+//
+// Encodes a value of the registered type into an extension payload.
+type ExtEncoder func(value interface{}) ([]byte, error)
+
+// Extension type decoder.
+//
+// Decodes an extension payload into a value of the registered type.
+type ExtDecoder func(payload []byte) (interface{}, error)
+
+// Registered application extension type.
+type applicationExtType struct {
+	// Type of values.
+	valueType reflect.Type
+
+	// Payload decoder.
+	decoder ExtDecoder
+}
+
+var (
+	// Lock protecting the registered application extension types.
+	applicationExtTypesLock sync.RWMutex
+
+	// Registered application extension types by ID.
+	applicationExtTypes = make(map[int8]applicationExtType)
+
+	// Whether registration is closed because a connection has been created.
+	applicationExtTypesClosed bool
+)
+
+// Register an extension type.
+//
+// Values of the type of the given value, and pointers to it, are transmitted
+// as the extension type with the given ID on all connections, the payload
+// being produced by the encoder. Received values of the extension type are
+// decoded by the decoder, so that they appear in message arguments and results
+// as values of the registered type.
+//
+// Encoders are registered with msgpack, which does not synchronize its
+// registrations with encoding. Extension types must therefore be registered
+// before the first connection is created, after which registration fails with
+// ErrExtTypeRegistrationClosed. Returns an error if the ID is outside the range
+// available to applications or is already registered.
+func RegisterExtType(id int8, value interface{}, encoder ExtEncoder, decoder ExtDecoder) error {
+	if id < MinApplicationExtType {
+		return fmt.Errorf("extension type ID %d is reserved", id)
+	}
+
+	applicationExtTypesLock.Lock()
+	defer applicationExtTypesLock.Unlock()
+
+	if applicationExtTypesClosed {
+		return ErrExtTypeRegistrationClosed
+	}
+
+	if registered, ok := applicationExtTypes[id]; ok {
+		return fmt.Errorf("extension type ID %d is already registered for %s", id, registered.valueType)
+	}
+
+	valueType := reflect.TypeOf(value)
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	applicationExtTypes[id] = applicationExtType{
+		valueType: valueType,
+		decoder:   decoder,
+	}
+
+	msgpack.Register(valueType, func(e *msgpack.Encoder, v reflect.Value) error {
+		payload, err := encoder(v.Interface())
+		if err != nil {
+			return err
+		}
+
+		return encodeExt(e, id, payload)
+	}, nil)
+
+	return nil
+}
+
+// Close registration of extension types.
+//
+// Called when a connection is created, after which the msgpack registrations
+// are read concurrently.
+func closeExtTypeRegistration() {
+	applicationExtTypesLock.Lock()
+	applicationExtTypesClosed = true
+	applicationExtTypesLock.Unlock()
+}
+
+// Decode the payload of an application extension type.
+//
+// Returns ErrInvalidMessageData if the extension type is not registered.
+func decodeApplicationExt(id int8, payload []byte) (interface{}, error) {
+	applicationExtTypesLock.RLock()
+	extType, ok := applicationExtTypes[id]
+	applicationExtTypesLock.RUnlock()
+
+	if !ok {
+		return nil, ErrInvalidMessageData
+	}
+
+	decoded, err := extType.decoder(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if reflect.TypeOf(decoded) != extType.valueType {
+		return nil, fmt.Errorf("extension type %d decoded into %T instead of %s", id, decoded, extType.valueType)
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,120 @@
+package goentangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"math"
+	"testing"
+)
+
+type testingGeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+const testingGeoPointExtType int8 = 100
+
+func init() {
+	err := RegisterExtType(testingGeoPointExtType, testingGeoPoint{}, func(value interface{}) ([]byte, error) {
+		point := value.(testingGeoPoint)
+		payload := make([]byte, 16)
+		binary.BigEndian.PutUint64(payload, math.Float64bits(point.Latitude))
+		binary.BigEndian.PutUint64(payload[8:], math.Float64bits(point.Longitude))
+		return payload, nil
+	}, func(payload []byte) (interface{}, error) {
+		if len(payload) != 16 {
+			return nil, errors.New("invalid geo point")
+		}
+		return testingGeoPoint{
+			Latitude:  math.Float64frombits(binary.BigEndian.Uint64(payload)),
+			Longitude: math.Float64frombits(binary.BigEndian.Uint64(payload[8:])),
+		}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterExtType(t *testing.T) {
+	expected := testingGeoPoint{55.68, 12.57}
+
+	// Generic values.
+	for _, value := range []interface{}{expected, &expected} {
+		if actual := roundTripExtValue(t, value); actual != expected {
+			t.Errorf("Expected decoded value to be %v, but it is %#v", expected, actual)
+		}
+	}
+
+	// Typed values.
+	data, err := msgpack.Marshal([]interface{}{&expected})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding: %v", err)
+	}
+
+	decoded, err := decodeRawValue(data)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding: %v", err)
+	}
+
+	var actual []testingGeoPoint
+	if err = DeserializeInto(decoded, &actual); err != nil || len(actual) != 1 || actual[0] != expected {
+		t.Errorf("Expected decoded value to be [%v], but got %v, %v", expected, actual, err)
+	}
+
+	var actualPtr []*testingGeoPoint
+	if err = DeserializeInto(decoded, &actualPtr); err != nil || len(actualPtr) != 1 || actualPtr[0] == nil || *actualPtr[0] != expected {
+		t.Errorf("Expected decoded value to be [%v], but got %v, %v", expected, actualPtr, err)
+	}
+
+	// The payload is written as is.
+	if data, err = msgpack.Marshal(testingGeoPoint{}); err != nil || !bytes.Equal(data[:2], []byte{0xd8, byte(testingGeoPointExtType)}) || len(data) != 18 {
+		t.Errorf("Expected geo point to be encoded as a 16 byte extension, but got %x, %v", data, err)
+	}
+
+	// Invalid payload.
+	if _, err = decodeRawValue([]byte{0xd4, byte(testingGeoPointExtType), 0}); err == nil {
+		t.Errorf("Expected error decoding invalid payload")
+	}
+
+	// Unregistered extension type.
+	if _, err = decodeRawValue([]byte{0xd4, byte(testingGeoPointExtType + 1), 0}); err != ErrInvalidMessageData {
+		t.Errorf("Expected '%v' decoding unregistered extension type, but got '%v'", ErrInvalidMessageData, err)
+	}
+}
+
+func TestRegisterExtTypeCall(t *testing.T) {
+	client, clientConn, _ := newTestingClientServer(newTestingEchoDispatcher())
+	defer clientConn.Close()
+
+	expected := testingGeoPoint{-33.87, 151.21}
+
+	resp, err := client.Call("echo", []interface{}{expected}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	}
+
+	var result []testingGeoPoint
+	if err = resp.(*ResponseMessage).DecodeResult(&result); err != nil {
+		t.Errorf("Unexpected error decoding result: %v", err)
+	} else if len(result) != 1 || result[0] != expected {
+		t.Errorf("Expected result [%v], but got %v", expected, result)
+	}
+}
+
+func TestRegisterExtTypeErrors(t *testing.T) {
+	for _, id := range []int8{-1, BigIntExtType, testingGeoPointExtType} {
+		if err := RegisterExtType(id, struct{}{}, nil, nil); err == nil {
+			t.Errorf("Expected error registering extension type ID %d", id)
+		}
+	}
+
+	// Registration after a connection is created.
+	clientConn, _ := newTestingConnPipe()
+	defer clientConn.Close()
+
+	if err := RegisterExtType(testingGeoPointExtType+1, struct{}{}, nil, nil); err != ErrExtTypeRegistrationClosed {
+		t.Errorf("Expected '%v' registering extension type after creating a connection, but got '%v'", ErrExtTypeRegistrationClosed, err)
+	}
+}
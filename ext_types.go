@@ -0,0 +1,471 @@
+package goentangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Extension types.
+//
+// Entangle values without a native msgpack representation are transmitted as
+// msgpack extension types. The extension type IDs and payloads below are part
+// of the Entangle wire format, and IDs 0 through 15 are reserved for it. IDs
+// from MinApplicationExtType are available to applications.
+const (
+	// Time.
+	//
+	// The msgpack timestamp extension type: 32-bit unsigned seconds since the
+	// Unix epoch; 30-bit nanoseconds and 34-bit unsigned seconds packed into
+	// 64 bits; or 32-bit unsigned nanoseconds followed by 64-bit signed
+	// seconds, all big-endian.
+	TimeExtType int8 = -1
+
+	// Duration.
+	//
+	// Payload: nanoseconds as a msgpack integer.
+	DurationExtType int8 = 2
+
+	// Arbitrary-precision integer.
+	//
+	// Payload: a msgpack boolean that is true for negative integers, followed
+	// by the big-endian magnitude as msgpack binary data.
+	BigIntExtType int8 = 3
+
+	// Arbitrary-precision decimal.
+	//
+	// Payload: the scale as a msgpack integer of at most maxDecimalScale in
+	// magnitude, followed by the unscaled value encoded as for
+	// arbitrary-precision integers.
+	DecimalExtType int8 = 4
+)
+
+// Largest magnitude of the scale of received decimals.
+//
+// Formatting a decimal computes a power of ten of the scale's magnitude, which
+// must not be left to peers.
+const maxDecimalScale = 1 << 12
+
+var (
+	ErrInvalidDecimal = errors.New("invalid decimal")
+)
+
+// Decoders of Entangle's extension types by ID.
+var extTypeDecoders = map[int8]ExtDecoder{
+	TimeExtType:     decodeExtTime,
+	DurationExtType: decodeExtDuration,
+	BigIntExtType:   decodeExtBigInt,
+	DecimalExtType:  decodeExtDecimal,
+}
+
+// Decimal.
+//
+// Arbitrary-precision decimal with the value Unscaled × 10^-Scale.
+type Decimal struct {
+	// Unscaled value. Nil is zero.
+	Unscaled *big.Int
+
+	// Scale.
+	Scale int32
+}
+
+// Parse a decimal.
+//
+// Parses decimals of the form [+-]digits[.digits]. The scale is the number of
+// fractional digits. Returns ErrInvalidDecimal if parsing failed.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := s
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+
+	integral, fractional := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		// The decimal point must be followed by digits.
+		if integral, fractional = digits[:i], digits[i+1:]; fractional == "" {
+			return Decimal{}, ErrInvalidDecimal
+		}
+	}
+
+	if integral == "" || strings.Trim(integral+fractional, "0123456789") != "" {
+		return Decimal{}, ErrInvalidDecimal
+	}
+
+	unscaled, ok := new(big.Int).SetString(s[:len(s)-len(digits)]+integral+fractional, 10)
+	if !ok {
+		return Decimal{}, ErrInvalidDecimal
+	}
+
+	return Decimal{
+		Unscaled: unscaled,
+		Scale:    int32(len(fractional)),
+	}, nil
+}
+
+func (d Decimal) String() string {
+	unscaled := d.Unscaled
+	if unscaled == nil {
+		unscaled = new(big.Int)
+	}
+
+	if d.Scale <= 0 {
+		return new(big.Int).Mul(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-d.Scale)), nil)).String()
+	}
+
+	digits := new(big.Int).Abs(unscaled).String()
+	if pad := int(d.Scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+
+	point := len(digits) - int(d.Scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Encode an extension value with its payload.
+func encodeExt(e *msgpack.Encoder, id int8, payload []byte) error {
+	var header [6]byte
+	var h []byte
+
+	switch n := len(payload); {
+	case n == 1 || n == 2 || n == 4 || n == 8 || n == 16:
+		// Fixed extensions of 1, 2, 4, 8 and 16 bytes.
+		code := byte(0xd4)
+		for ; n > 1; n >>= 1 {
+			code++
+		}
+		h = append(header[:0], code, byte(id))
+
+	case n < 1<<8:
+		h = append(header[:0], 0xc7, byte(n), byte(id))
+
+	case n < 1<<16:
+		h = append(binary.BigEndian.AppendUint16(append(header[:0], 0xc8), uint16(n)), byte(id))
+
+	default:
+		h = append(binary.BigEndian.AppendUint32(append(header[:0], 0xc9), uint32(n)), byte(id))
+	}
+
+	if _, err := e.Writer().Write(h); err != nil {
+		return err
+	}
+
+	_, err := e.Writer().Write(payload)
+	return err
+}
+
+// Encode an extension value with a payload of msgpack values.
+func encodeExtValues(e *msgpack.Encoder, id int8, values ...interface{}) error {
+	payload, err := msgpack.Marshal(values...)
+	if err != nil {
+		return err
+	}
+
+	return encodeExt(e, id, payload)
+}
+
+// Time extension value.
+type extTime struct {
+	time time.Time
+}
+
+func (v extTime) EncodeMsgpack(e *msgpack.Encoder) error {
+	seconds, nanoseconds := v.time.Unix(), uint32(v.time.Nanosecond())
+
+	// Use the smallest timestamp format that can hold the time.
+	if seconds>>34 == 0 {
+		packed := uint64(nanoseconds)<<34 | uint64(seconds)
+		if packed>>32 == 0 {
+			return encodeExt(e, TimeExtType, binary.BigEndian.AppendUint32(nil, uint32(packed)))
+		}
+		return encodeExt(e, TimeExtType, binary.BigEndian.AppendUint64(nil, packed))
+	}
+
+	payload := binary.BigEndian.AppendUint32(make([]byte, 0, 12), nanoseconds)
+	return encodeExt(e, TimeExtType, binary.BigEndian.AppendUint64(payload, uint64(seconds)))
+}
+
+// Decode a time extension payload.
+func decodeExtTime(payload []byte) (interface{}, error) {
+	var seconds int64
+	var nanoseconds uint32
+
+	switch len(payload) {
+	case 4:
+		seconds = int64(binary.BigEndian.Uint32(payload))
+
+	case 8:
+		packed := binary.BigEndian.Uint64(payload)
+		seconds, nanoseconds = int64(packed&(1<<34-1)), uint32(packed>>34)
+
+	case 12:
+		nanoseconds = binary.BigEndian.Uint32(payload)
+		seconds = int64(binary.BigEndian.Uint64(payload[4:]))
+
+	default:
+		return nil, ErrDeserializationError
+	}
+
+	if nanoseconds >= nanosecondDivisor {
+		return nil, ErrDeserializationError
+	}
+
+	return extTime{time.Unix(seconds, int64(nanoseconds)).UTC()}, nil
+}
+
+// Duration extension value.
+type extDuration time.Duration
+
+func (v extDuration) EncodeMsgpack(e *msgpack.Encoder) error {
+	return encodeExtValues(e, DurationExtType, int64(v))
+}
+
+// Decode a duration extension payload.
+func decodeExtDuration(payload []byte) (interface{}, error) {
+	nanoseconds, err := msgpack.NewDecoder(bytes.NewReader(payload)).DecodeInt64()
+	if err != nil {
+		return nil, err
+	}
+
+	return extDuration(nanoseconds), nil
+}
+
+// Decode an arbitrary-precision integer from an extension payload.
+func decodeBigInt(d *msgpack.Decoder) (*big.Int, error) {
+	negative, err := d.DecodeBool()
+	if err != nil {
+		return nil, err
+	}
+
+	magnitude, err := d.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	i := new(big.Int).SetBytes(magnitude)
+	if negative {
+		i.Neg(i)
+	}
+
+	return i, nil
+}
+
+// Arbitrary-precision integer extension value.
+type extBigInt struct {
+	int *big.Int
+}
+
+func (v extBigInt) EncodeMsgpack(e *msgpack.Encoder) error {
+	i := v.int
+	if i == nil {
+		i = new(big.Int)
+	}
+
+	return encodeExtValues(e, BigIntExtType, i.Sign() < 0, i.Bytes())
+}
+
+// Decode an arbitrary-precision integer extension payload.
+func decodeExtBigInt(payload []byte) (interface{}, error) {
+	i, err := decodeBigInt(msgpack.NewDecoder(bytes.NewReader(payload)))
+	if err != nil {
+		return nil, err
+	}
+
+	return extBigInt{i}, nil
+}
+
+// Decimal extension value.
+type extDecimal struct {
+	decimal Decimal
+}
+
+func (v extDecimal) EncodeMsgpack(e *msgpack.Encoder) error {
+	i := v.decimal.Unscaled
+	if i == nil {
+		i = new(big.Int)
+	}
+
+	return encodeExtValues(e, DecimalExtType, v.decimal.Scale, i.Sign() < 0, i.Bytes())
+}
+
+// Decode a decimal extension payload.
+//
+// Decimals with a scale of more than maxDecimalScale in magnitude are
+// rejected.
+func decodeExtDecimal(payload []byte) (interface{}, error) {
+	d := msgpack.NewDecoder(bytes.NewReader(payload))
+
+	// Decode the scale as a 64 bit integer, as narrower decoding truncates
+	// scales out of range.
+	scale, err := d.DecodeInt64()
+	if err != nil {
+		return nil, err
+	} else if scale > maxDecimalScale || scale < -maxDecimalScale {
+		return nil, ErrInvalidDecimal
+	}
+
+	unscaled, err := decodeBigInt(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return extDecimal{Decimal{unscaled, int32(scale)}}, nil
+}
+
+// Serialize a time.
+func SerializeTime(t time.Time) interface{} {
+	return extTime{t}
+}
+
+// Serialize a duration.
+func SerializeDuration(d time.Duration) interface{} {
+	return extDuration(d)
+}
+
+// Serialize an arbitrary-precision integer.
+func SerializeBigInt(i *big.Int) interface{} {
+	return extBigInt{i}
+}
+
+// Serialize a decimal.
+func SerializeDecimal(d Decimal) interface{} {
+	return extDecimal{d}
+}
+
+// Deserialize a time.
+//
+// Besides the time extension type, integer nanoseconds since the Unix epoch
+// and [seconds, nanoseconds] arrays are accepted.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeTime(input interface{}) (time.Time, error) {
+	switch v := input.(type) {
+	case extTime:
+		return v.time, nil
+
+	case []interface{}:
+		if len(v) != 2 {
+			return time.Time{}, newDeserializationError(timeType, input)
+		}
+
+		seconds, err := DeserializeInt64(v[0])
+		if err != nil {
+			return time.Time{}, newDeserializationError(timeType, input)
+		}
+
+		nanoseconds, err := DeserializeInt64(v[1])
+		if err != nil {
+			return time.Time{}, newDeserializationError(timeType, input)
+		}
+
+		return time.Unix(seconds, nanoseconds).UTC(), nil
+	}
+
+	nanoseconds, err := DeserializeInt64(input)
+	if err != nil {
+		return time.Time{}, newDeserializationError(timeType, input)
+	}
+
+	return time.Unix(nanoseconds/nanosecondDivisor, nanoseconds%nanosecondDivisor).UTC(), nil
+}
+
+// Deserialize a duration.
+//
+// Besides the duration extension type, integer nanoseconds are accepted.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeDuration(input interface{}) (time.Duration, error) {
+	if d, ok := input.(extDuration); ok {
+		return time.Duration(d), nil
+	}
+
+	nanoseconds, err := DeserializeInt64(input)
+	if err != nil {
+		return 0, newDeserializationError(durationType, input)
+	}
+
+	return time.Duration(nanoseconds), nil
+}
+
+// Deserialize an arbitrary-precision integer.
+//
+// Besides the arbitrary-precision integer extension type, integers are
+// accepted.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeBigInt(input interface{}) (*big.Int, error) {
+	switch v := input.(type) {
+	case extBigInt:
+		if v.int != nil {
+			return v.int, nil
+		}
+		return new(big.Int), nil
+
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	}
+
+	i, err := DeserializeInt64(input)
+	if err != nil {
+		return nil, newDeserializationError(bigIntType, input)
+	}
+
+	return big.NewInt(i), nil
+}
+
+// Deserialize a decimal.
+//
+// Besides the decimal extension type, integers and arbitrary-precision
+// integers are accepted with a scale of zero.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeDecimal(input interface{}) (Decimal, error) {
+	if d, ok := input.(extDecimal); ok {
+		if d.decimal.Unscaled == nil {
+			d.decimal.Unscaled = new(big.Int)
+		}
+		return d.decimal, nil
+	}
+
+	i, err := DeserializeBigInt(input)
+	if err != nil {
+		return Decimal{}, newDeserializationError(decimalType, input)
+	}
+
+	return Decimal{
+		Unscaled: i,
+	}, nil
+}
+
+// Format an extension value.
+//
+// Formats the values of Entangle's extension types as received, giving the
+// name of the type, such as "time" or "decimal", and the formatted value.
+// Returns false for other values.
+func FormatExtValue(value interface{}) (typeName, formatted string, ok bool) {
+	switch v := value.(type) {
+	case extTime:
+		return "time", v.time.Format(time.RFC3339Nano), true
+
+	case extDuration:
+		return "duration", time.Duration(v).String(), true
+
+	case extBigInt:
+		i, _ := DeserializeBigInt(v)
+		return "big integer", i.String(), true
+
+	case extDecimal:
+		d, _ := DeserializeDecimal(v)
+		return "decimal", d.String(), true
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,297 @@
+package goentangle
+
+import (
+	"bytes"
+	"errors"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func roundTripExtValue(t *testing.T, value interface{}) interface{} {
+	data, err := msgpack.Marshal([]interface{}{value})
+	if err != nil {
+		t.Fatalf("Unexpected error encoding %v: %v", value, err)
+	}
+
+	decoded, err := decodeRawValue(data)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding %v: %v", value, err)
+	}
+
+	return decoded.([]interface{})[0]
+}
+
+func TestTimeExtType(t *testing.T) {
+	for _, expected := range []time.Time{
+		time.Unix(0, 0).UTC(),
+		time.Unix(1400000000, 123456789).UTC(),
+		time.Unix(-62135596800, 1).UTC(),
+		time.Unix(1<<34, 999999999).UTC(),
+		time.Unix(-1, 0).UTC(),
+	} {
+		actual, err := DeserializeTime(roundTripExtValue(t, SerializeTime(expected)))
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", expected, err)
+		} else if !actual.Equal(expected) {
+			t.Errorf("Expected deserialized value to be %v, but it is %v", expected, actual)
+		}
+	}
+
+	// Timestamp formats.
+	for _, testCase := range []struct {
+		Time    time.Time
+		Encoded []byte
+	}{
+		{time.Unix(1, 0), []byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x01}},
+		{time.Unix(1, 1), []byte{0xd7, 0xff, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01}},
+		{time.Unix(-1, 1), []byte{0xc7, 0x0c, 0xff, 0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		if encoded, err := msgpack.Marshal(SerializeTime(testCase.Time)); err != nil || !bytes.Equal(encoded, testCase.Encoded) {
+			t.Errorf("Expected %v to encode as %x, but got %x, %v", testCase.Time, testCase.Encoded, encoded, err)
+		}
+	}
+
+	// Nanoseconds out of range.
+	if _, err := decodeRawValue([]byte{0xd7, 0xff, 0xff, 0xff, 0xff, 0xfc, 0x00, 0x00, 0x00, 0x00}); err == nil {
+		t.Errorf("Expected error decoding a timestamp with nanoseconds out of range")
+	}
+
+	// Legacy representations.
+	for _, input := range []interface{}{
+		int64(1400000000123456789),
+		[]interface{}{int64(1400000000), int64(123456789)},
+	} {
+		if actual, err := DeserializeTime(input); err != nil || !actual.Equal(time.Unix(1400000000, 123456789)) {
+			t.Errorf("Unexpected deserialized time from %v: %v, %v", input, actual, err)
+		}
+	}
+
+	// Invalid.
+	for _, input := range []interface{}{nil, "time", []interface{}{int64(1)}, SerializeDuration(time.Second)} {
+		if _, err := DeserializeTime(input); !errors.Is(err, ErrDeserializationError) {
+			t.Errorf("Expected '%v' deserializing %v, but got '%v'", ErrDeserializationError, input, err)
+		}
+	}
+}
+
+func TestDurationExtType(t *testing.T) {
+	for _, expected := range []time.Duration{0, time.Nanosecond, -time.Hour, 1<<63 - 1} {
+		actual, err := DeserializeDuration(roundTripExtValue(t, SerializeDuration(expected)))
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", expected, err)
+		} else if actual != expected {
+			t.Errorf("Expected deserialized value to be %v, but it is %v", expected, actual)
+		}
+	}
+
+	if actual, err := DeserializeDuration(int64(5)); err != nil || actual != 5 {
+		t.Errorf("Unexpected deserialized duration from integer: %v, %v", actual, err)
+	}
+
+	if _, err := DeserializeDuration("1s"); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing invalid duration, but got '%v'", ErrDeserializationError, err)
+	}
+}
+
+func TestBigIntExtType(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	for _, expected := range []*big.Int{big.NewInt(0), big.NewInt(1), big.NewInt(-1), huge} {
+		actual, err := DeserializeBigInt(roundTripExtValue(t, SerializeBigInt(expected)))
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", expected, err)
+		} else if actual.Cmp(expected) != 0 {
+			t.Errorf("Expected deserialized value to be %v, but it is %v", expected, actual)
+		}
+	}
+
+	for _, testCase := range []struct {
+		Input    interface{}
+		Expected string
+	}{
+		{int8(-5), "-5"},
+		{uint64(1<<64 - 1), "18446744073709551615"},
+	} {
+		if actual, err := DeserializeBigInt(testCase.Input); err != nil || actual.String() != testCase.Expected {
+			t.Errorf("Unexpected deserialized integer from %v: %v, %v", testCase.Input, actual, err)
+		}
+	}
+
+	if _, err := DeserializeBigInt(1.5); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing invalid integer, but got '%v'", ErrDeserializationError, err)
+	}
+}
+
+func TestDecimalExtType(t *testing.T) {
+	for _, expected := range []string{"0", "1.5", "-0.001", "123456789012345678901234567890.123456789", "-12.00"} {
+		decimal, err := ParseDecimal(expected)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", expected, err)
+			continue
+		}
+
+		actual, err := DeserializeDecimal(roundTripExtValue(t, SerializeDecimal(decimal)))
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %s: %v", expected, err)
+		} else if actual.String() != expected {
+			t.Errorf("Expected deserialized value to be %s, but it is %s", expected, actual)
+		}
+	}
+
+	// Scales too large to format.
+	for _, scale := range []int32{maxDecimalScale + 1, -maxDecimalScale - 1, math.MaxInt32} {
+		data, err := msgpack.Marshal(SerializeDecimal(Decimal{big.NewInt(1), scale}))
+		if err != nil {
+			t.Fatalf("Unexpected error encoding decimal: %v", err)
+		}
+
+		if _, err = decodeRawValue(data); err != ErrInvalidDecimal {
+			t.Errorf("Expected '%v' decoding decimal with scale %d, but got '%v'", ErrInvalidDecimal, scale, err)
+		}
+	}
+
+	// Scales out of the range of 32 bit integers.
+	for _, scale := range []int64{1<<32 + 1, -1<<32 - 1} {
+		var buffer bytes.Buffer
+		if err := encodeExtValues(msgpack.NewEncoder(&buffer), DecimalExtType, scale, false, []byte{1}); err != nil {
+			t.Fatalf("Unexpected error encoding decimal: %v", err)
+		}
+
+		if _, err := decodeRawValue(buffer.Bytes()); err != ErrInvalidDecimal {
+			t.Errorf("Expected '%v' decoding decimal with scale %d, but got '%v'", ErrInvalidDecimal, scale, err)
+		}
+	}
+
+	if actual := (Decimal{big.NewInt(12), -2}).String(); actual != "1200" {
+		t.Errorf("Expected negative scale decimal to be 1200, but it is %s", actual)
+	}
+
+	for _, input := range []string{"", "-", ".5", "1.", "-1.", "1.2.3", "1e5", "abc", "1,5"} {
+		if _, err := ParseDecimal(input); err != ErrInvalidDecimal {
+			t.Errorf("Expected '%v' parsing %q, but got '%v'", ErrInvalidDecimal, input, err)
+		}
+	}
+}
+
+func TestDeserializeIntoExtTypes(t *testing.T) {
+	var target struct {
+		Time     time.Time
+		Duration time.Duration
+		Int      *big.Int
+		Decimal  Decimal
+	}
+
+	decimal, _ := ParseDecimal("2.50")
+	input := map[interface{}]interface{}{
+		"Time":     SerializeTime(time.Unix(5, 0)),
+		"Duration": SerializeDuration(time.Second),
+		"Int":      SerializeBigInt(big.NewInt(-7)),
+		"Decimal":  SerializeDecimal(decimal),
+	}
+
+	if err := DeserializeInto(input, &target); err != nil {
+		t.Fatalf("Unexpected error deserializing: %v", err)
+	}
+
+	if !target.Time.Equal(time.Unix(5, 0)) || target.Duration != time.Second || target.Int.Int64() != -7 || target.Decimal.String() != "2.50" {
+		t.Errorf("Unexpected deserialized value: %+v", target)
+	}
+
+	// Integers deserialized by value must not share the input's digits.
+	const digits = "123456789012345678901234567890"
+	source, _ := new(big.Int).SetString(digits, 10)
+	var copied big.Int
+	if err := DeserializeInto(SerializeBigInt(source), &copied); err != nil {
+		t.Fatalf("Unexpected error deserializing: %v", err)
+	}
+
+	source.Add(source, big.NewInt(1))
+	if copied.String() != digits {
+		t.Errorf("Expected deserialized integer to be %s, but it is %v", digits, &copied)
+	}
+}
+
+// Test that extension types are not registered with msgpack.
+func TestExtTypesUnregistered(t *testing.T) {
+	for _, value := range []interface{}{
+		SerializeTime(time.Unix(5, 0)),
+		SerializeDuration(time.Second),
+		SerializeBigInt(big.NewInt(-7)),
+		SerializeDecimal(Decimal{big.NewInt(1), 1}),
+	} {
+		data, err := msgpack.Marshal(value)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %v: %v", value, err)
+		}
+
+		var decoded interface{}
+		if err = msgpack.Unmarshal(data, &decoded); err == nil {
+			t.Errorf("Expected %T to be unknown to msgpack, but it decoded into %#v", value, decoded)
+		}
+	}
+}
+
+// Test that extension types round-trip through a connection.
+func TestExtTypesCall(t *testing.T) {
+	client, clientConn, _ := newTestingClientServer(newTestingEchoDispatcher())
+	defer clientConn.Close()
+
+	now := time.Now().UTC()
+	decimal, _ := ParseDecimal("-3.14")
+
+	resp, err := client.Call("echo", []interface{}{
+		SerializeTime(now),
+		SerializeDuration(time.Minute),
+		SerializeBigInt(big.NewInt(42)),
+		SerializeDecimal(decimal),
+	}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	}
+
+	result, _ := resp.(*ResponseMessage).Result.([]interface{})
+	if len(result) != 4 {
+		t.Fatalf("Unexpected result: %v", resp.(*ResponseMessage).Result)
+	}
+
+	if actual, err := DeserializeTime(result[0]); err != nil || !actual.Equal(now) {
+		t.Errorf("Expected time %v, but got %v, %v", now, actual, err)
+	}
+	if actual, err := DeserializeDuration(result[1]); err != nil || actual != time.Minute {
+		t.Errorf("Expected duration %v, but got %v, %v", time.Minute, actual, err)
+	}
+	if actual, err := DeserializeBigInt(result[2]); err != nil || actual.Int64() != 42 {
+		t.Errorf("Expected integer 42, but got %v, %v", actual, err)
+	}
+	if actual, err := DeserializeDecimal(result[3]); err != nil || actual.String() != "-3.14" {
+		t.Errorf("Expected decimal -3.14, but got %v, %v", actual, err)
+	}
+}
+
+func TestFormatExtValue(t *testing.T) {
+	decimal, _ := ParseDecimal("-3.14")
+
+	for _, testCase := range []struct {
+		Value     interface{}
+		TypeName  string
+		Formatted string
+	}{
+		{roundTripExtValue(t, SerializeTime(time.Unix(5, 0))), "time", "1970-01-01T00:00:05Z"},
+		{roundTripExtValue(t, SerializeDuration(time.Second)), "duration", "1s"},
+		{roundTripExtValue(t, SerializeBigInt(big.NewInt(-7))), "big integer", "-7"},
+		{roundTripExtValue(t, SerializeDecimal(decimal)), "decimal", "-3.14"},
+	} {
+		if typeName, formatted, ok := FormatExtValue(testCase.Value); !ok || typeName != testCase.TypeName || formatted != testCase.Formatted {
+			t.Errorf("Expected %s %s, but got %s %s, %v", testCase.TypeName, testCase.Formatted, typeName, formatted, ok)
+		}
+	}
+
+	for _, value := range []interface{}{nil, int64(5), "time", []interface{}{int64(1), int64(2)}} {
+		if _, _, ok := FormatExtValue(value); ok {
+			t.Errorf("Expected %v not to be formatted as an extension value", value)
+		}
+	}
+}
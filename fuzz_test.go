@@ -0,0 +1,298 @@
+package goentangle
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/snappy"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"io"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Encode a message as a connection would send it.
+func fuzzSeedMessage(f *testing.F, msg Message, compressed bool) []byte {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer, "seed")
+	defer conn.Close()
+
+	var err error
+	if compressed {
+		err = conn.sendCompressed(msg, nil, SnappyCompression)
+	} else {
+		err = conn.send(msg)
+	}
+	if err != nil {
+		f.Fatalf("Error encoding seed message: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// Encode a compressed message with a compression method and data.
+func fuzzSeedCompressed(f *testing.F, method CompressionMethod, data []byte) []byte {
+	buffer, err := encodeSlice([]interface{}{CompressedMessageOpcode, MessageId(1), method, data})
+	if err != nil {
+		f.Fatalf("Error encoding seed message: %v", err)
+	}
+	defer buffer.release()
+
+	return append([]byte(nil), buffer.Bytes()...)
+}
+
+// Seed corpus of valid and hostile message streams.
+func fuzzSeeds(f *testing.F) [][]byte {
+	trace := NewTrace("seed")
+	trace.Begin("sub").End()
+	trace.End()
+
+	request := &RequestMessage{
+		messageId: 1,
+		Method:    "method",
+		Arguments: []interface{}{"argument", int64(-1), 1.5, []interface{}{true, nil}, map[string]interface{}{"key": []byte{0x00}}},
+		Trace:     true,
+	}
+
+	nested := bytes.Repeat([]byte{0x91}, 100000)
+
+	return [][]byte{
+		fuzzSeedMessage(f, request, false),
+		fuzzSeedMessage(f, request, true),
+		fuzzSeedMessage(f, &NotificationMessage{messageId: 2, Method: "notify", Arguments: []interface{}{}}, false),
+		fuzzSeedMessage(f, &ResponseMessage{messageId: 3, Result: []interface{}{"result"}, Trace: trace}, false),
+		fuzzSeedMessage(f, &ResponseMessage{messageId: 3, Result: "result", Trace: trace}, true),
+		fuzzSeedMessage(f, &ExceptionMessage{messageId: 4, Definition: "definition", Name: "name", Description: "description", Trace: trace}, false),
+		fuzzSeedMessage(f, &NotificationAcknowledgementMessage{messageId: 5}, false),
+
+		// Deeply nested arrays.
+		append([]byte{0x94, 0x02, 0x01}, nested...),
+
+		// Map with an array key.
+		{0x94, 0x02, 0x01, 0x81, 0x90, 0xc0, 0xc0},
+
+		// Binary claiming a huge length.
+		{0x94, 0x7f, 0x01, 0x00, 0xc6, 0xff, 0xff, 0xff, 0xff},
+
+		// Snappy data claiming a huge decompressed length.
+		fuzzSeedCompressed(f, SnappyCompression, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}),
+
+		// Invalid compression method.
+		fuzzSeedCompressed(f, CompressionMethod(5), []byte{0x03, 0x08, 0x92, 0x04, 0x01}),
+	}
+}
+
+// Fuzz receiving messages, with and without lazy decoding.
+func FuzzReceive(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, lazy bool) {
+		buffer := new(bufferConn)
+		buffer.Write(data)
+
+		conn := NewConn(buffer, "fuzz")
+		defer conn.Close()
+		if lazy {
+			conn.EnableLazyDecoding()
+		}
+
+		for {
+			msg, err := conn.Receive()
+			if err == ErrBadMessage {
+				continue
+			} else if err != nil {
+				if msg != nil {
+					t.Fatalf("Receive returned message %v with error '%v'", msg, err)
+				}
+				return
+			}
+
+			msg.Serialize()
+
+			var result interface{}
+			var argument interface{}
+			switch m := msg.(type) {
+			case *RequestMessage:
+				m.DecodeArguments(&argument)
+
+			case *NotificationMessage:
+				m.DecodeArguments(&argument)
+
+			case *ResponseMessage:
+				m.DecodeResult(&result)
+			}
+		}
+	})
+}
+
+// Fuzz decompression.
+func FuzzDecompress(f *testing.F) {
+	f.Add(uint8(SnappyCompression), []byte{0x03, 0x08, 0x92, 0x04, 0x01})
+	f.Add(uint8(SnappyCompression), []byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Add(uint8(5), []byte{0x00})
+
+	f.Fuzz(func(t *testing.T, method uint8, data []byte) {
+		output, err := CompressionMethod(method).Decompress(data)
+		if err == nil && len(output) > MaxDecompressedLen {
+			t.Fatalf("Decompressed %d bytes, more than %d", len(output), MaxDecompressedLen)
+		}
+	})
+}
+
+// Fuzz dissecting and dumping message streams.
+func FuzzDump(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Dump(io.Discard, bytes.NewReader(data))
+	})
+}
+
+// Test that hostile message data is rejected without panicking.
+func TestConnReceiveHostile(t *testing.T) {
+	for _, test := range []struct {
+		data        []byte
+		expectedErr error
+	}{
+		// Nesting deeper than the limit.
+		{append([]byte{0x94, 0x02, 0x01}, bytes.Repeat([]byte{0x91}, 100000)...), ErrInvalidMessageData},
+
+		// Map with an array key.
+		{[]byte{0x94, 0x02, 0x01, 0x81, 0x90, 0xc0, 0xc0}, ErrInvalidMessageData},
+
+		// Binary claiming a huge length in a truncated stream.
+		{[]byte{0x94, 0x7f, 0x01, 0x00, 0xc6, 0xff, 0xff, 0xff, 0xff}, ErrInvalidMessageData},
+
+		// Invalid compression method.
+		{[]byte{0x94, 0x7f, 0x01, 0x05, 0xc4, 0x05, 0x03, 0x08, 0x92, 0x04, 0x01}, ErrBadMessage},
+
+		// Snappy data claiming a huge decompressed length.
+		{[]byte{0x94, 0x7f, 0x01, 0x00, 0xc4, 0x05, 0xff, 0xff, 0xff, 0xff, 0x0f}, ErrBadMessage},
+	} {
+		buffer := new(bufferConn)
+		buffer.Write(test.data)
+
+		conn := NewConn(buffer, "test")
+		if _, err := conn.Receive(); err != test.expectedErr {
+			t.Errorf("Expected '%v' from Receive receiving %x, but got '%v'", test.expectedErr, test.data[:8], err)
+		}
+		conn.Close()
+	}
+}
+
+// Test that decompression rejects invalid methods and oversized data.
+func TestCompressionMethodDecompressInvalid(t *testing.T) {
+	if _, err := CompressionMethod(5).Decompress([]byte{0x00}); err != ErrInvalidCompressionMethod {
+		t.Errorf("Expected '%v' decompressing with an invalid method, but got '%v'", ErrInvalidCompressionMethod, err)
+	}
+
+	if _, err := CompressionMethod(5).Compress([]byte{0x00}); err != ErrInvalidCompressionMethod {
+		t.Errorf("Expected '%v' compressing with an invalid method, but got '%v'", ErrInvalidCompressionMethod, err)
+	}
+
+	if _, err := SnappyCompression.Decompress([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("Expected '%v' decompressing oversized data, but got '%v'", ErrDecompressedTooLarge, err)
+	}
+
+	// A decompressed length that the compressed data cannot encode.
+	if _, err := SnappyCompression.Decompress([]byte{0xe8, 0x07, 0x00}); err != snappy.ErrCorrupt {
+		t.Errorf("Expected '%v' decompressing data claiming too long a length, but got '%v'", snappy.ErrCorrupt, err)
+	}
+}
+
+// Convert positive fixed integers decoded by msgpack as uint64 into int64, as
+// decoded by message decoders.
+func signFixedIntegers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case uint64:
+		if v <= 0x7f {
+			return int64(v)
+		}
+
+	case []interface{}:
+		for i := range v {
+			v[i] = signFixedIntegers(v[i])
+		}
+
+	case map[interface{}]interface{}:
+		signed := make(map[interface{}]interface{}, len(v))
+		for key, element := range v {
+			signed[signFixedIntegers(key)] = signFixedIntegers(element)
+		}
+		return signed
+	}
+
+	return value
+}
+
+// Test that values are decoded as msgpack decodes them generically, except
+// for positive fixed integers.
+func TestMessageDecoderNext(t *testing.T) {
+	for _, value := range []interface{}{
+		nil,
+		true,
+		false,
+		int8(-5),
+		int16(-300),
+		int32(-70000),
+		int64(math.MinInt64),
+		uint8(200),
+		uint16(60000),
+		uint32(1 << 31),
+		uint64(math.MaxUint64),
+		float32(1.5),
+		2.5,
+		"",
+		strings.Repeat("string", 100),
+		[]byte{},
+		bytes.Repeat([]byte{0x01}, 70000),
+		[]interface{}{},
+		make([]interface{}, 20),
+		map[string]interface{}{"key": []interface{}{int64(1), "value"}},
+		map[interface{}]interface{}{nil: true, int64(1): nil},
+	} {
+		encoded, err := msgpack.Marshal(value)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %v: %v", value, err)
+		}
+
+		expected, err := msgpack.NewDecoder(bytes.NewReader(encoded)).DecodeInterface()
+		if err != nil {
+			t.Fatalf("Unexpected error decoding %v: %v", value, err)
+		}
+		expected = signFixedIntegers(expected)
+
+		actual, err := newMessageDecoder(bytes.NewReader(encoded)).next()
+		if err != nil {
+			t.Errorf("Unexpected error decoding %T: %v", value, err)
+		} else if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %T to decode into %#v, but got %#v", value, expected, actual)
+		}
+	}
+}
+
+// Test that forged array lengths do not allocate memory for elements that are
+// never received.
+func TestMessageDecoderForgedArrayLengths(t *testing.T) {
+	// Arrays claiming 65535 elements, each nested in the previous one.
+	data := bytes.Repeat([]byte{0xdc, 0xff, 0xff}, maxNestingDepth)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err := newMessageDecoder(bytes.NewReader(data)).next(); err == nil {
+		t.Errorf("Expected error decoding truncated arrays")
+	}
+
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Expected decoding %d bytes to allocate less than 1 MiB, but it allocated %d bytes", len(data), allocated)
+	}
+}
@@ -1,2 +1,8 @@
 // Package goentangle provides the Entangle runtime library for Go.
+//
+// Application extension types are registered with RegisterExtType, which must
+// happen before the first connection is created, typically in an init
+// function. Registration fails with ErrExtTypeRegistrationClosed once a
+// connection exists, as the underlying msgpack registrations cannot be changed
+// while connections encode values concurrently.
 package goentangle
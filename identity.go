@@ -0,0 +1,22 @@
+package goentangle
+
+import (
+	"context"
+)
+
+// Identity context key.
+type identityKey struct{}
+
+// Attach an authenticated identity to a context.
+//
+// Authentication interceptors pass the returned context on to the rest of the
+// chain, making the identity available to later interceptors and handlers.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Get the authenticated identity from a context.
+func IdentityFromContext(ctx context.Context) (identity string, ok bool) {
+	identity, ok = ctx.Value(identityKey{}).(string)
+	return
+}
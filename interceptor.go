@@ -0,0 +1,96 @@
+package goentangle
+
+import (
+	"context"
+)
+
+// Call.
+//
+// Describes a single request or notification as seen by interceptors on both
+// the client and the server side.
+type Call struct {
+	// Connection.
+	Conn *Conn
+
+	// Method.
+	Method string
+
+	// Arguments.
+	Arguments []interface{}
+
+	// Notification.
+	//
+	// Set if the call is a notification rather than a request.
+	Notification bool
+
+	// Trace.
+	Trace bool
+}
+
+// Unary invoker.
+//
+// Performs a call and returns the resulting message, which is either a
+// response, an exception or a notification acknowledgement.
+type UnaryInvoker func(ctx context.Context, call *Call) (Message, error)
+
+// Unary interceptor.
+//
+// Wraps the invocation of a single call. The interceptor must invoke next to
+// continue the chain, and may inspect or replace the call, the resulting
+// message and the error.
+type UnaryInterceptor func(ctx context.Context, call *Call, next UnaryInvoker) (Message, error)
+
+// Stream handler.
+//
+// Handles a single message sent or received on a connection.
+type StreamHandler func(conn *Conn, msg Message) error
+
+// Stream interceptor.
+//
+// Entangle has no streaming calls, so stream interceptors wrap the stream of
+// messages on a connection instead: they see every message sent or received,
+// including notification acknowledgements and exceptions. The interceptor
+// must invoke next to let the message through.
+type StreamInterceptor func(conn *Conn, msg Message, next StreamHandler) error
+
+// Chain unary interceptors.
+//
+// The first interceptor is the outermost one.
+func ChainUnaryInterceptors(interceptors ...UnaryInterceptor) UnaryInterceptor {
+	return func(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+		return chainUnaryInvoker(interceptors, next)(ctx, call)
+	}
+}
+
+// Chain stream interceptors.
+//
+// The first interceptor is the outermost one.
+func ChainStreamInterceptors(interceptors ...StreamInterceptor) StreamInterceptor {
+	return func(conn *Conn, msg Message, next StreamHandler) error {
+		return chainStreamHandler(interceptors, next)(conn, msg)
+	}
+}
+
+// Wrap an invoker in a chain of unary interceptors.
+func chainUnaryInvoker(interceptors []UnaryInterceptor, invoker UnaryInvoker) UnaryInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, call *Call) (Message, error) {
+			return interceptor(ctx, call, next)
+		}
+	}
+
+	return invoker
+}
+
+// Wrap a handler in a chain of stream interceptors.
+func chainStreamHandler(interceptors []StreamInterceptor, handler StreamHandler) StreamHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(conn *Conn, msg Message) error {
+			return interceptor(conn, msg, next)
+		}
+	}
+
+	return handler
+}
@@ -0,0 +1,155 @@
+package goentangle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestingClientServer(dispatcher *Dispatcher) (client *ClientConnHandler, clientConn *Conn, serverConn *Conn) {
+	clientConn, serverConn = newTestingConnPipe()
+	go NewServer(dispatcher).ServeConn(serverConn)
+	return NewClientConnHandler(clientConn), clientConn, serverConn
+}
+
+func newTestingEchoDispatcher() *Dispatcher {
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("echo", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		return call.Arguments, nil
+	})
+	return dispatcher
+}
+
+func loggingInterceptor(log *[]string, name string) UnaryInterceptor {
+	return func(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+		*log = append(*log, name+" before "+call.Method)
+		msg, err := next(ctx, call)
+		*log = append(*log, name+" after "+call.Method)
+		return msg, err
+	}
+}
+
+// Test that unary interceptors wrap calls on both sides in order.
+func TestUnaryInterceptors(t *testing.T) {
+	var log []string
+
+	dispatcher := newTestingEchoDispatcher()
+	dispatcher.Intercept(loggingInterceptor(&log, "server outer"), loggingInterceptor(&log, "server inner"))
+	dispatcher.Intercept(func(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+		if len(call.Arguments) == 0 {
+			return nil, BadMessageError.New("no arguments")
+		}
+		return next(ctx, call)
+	})
+
+	client, clientConn, _ := newTestingClientServer(dispatcher)
+	defer clientConn.Close()
+
+	client.Intercept(loggingInterceptor(&log, "client"))
+
+	resp, err := client.Call("echo", []interface{}{"Hello"}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling echo: %v", err)
+	}
+
+	if res, ok := resp.(*ResponseMessage); !ok {
+		t.Errorf("Expected response, but got %T", resp)
+	} else if !reflect.DeepEqual(res.Result, []interface{}{"Hello"}) {
+		t.Errorf("Unexpected result: %v", res.Result)
+	}
+
+	expected := []string{
+		"client before echo",
+		"server outer before echo",
+		"server inner before echo",
+		"server inner after echo",
+		"server outer after echo",
+		"client after echo",
+	}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected interceptor log %v, but got %v", expected, log)
+	}
+
+	// Make sure that an interceptor can reject a call.
+	resp, err = client.Call("echo", []interface{}{}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error calling echo: %v", err)
+	}
+
+	if exc, ok := resp.(*ExceptionMessage); !ok {
+		t.Errorf("Expected exception, but got %T", resp)
+	} else if exc.Name != "BadMessage" || exc.Description != "no arguments" {
+		t.Errorf("Unexpected exception: %s: %s", exc.Name, exc.Description)
+	}
+}
+
+// Test that stream interceptors see sent messages and can drop received
+// messages.
+func TestStreamInterceptors(t *testing.T) {
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	var sent []string
+	clientConn.InterceptSend(func(conn *Conn, msg Message, next StreamHandler) error {
+		if req, ok := msg.(*RequestMessage); ok {
+			sent = append(sent, req.Method)
+		}
+		return next(conn, msg)
+	})
+
+	serverConn.InterceptReceive(func(conn *Conn, msg Message, next StreamHandler) error {
+		if req, ok := msg.(*RequestMessage); ok && req.Method == "drop" {
+			return nil
+		}
+		return next(conn, msg)
+	})
+
+	for _, method := range []string{"drop", "keep"} {
+		if _, err := clientConn.SendRequest(method, []interface{}{}, false); err != nil {
+			t.Fatalf("Error sending request: %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(sent, []string{"drop", "keep"}) {
+		t.Errorf("Unexpected sent methods: %v", sent)
+	}
+
+	msg, err := serverConn.Receive()
+	if err != nil {
+		t.Fatalf("Error receiving message: %v", err)
+	}
+
+	if req, ok := msg.(*RequestMessage); !ok || req.Method != "keep" {
+		t.Errorf("Expected the request for keep to be received, but got %v", msg)
+	}
+}
+
+// Test that calls are abandoned when their context is done.
+func TestClientConnHandlerCallContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("block", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	client, clientConn, _ := newTestingClientServer(dispatcher)
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.CallContext(ctx, "block", []interface{}{}, false, false); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+
+	client.pendingLock.Lock()
+	defer client.pendingLock.Unlock()
+	if len(client.pending) != 0 {
+		t.Errorf("Expected the abandoned call to be removed from the pending table")
+	}
+}
@@ -1,5 +1,9 @@
 package goentangle
 
+import (
+	"time"
+)
+
 // Message.
 type Message interface {
 	// Message ID.
@@ -18,26 +22,48 @@ type RequestMessage struct {
 	Method string
 
 	// Arguments.
+	//
+	// Nil if the connection decodes lazily.
 	Arguments []interface{}
 
 	// Trace.
 	Trace bool
+
+	// Raw arguments if decoded lazily.
+	rawArguments []byte
+
+	// Coercion policy of the context the message was dispatched with.
+	coercionPolicy CoercionPolicy
 }
 
 func (m *RequestMessage) MessageId() MessageId {
 	return m.messageId
 }
 
+// Serialize the message.
+//
+// Lazily decoded arguments are serialized in their raw encoding.
 func (m *RequestMessage) Serialize() []interface{} {
 	return []interface{}{
 		RequestOpcode,
 		m.messageId,
 		m.Method,
-		m.Arguments,
+		serializedArguments(m.Arguments, m.rawArguments),
 		m.Trace,
 	}
 }
 
+// Decode the arguments into Go values.
+//
+// Each value must be a pointer to decode the corresponding argument into, and
+// the number of values must match the number of arguments. Arguments are
+// deserialized as with DeserializeArguments, using the coercion policy of the
+// context the message was dispatched with, if any. Returns a
+// *DeserializationError if decoding failed.
+func (m *RequestMessage) DecodeArguments(values ...interface{}) error {
+	return decodeArguments(m.rawArguments, m.Arguments, m.coercionPolicy, values)
+}
+
 // Notification message.
 type NotificationMessage struct {
 	// Message ID.
@@ -47,52 +73,96 @@ type NotificationMessage struct {
 	Method string
 
 	// Arguments.
+	//
+	// Nil if the connection decodes lazily.
 	Arguments []interface{}
+
+	// Raw arguments if decoded lazily.
+	rawArguments []byte
+
+	// Coercion policy of the context the message was dispatched with.
+	coercionPolicy CoercionPolicy
 }
 
 func (m *NotificationMessage) MessageId() MessageId {
 	return m.messageId
 }
 
+// Serialize the message.
+//
+// Lazily decoded arguments are serialized in their raw encoding.
 func (m *NotificationMessage) Serialize() []interface{} {
 	return []interface{}{
 		NotificationOpcode,
 		m.messageId,
 		m.Method,
-		m.Arguments,
+		serializedArguments(m.Arguments, m.rawArguments),
 	}
 }
 
+// Decode the arguments into Go values.
+//
+// Each value must be a pointer to decode the corresponding argument into, and
+// the number of values must match the number of arguments. Arguments are
+// deserialized as with DeserializeArguments, using the coercion policy of the
+// context the message was dispatched with, if any. Returns a
+// *DeserializationError if decoding failed.
+func (m *NotificationMessage) DecodeArguments(values ...interface{}) error {
+	return decodeArguments(m.rawArguments, m.Arguments, m.coercionPolicy, values)
+}
+
 // Response message.
 type ResponseMessage struct {
 	// Message ID.
 	messageId MessageId
 
 	// Result.
+	//
+	// Nil if the connection decodes lazily.
 	Result interface{}
 
 	// Trace.
 	Trace Trace
+
+	// Raw result if decoded lazily.
+	rawResult []byte
 }
 
 func (m *ResponseMessage) MessageId() MessageId {
 	return m.messageId
 }
 
+// Serialize the message.
+//
+// A lazily decoded result is serialized in its raw encoding.
 func (m *ResponseMessage) Serialize() []interface{} {
 	var serTrace interface{}
 	if m.Trace != nil {
 		serTrace = m.Trace.Serialize()
 	}
 
+	var result interface{} = m.Result
+	if m.Result == nil && m.rawResult != nil {
+		result = rawValue(m.rawResult)
+	}
+
 	return []interface{}{
 		ResponseOpcode,
 		m.messageId,
-		m.Result,
+		result,
 		serTrace,
 	}
 }
 
+// Decode the result into a Go value.
+//
+// The value must be a pointer to decode the result into. The result is
+// deserialized as with DeserializeInto. Returns a *DeserializationError if
+// decoding failed.
+func (m *ResponseMessage) DecodeResult(value interface{}) error {
+	return decodeResult(m.rawResult, m.Result, value)
+}
+
 // Exception message.
 type ExceptionMessage struct {
 	// Message ID.
@@ -109,6 +179,11 @@ type ExceptionMessage struct {
 
 	// Trace.
 	Trace Trace
+
+	// Time after which the failed call may be retried, or zero if there is no
+	// hint. Hints are sent as an additional field, which peers without
+	// support for hints reject.
+	RetryAfter time.Duration
 }
 
 func (m *ExceptionMessage) MessageId() MessageId {
@@ -121,7 +196,7 @@ func (m *ExceptionMessage) Serialize() []interface{} {
 		serTrace = m.Trace.Serialize()
 	}
 
-	return []interface{}{
+	serialized := []interface{}{
 		ExceptionOpcode,
 		m.messageId,
 		m.Definition,
@@ -129,6 +204,31 @@ func (m *ExceptionMessage) Serialize() []interface{} {
 		m.Description,
 		serTrace,
 	}
+
+	if m.RetryAfter > 0 {
+		serialized = append(serialized, int64(m.RetryAfter))
+	}
+
+	return serialized
+}
+
+// Test if the exception was produced from an exception definition.
+func (m *ExceptionMessage) Is(definition ExceptionDefinition) bool {
+	definitionName, name := ExceptionDefinitionNames(definition)
+	return m.Definition == definitionName && m.Name == name
+}
+
+// Get the exception carried by the message.
+//
+// The exception implements RetryAfterException if the message has a
+// retry-after hint.
+func (m *ExceptionMessage) Exception() Exception {
+	exception := NewExceptionDefinition(m.Definition, m.Name).New(m.Description)
+	if m.RetryAfter > 0 {
+		return WithRetryAfter(exception, m.RetryAfter)
+	}
+
+	return exception
 }
 
 // Notification acknowledgement message.
@@ -147,3 +247,12 @@ func (m *NotificationAcknowledgementMessage) Serialize() []interface{} {
 		m.messageId,
 	}
 }
+
+// Get the serialized arguments of a request or notification.
+func serializedArguments(arguments []interface{}, rawArguments []byte) interface{} {
+	if arguments == nil && rawArguments != nil {
+		return rawValue(rawArguments)
+	}
+
+	return arguments
+}
@@ -0,0 +1,614 @@
+package goentangle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"io"
+	"math"
+	"reflect"
+)
+
+// Maximum nesting depth of received values.
+//
+// Deeper values are rejected before they are decoded, as decoding recurses
+// for every level of nesting.
+const maxNestingDepth = 256
+
+// Largest buffer allocated up front for binary data.
+//
+// Larger binary data is read into a growing buffer, so that a forged length
+// cannot allocate more memory than the data actually received.
+const maxPreallocatedBinaryLen = 1 << 20
+
+// Byte reader.
+type byteReader interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// Recording reader.
+//
+// Byte reader that can record the bytes read through it, which is used to
+// capture the raw encoding of lazily decoded values.
+type recordingReader struct {
+	// Underlying reader.
+	reader byteReader
+
+	// Recording.
+	recording bool
+
+	// Recorded bytes.
+	recorded []byte
+}
+
+func (r *recordingReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	if r.recording {
+		r.recorded = append(r.recorded, p[:n]...)
+	}
+	return
+}
+
+func (r *recordingReader) ReadByte() (b byte, err error) {
+	if b, err = r.reader.ReadByte(); err == nil && r.recording {
+		r.recorded = append(r.recorded, b)
+	}
+	return
+}
+
+func (r *recordingReader) UnreadByte() (err error) {
+	if err = r.reader.UnreadByte(); err == nil && r.recording && len(r.recorded) > 0 {
+		r.recorded = r.recorded[:len(r.recorded)-1]
+	}
+	return
+}
+
+// Message decoder.
+//
+// Decodes messages field by field from a stream.
+type messageDecoder struct {
+	// Decoder.
+	decoder *msgpack.Decoder
+
+	// Recording reader the decoder reads from.
+	recorder *recordingReader
+
+	// Buffer for lengths and numbers.
+	header [8]byte
+}
+
+// New message decoder.
+func newMessageDecoder(reader byteReader) *messageDecoder {
+	recorder := &recordingReader{
+		reader: reader,
+	}
+
+	return &messageDecoder{
+		decoder:  msgpack.NewDecoder(recorder),
+		recorder: recorder,
+	}
+}
+
+// Read the raw encoding of the next value.
+//
+// Returns ErrInvalidMessageData if the value is nested too deeply.
+func (d *messageDecoder) raw() (raw []byte, err error) {
+	d.recorder.recording = true
+	d.recorder.recorded = nil
+	err = d.skip()
+	raw = d.recorder.recorded
+	d.recorder.recording = false
+	d.recorder.recorded = nil
+	return
+}
+
+// Decode the next value into a generic value.
+//
+// Values are decoded as by msgpack.Decoder.DecodeInterface, but in a single
+// pass that rejects values nested more than maxNestingDepth levels deep with
+// ErrInvalidMessageData before recursing any further.
+func (d *messageDecoder) next() (interface{}, error) {
+	return d.value(0)
+}
+
+// Read a big-endian unsigned integer of 1, 2, 4 or 8 bytes.
+func (d *messageDecoder) uint(size int) (uint64, error) {
+	if _, err := io.ReadFull(d.recorder, d.header[:size]); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	switch size {
+	case 1:
+		return uint64(d.header[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(d.header[:2])), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(d.header[:4])), nil
+	}
+	return binary.BigEndian.Uint64(d.header[:8]), nil
+}
+
+// Read a big-endian length of 1, 2 or 4 bytes.
+func (d *messageDecoder) length(size int) (uint32, error) {
+	n, err := d.uint(size)
+	return uint32(n), err
+}
+
+// Read bytes.
+//
+// Only small lengths are allocated up front, with longer data read into a
+// growing buffer.
+func (d *messageDecoder) bytes(n uint32) ([]byte, error) {
+	if n <= maxPreallocatedBinaryLen {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(d.recorder, data); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return data, nil
+	}
+
+	var buffer bytes.Buffer
+	if _, err := io.CopyN(&buffer, d.recorder, int64(n)); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decode a value nested in depth containers.
+func (d *messageDecoder) value(depth int) (interface{}, error) {
+	code, err := d.recorder.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f || code >= 0xe0:
+		// Fixed integers, which are all decoded as int64 unlike msgpack,
+		// which decodes positive ones as uint64.
+		return int64(int8(code)), nil
+
+	case code <= 0x8f:
+		return d.mapValue(uint32(code&0x0f), depth)
+
+	case code <= 0x9f:
+		return d.arrayValue(uint32(code&0x0f), depth)
+
+	case code <= 0xbf:
+		b, err := d.bytes(uint32(code & 0x1f))
+		return string(b), err
+
+	case code == 0xc0:
+		return nil, nil
+
+	case code == 0xc2 || code == 0xc3:
+		return code == 0xc3, nil
+
+	case code >= 0xc4 && code <= 0xc6:
+		n, err := d.length(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+
+	case (code >= 0xc7 && code <= 0xc9) || (code >= 0xd4 && code <= 0xd8):
+		return d.extValue(code)
+
+	case code == 0xca:
+		bits, err := d.uint(4)
+		return math.Float32frombits(uint32(bits)), err
+
+	case code == 0xcb:
+		bits, err := d.uint(8)
+		return math.Float64frombits(bits), err
+
+	case code >= 0xcc && code <= 0xcf:
+		return d.uint(1 << (code - 0xcc))
+
+	case code >= 0xd0 && code <= 0xd3:
+		// Sign-extend from the size of the integer.
+		size := 1 << (code - 0xd0)
+		n, err := d.uint(size)
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, err
+
+	case code >= 0xd9 && code <= 0xdb:
+		n, err := d.length(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.bytes(n)
+		return string(b), err
+
+	case code == 0xdc || code == 0xdd:
+		n, err := d.length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayValue(n, depth)
+
+	case code == 0xde || code == 0xdf:
+		n, err := d.length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	}
+
+	return nil, ErrInvalidMessageData
+}
+
+// Decode the elements of an array nested in depth containers.
+func (d *messageDecoder) arrayValue(n uint32, depth int) (interface{}, error) {
+	if n > 0 && depth >= maxNestingDepth {
+		return nil, ErrInvalidMessageData
+	}
+
+	// The array grows as its elements are decoded, so that forged lengths
+	// cannot allocate more memory than the elements actually received.
+	var array []interface{}
+	for i := uint32(0); i < n; i++ {
+		element, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, element)
+	}
+
+	if array == nil {
+		array = []interface{}{}
+	}
+	return array, nil
+}
+
+// Decode the pairs of a map nested in depth containers.
+//
+// Maps with keys that cannot be used as Go map keys, such as arrays, are
+// rejected with ErrInvalidMessageData.
+func (d *messageDecoder) mapValue(n uint32, depth int) (interface{}, error) {
+	if n > 0 && depth >= maxNestingDepth {
+		return nil, ErrInvalidMessageData
+	}
+
+	m := make(map[interface{}]interface{})
+	for i := uint32(0); i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, ErrInvalidMessageData
+		}
+
+		if m[key], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Decode an extension value, given its code.
+//
+// Entangle's extension types are decoded into their generic representation,
+// and registered application extension types into values of their type.
+func (d *messageDecoder) extValue(code byte) (interface{}, error) {
+	var n uint32
+	if code >= 0xd4 {
+		n = 1 << (code - 0xd4)
+	} else {
+		size := 1 << (code - 0xc7)
+		length, err := d.length(size)
+		if err != nil {
+			return nil, err
+		}
+		n = length
+	}
+
+	id, err := d.recorder.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	payload, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder, ok := extTypeDecoders[int8(id)]; ok {
+		return decoder(payload)
+	}
+
+	return decodeApplicationExt(int8(id), payload)
+}
+
+// Skip the next value.
+//
+// Values are skipped iteratively rather than recursively, and values nested
+// more than maxNestingDepth levels deep are rejected with
+// ErrInvalidMessageData.
+func (d *messageDecoder) skip() error {
+	remaining := []uint32{1}
+
+	for {
+		// Leave the containers whose elements have all been read.
+		for len(remaining) > 0 && remaining[len(remaining)-1] == 0 {
+			remaining = remaining[:len(remaining)-1]
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		remaining[len(remaining)-1]--
+
+		code, err := d.recorder.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(remaining) > 1 {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		// Number of bytes following the header, and number of elements of
+		// arrays and maps.
+		var n, elements uint32
+
+		switch {
+		case code <= 0x7f || code >= 0xe0 || code == 0xc0 || code == 0xc2 || code == 0xc3:
+			// Fixed integers, nil and booleans.
+
+		case code <= 0x8f:
+			elements = 2 * uint32(code&0x0f)
+
+		case code <= 0x9f:
+			elements = uint32(code & 0x0f)
+
+		case code <= 0xbf:
+			n = uint32(code & 0x1f)
+
+		case code == 0xc4 || code == 0xd9:
+			n, err = d.length(1)
+
+		case code == 0xc5 || code == 0xda:
+			n, err = d.length(2)
+
+		case code == 0xc6 || code == 0xdb:
+			n, err = d.length(4)
+
+		case code >= 0xc7 && code <= 0xc9:
+			// Extensions have a type byte following the length.
+			if n, err = d.length(1 << (code - 0xc7)); err == nil {
+				n++
+			}
+
+		case code == 0xca:
+			n = 4
+
+		case code == 0xcb:
+			n = 8
+
+		case code >= 0xcc && code <= 0xcf:
+			n = 1 << (code - 0xcc)
+
+		case code >= 0xd0 && code <= 0xd3:
+			n = 1 << (code - 0xd0)
+
+		case code >= 0xd4 && code <= 0xd8:
+			n = 1 + 1<<(code-0xd4)
+
+		case code == 0xdc:
+			elements, err = d.length(2)
+
+		case code == 0xdd:
+			elements, err = d.length(4)
+
+		case code == 0xde:
+			if elements, err = d.length(2); err == nil {
+				elements *= 2
+			}
+
+		case code == 0xdf:
+			var pairs uint32
+			if pairs, err = d.length(4); err == nil {
+				if pairs > 1<<31-1 {
+					return ErrInvalidMessageData
+				}
+				elements = 2 * pairs
+			}
+
+		default:
+			return ErrInvalidMessageData
+		}
+
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		if n > 0 {
+			if _, err = io.CopyN(io.Discard, d.recorder, int64(n)); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+
+		if elements > 0 {
+			if len(remaining) > maxNestingDepth {
+				return ErrInvalidMessageData
+			}
+			remaining = append(remaining, elements)
+		}
+	}
+}
+
+// Message fields.
+//
+// Reads the fields of a single message, keeping track of how many remain so
+// that the stream stays in sync when a message is rejected.
+type messageFields struct {
+	// Decoder.
+	decoder *messageDecoder
+
+	// Number of remaining fields.
+	remaining int
+}
+
+// Number of remaining fields.
+func (f *messageFields) count() int {
+	return f.remaining
+}
+
+// Decode the next field into a generic value.
+//
+// Returns ErrInvalidMessageData if decoding failed.
+func (f *messageFields) next() (interface{}, error) {
+	f.remaining--
+	value, err := f.decoder.next()
+	if err != nil {
+		return nil, ErrInvalidMessageData
+	}
+	return value, nil
+}
+
+// Read the raw encoding of the next field.
+//
+// Returns ErrInvalidMessageData if decoding failed.
+func (f *messageFields) raw() ([]byte, error) {
+	f.remaining--
+	raw, err := f.decoder.raw()
+	if err != nil {
+		return nil, ErrInvalidMessageData
+	}
+	return raw, nil
+}
+
+// Read the next field as binary data into a buffer.
+//
+// Strings are accepted as binary data, as with DeserializeBinary. Returns
+// false, leaving the field to be skipped, if the field is not binary data, and
+// ErrInvalidMessageData if decoding failed.
+func (f *messageFields) binary(buffer []byte) (data []byte, ok bool, err error) {
+	code, err := f.decoder.decoder.PeekCode()
+	if err != nil {
+		return nil, false, ErrInvalidMessageData
+	}
+
+	// Fixed strings, 8, 16 and 32-bit strings and binary.
+	if code&0xe0 != 0xa0 && (code < 0xd9 || code > 0xdb) && (code < 0xc4 || code > 0xc6) {
+		return nil, false, nil
+	}
+
+	f.remaining--
+
+	n, err := f.decoder.decoder.DecodeBytesLen()
+	if err != nil || n < 0 {
+		return nil, false, ErrInvalidMessageData
+	}
+
+	// Only allocate up front for lengths that are either small or fit the
+	// buffer, and grow the buffer as data is received otherwise.
+	if cap(buffer) >= n || n <= maxPreallocatedBinaryLen {
+		if cap(buffer) < n {
+			buffer = make([]byte, n)
+		}
+		data = buffer[:n]
+
+		if _, err = io.ReadFull(f.decoder.recorder, data); err != nil {
+			return nil, false, ErrInvalidMessageData
+		}
+
+		return data, true, nil
+	}
+
+	grown := bytes.NewBuffer(buffer[:0])
+	if _, err = io.CopyN(grown, f.decoder.recorder, int64(n)); err != nil {
+		return nil, false, ErrInvalidMessageData
+	}
+
+	return grown.Bytes(), true, nil
+}
+
+// Skip the remaining fields.
+func (f *messageFields) skip() error {
+	for ; f.remaining > 0; f.remaining-- {
+		if err := f.decoder.skip(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Test if a raw value is an array.
+func isRawArray(raw []byte) bool {
+	if len(raw) == 0 {
+		return false
+	}
+
+	// Fixed arrays, 16-bit arrays and 32-bit arrays.
+	return raw[0]&0xf0 == 0x90 || raw[0] == 0xdc || raw[0] == 0xdd
+}
+
+// Decode a raw value into a generic value.
+func decodeRawValue(raw []byte) (interface{}, error) {
+	return newMessageDecoder(bytes.NewReader(raw)).next()
+}
+
+// Decode raw arguments into generic values.
+func decodeRawArguments(raw []byte) ([]interface{}, error) {
+	value, err := decodeRawValue(raw)
+	arguments, ok := value.([]interface{})
+	if err != nil || !ok {
+		return nil, ErrDeserializationError
+	}
+
+	return arguments, nil
+}
+
+// Decode arguments into Go values with a coercion policy.
+//
+// Decodes from the raw encoding if there is one, and otherwise from the
+// generic arguments as if they were transmitted.
+func decodeArguments(raw []byte, arguments []interface{}, policy CoercionPolicy, values []interface{}) error {
+	if raw == nil {
+		var err error
+		if raw, err = msgpack.Marshal(arguments); err != nil {
+			return ErrDeserializationError
+		}
+	}
+
+	arguments, err := decodeRawArguments(raw)
+	if err != nil {
+		return err
+	}
+
+	return DeserializeArgumentsWithPolicy(arguments, policy, values...)
+}
+
+// Decode a result into a Go value.
+//
+// Decodes from the raw encoding if there is one, and otherwise from the
+// generic result as if it was transmitted.
+func decodeResult(raw []byte, result interface{}, value interface{}) error {
+	if raw == nil {
+		var err error
+		if raw, err = msgpack.Marshal(result); err != nil {
+			return ErrDeserializationError
+		}
+	}
+
+	result, err := decodeRawValue(raw)
+	if err != nil {
+		return ErrDeserializationError
+	}
+
+	return DeserializeInto(result, value)
+}
+
+// Raw value.
+//
+// Raw msgpack encoding of a value, encoded as is.
+type rawValue []byte
+
+func (v rawValue) EncodeMsgpack(e *msgpack.Encoder) error {
+	_, err := e.Writer().Write(v)
+	return err
+}
@@ -24,6 +24,12 @@ const (
 	// Notification acknowledgement opcode.
 	NotificationAcknowledgementOpcode
 
+	// Message chunk opcode.
+	//
+	// Chunks carry consecutive parts of the encoding of a message, the message
+	// ID being that of the chunk stream rather than of the message.
+	MessageChunkOpcode = 0x7e
+
 	// Compressed message opcode.
 	CompressedMessageOpcode = 0x7f
 )
@@ -35,6 +41,8 @@ var opcodeNames = map[Opcode]string{
 	ResponseOpcode:     "response",
 	NotificationAcknowledgementOpcode: "notification acknowledgement",
 	ExceptionOpcode:    "exception",
+	MessageChunkOpcode: "message chunk",
+	CompressedMessageOpcode: "compressed message",
 }
 
 func (o Opcode) String() string {
@@ -47,7 +55,7 @@ func (o Opcode) String() string {
 
 // Test if an opcode is valid.
 func (o Opcode) Valid() bool {
-	return o == CompressedMessageOpcode || o >= RequestOpcode && o <= NotificationAcknowledgementOpcode
+	return o == CompressedMessageOpcode || o == MessageChunkOpcode || o >= RequestOpcode && o <= NotificationAcknowledgementOpcode
 }
 
 // Parse an opcode.
@@ -0,0 +1,80 @@
+package goentangle
+
+import (
+	"bytes"
+	"gopkg.in/vmihailenco/msgpack.v2"
+	"sync"
+)
+
+// Largest buffer capacity returned to the pools.
+//
+// Larger buffers are left to the garbage collector, so that a single huge
+// message does not pin its buffer for the lifetime of the process.
+const maxPooledBufferSize = 1 << 20
+
+// Encode buffer.
+//
+// Buffer with an encoder writing to it.
+type encodeBuffer struct {
+	bytes.Buffer
+
+	// Encoder.
+	encoder *msgpack.Encoder
+}
+
+// Encode buffer pool.
+var encodeBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := new(encodeBuffer)
+		b.encoder = msgpack.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+// Get an empty encode buffer from the pool.
+func getEncodeBuffer() *encodeBuffer {
+	return encodeBufferPool.Get().(*encodeBuffer)
+}
+
+// Return the encode buffer to the pool.
+//
+// The buffer's contents must not be used afterwards.
+func (b *encodeBuffer) release() {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	b.Reset()
+	encodeBufferPool.Put(b)
+}
+
+// Byte slice pool.
+var byteSlicePool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// Get a byte slice of at least the given capacity from the pool.
+//
+// The returned slice has zero length.
+func getByteSlice(capacity int) *[]byte {
+	b := byteSlicePool.Get().(*[]byte)
+	if cap(*b) < capacity {
+		*b = make([]byte, 0, capacity)
+	}
+
+	*b = (*b)[:0]
+	return b
+}
+
+// Return a byte slice to the pool.
+//
+// The slice's contents must not be used afterwards.
+func putByteSlice(b *[]byte) {
+	if cap(*b) > maxPooledBufferSize {
+		return
+	}
+
+	byteSlicePool.Put(b)
+}
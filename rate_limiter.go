@@ -0,0 +1,187 @@
+package goentangle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var ErrInvalidRateLimit = errors.New("invalid rate limit")
+
+// Interval between sweeps of idle token buckets.
+const rateLimitSweepInterval = time.Minute
+
+// Rate limit key function.
+//
+// Returns the key that a call is rate limited by, or nil if the call should
+// not be rate limited. Keys must be comparable.
+type RateLimitKeyFunc func(ctx context.Context, call *Call) interface{}
+
+// Rate limit by connection.
+func RateLimitByConn(ctx context.Context, call *Call) interface{} {
+	return call.Conn
+}
+
+// Rate limit by method.
+func RateLimitByMethod(ctx context.Context, call *Call) interface{} {
+	return call.Method
+}
+
+// Rate limit by identity.
+//
+// Calls without an identity in their context are not rate limited.
+func RateLimitByIdentity(ctx context.Context, call *Call) interface{} {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity
+	}
+
+	return nil
+}
+
+// Token bucket.
+type tokenBucket struct {
+	// Available tokens.
+	tokens float64
+
+	// Time the tokens were last refilled.
+	refilled time.Time
+}
+
+// Rate limiter.
+//
+// Token bucket rate limiter for server-side calls. Each key gets a bucket of
+// burst tokens refilled at rate tokens per second, and every call takes a
+// token. Calls made while the bucket is empty are rejected with a
+// RateLimitedError exception implementing RetryAfterException, whose hint can
+// be recovered from the exception message with RateLimitRetryAfter.
+//
+// Install the rate limiter by passing its Intercept method to
+// Dispatcher.Intercept.
+type RateLimiter struct {
+	// Rate in tokens per second.
+	rate float64
+
+	// Burst size.
+	burst float64
+
+	// Key function.
+	key RateLimitKeyFunc
+
+	// Token buckets.
+	buckets map[interface{}]*tokenBucket
+
+	// Time idle buckets were last swept.
+	swept time.Time
+
+	// Lock.
+	lock sync.Mutex
+
+	// Clock.
+	now func() time.Time
+}
+
+// New rate limiter.
+//
+// Returns an error wrapping ErrInvalidRateLimit if the rate is not a positive,
+// finite number of tokens per second or the burst is less than one.
+func NewRateLimiter(rate float64, burst int, key RateLimitKeyFunc) (*RateLimiter, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return nil, fmt.Errorf("%w: rate %v", ErrInvalidRateLimit, rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("%w: burst %d", ErrInvalidRateLimit, burst)
+	}
+
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		key:     key,
+		buckets: make(map[interface{}]*tokenBucket),
+		now:     time.Now,
+	}, nil
+}
+
+// Intercept a call.
+//
+// Satisfies UnaryInterceptor.
+func (l *RateLimiter) Intercept(ctx context.Context, call *Call, next UnaryInvoker) (Message, error) {
+	if key := l.key(ctx, call); key != nil {
+		if retryAfter, ok := l.take(key); !ok {
+			return nil, WithRetryAfter(RateLimitedError.Newf("rate limit exceeded, retry after %s", retryAfter), retryAfter)
+		}
+	}
+
+	return next(ctx, call)
+}
+
+// Take a token from the bucket for a key.
+//
+// Returns the time until a token is available if the bucket is empty.
+func (l *RateLimiter) take(key interface{}) (retryAfter time.Duration, ok bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{
+			tokens:   l.burst,
+			refilled: now,
+		}
+		l.buckets[key] = bucket
+	}
+
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second)), false
+	}
+
+	bucket.tokens--
+	return 0, true
+}
+
+// Refill a bucket.
+func (l *RateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.refilled).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.refilled = now
+}
+
+// Remove buckets that have refilled completely.
+//
+// Must be called with the lock held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.swept.IsZero() {
+		l.swept = now
+	}
+
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for key, bucket := range l.buckets {
+		if l.refill(bucket, now); bucket.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Get the retry-after hint of a rate limit exception.
+//
+// Returns false if the exception is not a rate limit exception or has no hint.
+func RateLimitRetryAfter(exc *ExceptionMessage) (retryAfter time.Duration, ok bool) {
+	if !exc.Is(RateLimitedError) || exc.RetryAfter <= 0 {
+		return
+	}
+
+	return exc.RetryAfter, true
+}
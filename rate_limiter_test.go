@@ -0,0 +1,136 @@
+package goentangle
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter, err := NewRateLimiter(2, 2, RateLimitByIdentity)
+	if err != nil {
+		t.Fatalf("Error creating rate limiter: %v", err)
+	}
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	invoker := func(ctx context.Context, call *Call) (Message, error) {
+		return &ResponseMessage{}, nil
+	}
+
+	invoke := func(ctx context.Context) error {
+		_, err := limiter.Intercept(ctx, &Call{Method: "method"}, invoker)
+		return err
+	}
+
+	alice := WithIdentity(context.Background(), "alice")
+	bob := WithIdentity(context.Background(), "bob")
+
+	// The burst is allowed, after which calls are rejected.
+	for i := 0; i < 2; i++ {
+		if err := invoke(alice); err != nil {
+			t.Fatalf("Unexpected error within burst: %v", err)
+		}
+	}
+
+	err = invoke(alice)
+	exc, ok := err.(RetryAfterException)
+	if !ok {
+		t.Fatalf("Expected rate limit exception with a retry-after hint, but got %v", err)
+	}
+	if exc.RetryAfter() != 500*time.Millisecond {
+		t.Errorf("Expected retry-after hint of 500ms, but got %v", exc.RetryAfter())
+	}
+
+	// Other keys have their own buckets, and calls without a key are not
+	// limited.
+	if err := invoke(bob); err != nil {
+		t.Errorf("Unexpected error for other identity: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := invoke(context.Background()); err != nil {
+			t.Errorf("Unexpected error without identity: %v", err)
+		}
+	}
+
+	// Tokens are refilled over time.
+	now = now.Add(500 * time.Millisecond)
+	if err := invoke(alice); err != nil {
+		t.Errorf("Unexpected error after refill: %v", err)
+	}
+
+	// Idle buckets are swept.
+	now = now.Add(rateLimitSweepInterval)
+	invoke(bob)
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, but %d remain", len(limiter.buckets))
+	}
+}
+
+// Test that retry-after hints are received with rate limit exceptions.
+func TestRateLimitRetryAfter(t *testing.T) {
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	request := &RequestMessage{messageId: 1}
+	for _, exception := range []Exception{
+		WithRetryAfter(RateLimitedError.New("rate limit exceeded"), time.Second),
+		RateLimitedError.New("rate limit exceeded"),
+		WithRetryAfter(InternalServerError.New("internal"), time.Second),
+	} {
+		if err := serverConn.RaiseException(exception, request, nil); err != nil {
+			t.Fatalf("Error raising exception: %v", err)
+		}
+	}
+
+	for _, expected := range []struct {
+		retryAfter time.Duration
+		ok         bool
+	}{
+		{time.Second, true},
+		{0, false},
+		{0, false},
+	} {
+		msg, err := clientConn.Receive()
+		if err != nil {
+			t.Fatalf("Error receiving exception: %v", err)
+		}
+
+		exc := msg.(*ExceptionMessage)
+		if retryAfter, ok := RateLimitRetryAfter(exc); retryAfter != expected.retryAfter || ok != expected.ok {
+			t.Errorf("Expected retry-after hint %v, %v, but got %v, %v", expected.retryAfter, expected.ok, retryAfter, ok)
+		}
+
+		hinted, ok := exc.Exception().(RetryAfterException)
+		if ok != (exc.RetryAfter > 0) || ok && hinted.RetryAfter() != exc.RetryAfter {
+			t.Errorf("Expected the exception to carry the retry-after hint %v, but got %v", exc.RetryAfter, exc.Exception())
+		}
+	}
+
+	// Non-positive hints are rejected.
+	testConnReceiveFails(t, encodeTestingMessage(t, ExceptionOpcode, MessageId(1), "entangle", "RateLimited", "", nil, int64(0)), ErrBadMessage)
+}
+
+func TestNewRateLimiterErrors(t *testing.T) {
+	for _, test := range []struct {
+		rate  float64
+		burst int
+	}{
+		{0, 1},
+		{-1, 1},
+		{math.NaN(), 1},
+		{math.Inf(1), 1},
+		{1, 0},
+		{1, -1},
+	} {
+		if limiter, err := NewRateLimiter(test.rate, test.burst, RateLimitByConn); limiter != nil || !errors.Is(err, ErrInvalidRateLimit) {
+			t.Errorf("Expected %v creating rate limiter with rate %v and burst %d, but got %v", ErrInvalidRateLimit, test.rate, test.burst, err)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package goentangle
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidRecording = errors.New("invalid recording")
+)
+
+// Message direction.
+type Direction uint8
+
+// Message directions.
+const (
+	// Message sent on the connection.
+	SentDirection Direction = iota
+
+	// Message received on the connection.
+	ReceivedDirection
+)
+
+func (d Direction) String() string {
+	switch d {
+	case SentDirection:
+		return "sent"
+	case ReceivedDirection:
+		return "received"
+	}
+
+	return "<invalid direction>"
+}
+
+// Recorded message.
+type RecordedMessage struct {
+	// Time the message was sent or received.
+	Time time.Time
+
+	// Direction.
+	Direction Direction
+
+	// Message.
+	Message Message
+}
+
+// Recorder.
+//
+// Records the messages sent and received on connections to a writer. The
+// recording is a msgpack stream of [time, direction, message] arrays, the time
+// being in nanoseconds since the Unix epoch and the message being encoded as
+// on the wire, but never compressed.
+type Recorder struct {
+	// Writer.
+	writer io.Writer
+
+	// First write error.
+	err error
+
+	// Lock.
+	lock sync.Mutex
+}
+
+// New recorder.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		writer: w,
+	}
+}
+
+// Record the messages sent and received on a connection.
+//
+// Adds interceptors to the connection, which must not be in use yet. Messages
+// are recorded as they are sent, and as they are received before passing
+// through any receive interceptors added later.
+func (r *Recorder) Record(conn *Conn) {
+	conn.InterceptSend(func(conn *Conn, msg Message, next StreamHandler) error {
+		r.record(SentDirection, msg)
+		return next(conn, msg)
+	})
+
+	conn.InterceptReceive(func(conn *Conn, msg Message, next StreamHandler) error {
+		r.record(ReceivedDirection, msg)
+		return next(conn, msg)
+	})
+}
+
+// Get the first error writing the recording.
+//
+// Recording stops after an error, without affecting the connections.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Record a message.
+func (r *Recorder) record(direction Direction, msg Message) {
+	buffer, err := encodeSlice([]interface{}{
+		time.Now().UnixNano(),
+		direction,
+		msg.Serialize(),
+	})
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		if buffer != nil {
+			buffer.release()
+		}
+		return
+	} else if err != nil {
+		r.err = err
+		return
+	}
+	defer buffer.release()
+
+	_, r.err = r.writer.Write(buffer.Bytes())
+}
+
+// Read a recording.
+//
+// Returns ErrInvalidRecording if the recording is malformed, along with the
+// messages read before the malformed entry.
+func ReadRecording(r io.Reader) (messages []RecordedMessage, err error) {
+	decoder := newMessageDecoder(bufio.NewReader(r))
+
+	for {
+		var n int
+		if n, err = decoder.decoder.DecodeSliceLen(); err == io.EOF {
+			return messages, nil
+		} else if err != nil || n != 3 {
+			return messages, ErrInvalidRecording
+		}
+
+		var nanoseconds int64
+		var direction uint8
+		if nanoseconds, err = decoder.decoder.DecodeInt64(); err != nil {
+			return messages, ErrInvalidRecording
+		}
+		if direction, err = decoder.decoder.DecodeUint8(); err != nil || Direction(direction) > ReceivedDirection {
+			return messages, ErrInvalidRecording
+		}
+
+		var raw []byte
+		if raw, err = decoder.raw(); err != nil {
+			return messages, ErrInvalidRecording
+		}
+
+		var msg Message
+		if msg, err = decodeMessage(raw); err != nil || msg == nil {
+			return messages, ErrInvalidRecording
+		}
+
+		messages = append(messages, RecordedMessage{
+			Time:      time.Unix(0, nanoseconds).UTC(),
+			Direction: Direction(direction),
+			Message:   msg,
+		})
+	}
+}
+
+// Replay settings.
+type ReplaySettings struct {
+	// Direction of the recorded messages to send.
+	//
+	// Recorded messages in the other direction are expected to be received.
+	// Replaying the sent messages of a client's recording replays its calls
+	// against a server, and replaying the sent messages of a server's
+	// recording answers a client's calls.
+	Send Direction
+
+	// Speed relative to the recording.
+	//
+	// Zero or less sends messages as fast as possible, otherwise the intervals
+	// between recorded messages are kept, divided by the speed.
+	Speed float64
+
+	// Maximum time to wait for each message to receive.
+	//
+	// Zero waits indefinitely. Otherwise the replay stops when no message is
+	// received in time, and the messages still expected are reported as
+	// mismatches.
+	Timeout time.Duration
+}
+
+// Replay mismatch.
+//
+// Difference between the replayed and the recorded traffic.
+type ReplayMismatch struct {
+	// Expected message. Nil if the received message was not expected.
+	Expected Message
+
+	// Received message. Nil if the expected message was not received.
+	Received Message
+}
+
+// Result of receiving a message during a replay.
+type replayReceiveResult struct {
+	// Received message.
+	msg Message
+
+	// Error receiving.
+	err error
+}
+
+// Replay a recording on a connection.
+//
+// Recorded messages in the direction to send are sent in order, and a message
+// is received for every recorded message in the other direction. Received
+// messages are matched with the expected messages received so far by message
+// ID, or failing that by opcode, as concurrent calls can be answered out of
+// order. Sent replies take the message ID of the received message matched with
+// the message they reply to. Messages are compared without their traces.
+//
+// The connection must not decode lazily, and must not be read from by others
+// during the replay. After a replay timed out, a receive is still in progress,
+// and the connection should be closed. Returns the mismatches, or the error if
+// sending or receiving failed.
+func Replay(conn *Conn, recording []RecordedMessage, settings ReplaySettings) (mismatches []ReplayMismatch, err error) {
+	var pending []Message
+	messageIds := make(map[MessageId]MessageId)
+
+	// Messages are received in the background, so that waiting for them can
+	// time out.
+	results := make(chan replayReceiveResult, 1)
+	receive := func() {
+		msg, err := conn.Receive()
+		results <- replayReceiveResult{msg, err}
+	}
+
+replay:
+	for i, recorded := range recording {
+		if settings.Speed > 0 && i > 0 {
+			time.Sleep(time.Duration(float64(recorded.Time.Sub(recording[i-1].Time)) / settings.Speed))
+		}
+
+		if recorded.Direction == settings.Send {
+			msg := recorded.Message
+			if isReplyMessage(msg) {
+				if id, ok := messageIds[msg.MessageId()]; ok {
+					msg = withMessageId(msg, id)
+				}
+			}
+
+			if err = conn.send(msg); err != nil {
+				return
+			}
+			continue
+		}
+
+		pending = append(pending, recorded.Message)
+
+		go receive()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if settings.Timeout > 0 {
+			timer = time.NewTimer(settings.Timeout)
+			timeout = timer.C
+		}
+
+		var received Message
+		select {
+		case result := <-results:
+			if received, err = result.msg, result.err; err != nil {
+				return
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+
+		case <-timeout:
+			for _, remaining := range recording[i+1:] {
+				if remaining.Direction != settings.Send {
+					pending = append(pending, remaining.Message)
+				}
+			}
+			break replay
+		}
+
+		match := -1
+		for j, expected := range pending {
+			if expected.MessageId() == received.MessageId() && messageOpcode(expected) == messageOpcode(received) {
+				match = j
+				break
+			}
+		}
+		if match < 0 {
+			for j, expected := range pending {
+				if messageOpcode(expected) == messageOpcode(received) {
+					match = j
+					break
+				}
+			}
+		}
+
+		if match < 0 {
+			mismatches = append(mismatches, ReplayMismatch{
+				Received: received,
+			})
+			continue
+		}
+
+		expected := pending[match]
+		pending = append(pending[:match], pending[match+1:]...)
+		messageIds[expected.MessageId()] = received.MessageId()
+
+		if !replayedMessagesEqual(expected, received) {
+			mismatches = append(mismatches, ReplayMismatch{
+				Expected: expected,
+				Received: received,
+			})
+		}
+	}
+
+	for _, expected := range pending {
+		mismatches = append(mismatches, ReplayMismatch{
+			Expected: expected,
+		})
+	}
+
+	return
+}
+
+// Get the opcode of a message.
+func messageOpcode(msg Message) Opcode {
+	switch msg.(type) {
+	case *NotificationMessage:
+		return NotificationOpcode
+	case *ResponseMessage:
+		return ResponseOpcode
+	case *ExceptionMessage:
+		return ExceptionOpcode
+	case *NotificationAcknowledgementMessage:
+		return NotificationAcknowledgementOpcode
+	}
+
+	return RequestOpcode
+}
+
+// Test if a message replies to another message.
+func isReplyMessage(msg Message) bool {
+	switch msg.(type) {
+	case *ResponseMessage, *ExceptionMessage, *NotificationAcknowledgementMessage:
+		return true
+	}
+
+	return false
+}
+
+// Copy a message with another message ID.
+func withMessageId(msg Message, id MessageId) Message {
+	switch m := msg.(type) {
+	case *RequestMessage:
+		c := *m
+		c.messageId = id
+		return &c
+
+	case *NotificationMessage:
+		c := *m
+		c.messageId = id
+		return &c
+
+	case *ResponseMessage:
+		c := *m
+		c.messageId = id
+		return &c
+
+	case *ExceptionMessage:
+		c := *m
+		c.messageId = id
+		return &c
+
+	case *NotificationAcknowledgementMessage:
+		c := *m
+		c.messageId = id
+		return &c
+	}
+
+	return msg
+}
+
+// Test if a replayed message equals the recorded message, ignoring message
+// IDs and traces.
+func replayedMessagesEqual(expected, received Message) bool {
+	expectedFields, receivedFields := expected.Serialize(), received.Serialize()
+	if len(expectedFields) != len(receivedFields) {
+		return false
+	}
+
+	switch expected.(type) {
+	case *ResponseMessage, *ExceptionMessage:
+		expectedFields[len(expectedFields)-1] = nil
+		receivedFields[len(receivedFields)-1] = nil
+	}
+
+	return reflect.DeepEqual(expectedFields[2:], receivedFields[2:])
+}
@@ -0,0 +1,241 @@
+package goentangle
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// Make calls recorded on the client side, the server side or both.
+func recordTestingCalls(t *testing.T, client, server *Recorder) {
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+
+	if client != nil {
+		client.Record(clientConn)
+	}
+	if server != nil {
+		server.Record(serverConn)
+	}
+
+	go NewServer(newTestingEchoDispatcher()).ServeConn(serverConn)
+	makeTestingCalls(t, NewClientConnHandler(clientConn))
+}
+
+// Make an echo request, a notification and a call to an unknown method.
+func makeTestingCalls(t *testing.T, client *ClientConnHandler) {
+	if resp, err := client.Call("echo", []interface{}{"a", int64(1)}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if result, _ := resp.(*ResponseMessage).Result.([]interface{}); len(result) != 2 || result[0] != "a" {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	if _, err := client.Call("echo", []interface{}{}, true, false); err != nil {
+		t.Fatalf("Unexpected error notifying: %v", err)
+	}
+
+	if resp, err := client.Call("missing", []interface{}{}, false, false); err != nil {
+		t.Fatalf("Unexpected error calling: %v", err)
+	} else if exc, ok := resp.(*ExceptionMessage); !ok || !exc.Is(UnknownMethodError) {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+}
+
+// Test recording and reading back traffic.
+func TestRecordRead(t *testing.T) {
+	var buffer bytes.Buffer
+	recorder := NewRecorder(&buffer)
+	recordTestingCalls(t, recorder, nil)
+
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("Unexpected recording error: %v", err)
+	}
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error reading recording: %v", err)
+	}
+
+	expected := []struct {
+		direction Direction
+		opcode    Opcode
+	}{
+		{SentDirection, RequestOpcode},
+		{ReceivedDirection, ResponseOpcode},
+		{SentDirection, NotificationOpcode},
+		{ReceivedDirection, NotificationAcknowledgementOpcode},
+		{SentDirection, RequestOpcode},
+		{ReceivedDirection, ExceptionOpcode},
+	}
+
+	if len(recording) != len(expected) {
+		t.Fatalf("Expected %d recorded messages, but got %d", len(expected), len(recording))
+	}
+
+	for i, recorded := range recording {
+		if recorded.Direction != expected[i].direction || messageOpcode(recorded.Message) != expected[i].opcode {
+			t.Errorf("Expected message %d to be %s %s, but got %s %s", i, expected[i].direction, expected[i].opcode, recorded.Direction, messageOpcode(recorded.Message))
+		}
+		if i > 0 && recorded.Time.Before(recording[i-1].Time) {
+			t.Errorf("Expected message %d to be recorded in order", i)
+		}
+	}
+
+	if req := recording[0].Message.(*RequestMessage); req.Method != "echo" || len(req.Arguments) != 2 {
+		t.Errorf("Unexpected recorded request: %v", req)
+	}
+}
+
+// Test that malformed recordings are rejected.
+func TestReadRecordingInvalid(t *testing.T) {
+	for _, input := range [][]byte{
+		{0x01},
+		{0x92, 0x01, 0x00},
+		{0x93, 0x01, 0x02, 0x92, 0x04, 0x01},
+		{0x93, 0x01, 0x00, 0x92, 0x10, 0x01},
+		{0x93, 0x01, 0x00, 0x92},
+	} {
+		if _, err := ReadRecording(bytes.NewReader(input)); err != ErrInvalidRecording {
+			t.Errorf("Expected %v reading %x, but got %v", ErrInvalidRecording, input, err)
+		}
+	}
+}
+
+// Test replaying a client's recording against a server.
+func TestReplayAgainstServer(t *testing.T) {
+	var buffer bytes.Buffer
+	recordTestingCalls(t, NewRecorder(&buffer), nil)
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error reading recording: %v", err)
+	}
+
+	replay := func(dispatcher *Dispatcher) []ReplayMismatch {
+		clientConn, serverConn := newTestingConnPipe()
+		defer clientConn.Close()
+		go NewServer(dispatcher).ServeConn(serverConn)
+
+		mismatches, err := Replay(clientConn, recording, ReplaySettings{
+			Send: SentDirection,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error replaying: %v", err)
+		}
+		return mismatches
+	}
+
+	if mismatches := replay(newTestingEchoDispatcher()); len(mismatches) != 0 {
+		t.Errorf("Unexpected mismatches: %v", mismatches)
+	}
+
+	// A server answering differently.
+	dispatcher := NewDispatcher()
+	dispatcher.Handle("echo", func(ctx context.Context, call *Call, trace Trace) (interface{}, error) {
+		return "changed", nil
+	})
+
+	mismatches := replay(dispatcher)
+	if len(mismatches) != 1 || mismatches[0].Expected.(*ResponseMessage).MessageId() != 1 {
+		t.Fatalf("Expected a mismatching response, but got %v", mismatches)
+	}
+	if result := mismatches[0].Received.(*ResponseMessage).Result; result != "changed" {
+		t.Errorf("Unexpected received result: %v", result)
+	}
+}
+
+// Test replaying a server's recording against a client.
+func TestReplayAgainstClient(t *testing.T) {
+	var buffer bytes.Buffer
+	recordTestingCalls(t, nil, NewRecorder(&buffer))
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error reading recording: %v", err)
+	}
+
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+
+	// Start the client's message IDs elsewhere, so that replies must take the
+	// IDs of the replayed calls.
+	clientConn.messageIdCounter = 100
+
+	done := make(chan []ReplayMismatch)
+	go func() {
+		mismatches, err := Replay(serverConn, recording, ReplaySettings{
+			Send:  SentDirection,
+			Speed: 1000,
+		})
+		if err != nil {
+			t.Errorf("Unexpected error replaying: %v", err)
+		}
+		done <- mismatches
+	}()
+
+	makeTestingCalls(t, NewClientConnHandler(clientConn))
+
+	if mismatches := <-done; len(mismatches) != 0 {
+		t.Errorf("Unexpected mismatches: %v", mismatches)
+	}
+}
+
+// Test that a replay waiting for a message that never arrives times out.
+func TestReplayTimeout(t *testing.T) {
+	var buffer bytes.Buffer
+	recordTestingCalls(t, NewRecorder(&buffer), nil)
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error reading recording: %v", err)
+	}
+
+	// Nothing answers on the other end.
+	clientConn, _ := newTestingConnPipe()
+	defer clientConn.Close()
+
+	mismatches, err := Replay(clientConn, recording, ReplaySettings{
+		Send:    SentDirection,
+		Timeout: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error replaying: %v", err)
+	}
+
+	if len(mismatches) != 3 {
+		t.Fatalf("Expected 3 mismatches, but got %v", mismatches)
+	}
+	for i, mismatch := range mismatches {
+		if mismatch.Expected == nil || mismatch.Received != nil || !isReplyMessage(mismatch.Expected) {
+			t.Errorf("Expected mismatch %d to be a missing reply, but got %v", i, mismatch)
+		}
+	}
+}
+
+// Test that lazily decoded messages are recorded in full.
+func TestRecordLazy(t *testing.T) {
+	var buffer bytes.Buffer
+	recorder := NewRecorder(&buffer)
+
+	clientConn, serverConn := newTestingConnPipe()
+	defer clientConn.Close()
+
+	serverConn.EnableLazyDecoding()
+	recorder.Record(serverConn)
+
+	go NewServer(newTestingEchoDispatcher()).ServeConn(serverConn)
+	makeTestingCalls(t, NewClientConnHandler(clientConn))
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatalf("Unexpected error reading recording: %v", err)
+	}
+
+	if len(recording) != 6 {
+		t.Fatalf("Expected 6 recorded messages, but got %d", len(recording))
+	}
+	if req, ok := recording[0].Message.(*RequestMessage); !ok || len(req.Arguments) != 2 || req.Arguments[0] != "a" {
+		t.Errorf("Unexpected recorded request: %v", recording[0].Message)
+	}
+}
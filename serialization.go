@@ -1 +1,19 @@
 package goentangle
+
+import (
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// Normalize a value into its transmitted form.
+//
+// The value is encoded and decoded as if it was transmitted, so that for
+// example integers of any width become int64 or uint64, and structs become
+// maps.
+func Normalize(value interface{}) (interface{}, error) {
+	encoded, err := msgpack.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRawValue(encoded)
+}
@@ -1,7 +1,10 @@
 package goentangle
 
 import (
+	"context"
 	"net"
+	"sync"
+	"time"
 )
 
 // Server.
@@ -18,6 +21,8 @@ type Server interface {
 	// ServeConn runs the server on a single connection.
 	//
 	// ServeConn blocks, serving the connection until the client hangs up. The
+	// contexts of the calls being handled are then cancelled, and requests and
+	// notifications still waiting for an in-flight slot are dropped. The
 	// caller typically invokes ServeConn in a go statement.
 	ServeConn(conn *Conn)
 
@@ -26,3 +31,176 @@ type Server interface {
 	// Only valid when using Serve.
 	Wait()
 }
+
+// Server settings.
+type ServerSettings struct {
+	// Maximum number of in-flight requests and notifications across all
+	// connections.
+	//
+	// Zero means no limit.
+	MaxInFlight int
+
+	// Maximum number of requests and notifications waiting for an in-flight
+	// slot across all connections.
+	MaxQueued int
+
+	// Maximum number of in-flight requests and notifications per connection.
+	//
+	// Zero means no limit.
+	MaxInFlightPerConn int
+
+	// Maximum number of requests and notifications waiting for an in-flight
+	// slot per connection.
+	MaxQueuedPerConn int
+
+	// Adapt the server-wide in-flight limit to observed latency.
+	//
+	// MaxInFlight is used as the upper bound of the limit.
+	AdaptiveLimit bool
+
+	// Coercion policy attached to the context of every call.
+	//
+	// Interceptors can override the policy for individual calls with
+	// WithCoercionPolicy.
+	CoercionPolicy CoercionPolicy
+}
+
+// Server implementation.
+type server struct {
+	// Dispatcher.
+	dispatcher *Dispatcher
+
+	// Settings.
+	settings ServerSettings
+
+	// Server-wide concurrency limiter.
+	limiter *concurrencyLimiter
+
+	// Connections being served by Serve.
+	conns sync.WaitGroup
+}
+
+// New server.
+//
+// Incoming requests and notifications are dispatched concurrently using the
+// dispatcher.
+func NewServer(dispatcher *Dispatcher) Server {
+	return NewServerWithSettings(dispatcher, ServerSettings{})
+}
+
+// New server with settings.
+//
+// Requests and notifications beyond the in-flight and queue limits are
+// rejected immediately with an OverloadedError exception.
+func NewServerWithSettings(dispatcher *Dispatcher, settings ServerSettings) Server {
+	return &server{
+		dispatcher: dispatcher,
+		settings:   settings,
+		limiter:    newConcurrencyLimiter(settings.MaxInFlight, settings.MaxQueued, settings.AdaptiveLimit),
+	}
+}
+
+func (s *server) Accept(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.ServeConn(NewConn(conn, conn.RemoteAddr().String()))
+	}
+}
+
+func (s *server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		s.conns.Add(1)
+		go func(conn net.Conn) {
+			defer s.conns.Done()
+			s.ServeConn(NewConn(conn, conn.RemoteAddr().String()))
+		}(conn)
+	}
+}
+
+func (s *server) ServeConn(conn *Conn) {
+	defer conn.Close()
+
+	var pending sync.WaitGroup
+	defer pending.Wait()
+
+	connLimiter := newConcurrencyLimiter(s.settings.MaxInFlightPerConn, s.settings.MaxQueuedPerConn, false)
+
+	// Calls are handled with a context that is cancelled once the connection
+	// is no longer served.
+	ctx, cancel := context.WithCancel(WithCoercionPolicy(context.Background(), s.settings.CoercionPolicy))
+	defer cancel()
+
+	for {
+		msg, err := conn.Receive()
+		if err == ErrBadMessage {
+			continue
+		} else if err != nil {
+			return
+		}
+
+		// Only requests and notifications are subject to the limits.
+		switch msg.(type) {
+		case *RequestMessage, *NotificationMessage:
+		default:
+			continue
+		}
+
+		// Reserve a connection slot, shedding the load if there is none.
+		connTicket, ok := connLimiter.reserve()
+		if !ok {
+			conn.RaiseException(OverloadedError.New("too many requests in flight on connection"), msg, nil)
+			continue
+		}
+
+		pending.Add(1)
+		go func(msg Message) {
+			defer pending.Done()
+
+			// Only reserve a server slot once the connection slot is
+			// acquired, so that requests queued on a busy connection do not
+			// hold server slots needed by other connections. Give up waiting
+			// once the connection is no longer served.
+			select {
+			case <-connTicket.ready:
+			case <-ctx.Done():
+				connLimiter.cancel(connTicket)
+				return
+			}
+
+			serverTicket, ok := s.limiter.reserve()
+			if !ok {
+				connLimiter.release(0)
+				conn.RaiseException(OverloadedError.New("too many requests in flight on server"), msg, nil)
+				return
+			}
+
+			select {
+			case <-serverTicket.ready:
+			case <-ctx.Done():
+				s.limiter.cancel(serverTicket)
+				connLimiter.release(0)
+				return
+			}
+
+			start := time.Now()
+			s.dispatcher.Dispatch(ctx, conn, msg)
+			latency := time.Since(start)
+
+			s.limiter.release(latency)
+			connLimiter.release(latency)
+		}(msg)
+	}
+}
+
+func (s *server) Wait() {
+	s.conns.Wait()
+}
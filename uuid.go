@@ -0,0 +1,79 @@
+package goentangle
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrInvalidUUID = errors.New("invalid UUID")
+)
+
+// UUID.
+//
+// UUIDs are transmitted as 16 bytes of binary data.
+type UUID [16]byte
+
+// New random UUID.
+//
+// Generates a version 4 UUID.
+func NewUUID() (u UUID, err error) {
+	if _, err = rand.Read(u[:]); err != nil {
+		return
+	}
+
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return
+}
+
+// Parse a UUID.
+//
+// Parses the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx. Returns
+// ErrInvalidUUID if parsing failed.
+func ParseUUID(s string) (u UUID, err error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrInvalidUUID
+	}
+
+	digits := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36]
+	if _, err = hex.Decode(u[:], []byte(digits)); err != nil {
+		return UUID{}, ErrInvalidUUID
+	}
+
+	return
+}
+
+func (u UUID) String() string {
+	var s [36]byte
+
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:36], u[10:16])
+
+	return string(s[:])
+}
+
+// Deserialize a UUID.
+//
+// Besides 16 bytes of binary data, the canonical string form is accepted.
+//
+// Returns a *DeserializationError if deserialization failed.
+func DeserializeUUID(input interface{}) (UUID, error) {
+	if s, ok := input.(string); ok && len(s) == 36 {
+		u, err := ParseUUID(s)
+		if err != nil {
+			return u, newDeserializationError(uuidType, input)
+		}
+		return u, nil
+	}
+
+	return DeserializeByteArray[UUID](input)
+}
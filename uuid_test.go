@@ -0,0 +1,83 @@
+package goentangle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	const canonical = "123e4567-e89b-12d3-a456-426614174000"
+
+	u, err := ParseUUID(canonical)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing %s: %v", canonical, err)
+	}
+	if u.String() != canonical {
+		t.Errorf("Expected UUID to be %s, but it is %s", canonical, u)
+	}
+
+	// Invalid.
+	for _, input := range []string{
+		"",
+		"123e4567e89b12d3a456426614174000",
+		"123e4567-e89b-12d3-a456_426614174000",
+		"123e4567-e89b-12d3-a456-42661417400g",
+	} {
+		if _, err := ParseUUID(input); err != ErrInvalidUUID {
+			t.Errorf("Expected '%v' parsing %q, but got '%v'", ErrInvalidUUID, input, err)
+		}
+	}
+
+	// Random.
+	random, err := NewUUID()
+	if err != nil {
+		t.Fatalf("Unexpected error generating UUID: %v", err)
+	}
+	if random[6]>>4 != 4 || random[8]>>6 != 2 {
+		t.Errorf("Expected version 4 UUID, but got %s", random)
+	}
+}
+
+func TestDeserializeUUID(t *testing.T) {
+	expected, _ := ParseUUID("123e4567-e89b-12d3-a456-426614174000")
+
+	// Valid.
+	for _, input := range []interface{}{
+		expected[:],
+		"123e4567-e89b-12d3-a456-426614174000",
+		roundTripExtValue(t, expected),
+	} {
+		actual, err := DeserializeUUID(input)
+		if err != nil {
+			t.Errorf("Unexpected error deserializing %v: %v", input, err)
+		} else if actual != expected {
+			t.Errorf("Expected deserialized value to be %s, but it is %s", expected, actual)
+		}
+	}
+
+	// Invalid.
+	for _, input := range []interface{}{
+		nil,
+		expected[:15],
+		"123e4567-e89b-12d3-a456-42661417400g",
+		int64(1),
+	} {
+		if _, err := DeserializeUUID(input); !errors.Is(err, ErrDeserializationError) {
+			t.Errorf("Expected '%v' deserializing %v, but got '%v'", ErrDeserializationError, input, err)
+		}
+	}
+}
+
+func TestDeserializeByteArray(t *testing.T) {
+	if actual, err := DeserializeByteArray[[4]byte]([]byte{1, 2, 3, 4}); err != nil || actual != [4]byte{1, 2, 3, 4} {
+		t.Errorf("Unexpected deserialized array: %v, %v", actual, err)
+	}
+
+	if _, err := DeserializeByteArray[[4]byte]([]byte{1, 2, 3}); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing short binary, but got '%v'", ErrDeserializationError, err)
+	}
+
+	if _, err := DeserializeByteArray[[4]int]([]byte{1, 2, 3, 4}); !errors.Is(err, ErrDeserializationError) {
+		t.Errorf("Expected '%v' deserializing into non-byte array, but got '%v'", ErrDeserializationError, err)
+	}
+}
@@ -0,0 +1,341 @@
+package goentangle
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of times a queued write may be passed over by higher priority
+	// writes before it is promoted.
+	writeStarvationLimit = 16
+
+	// Maximum number of coalesced writes per flush.
+	writeCoalescingLimit = 64
+)
+
+// Write priority.
+type writePriority uint8
+
+// Write priorities, from most to least urgent.
+const (
+	// Control messages: exceptions and notification acknowledgements.
+	controlWritePriority writePriority = iota
+
+	// Regular messages.
+	normalWritePriority
+
+	// Bulk messages: compressed messages.
+	bulkWritePriority
+
+	// Number of write priorities.
+	writePriorities
+)
+
+// Get the write priority of a message.
+func messageWritePriority(msg Message) writePriority {
+	switch msg.(type) {
+	case *ExceptionMessage, *NotificationAcknowledgementMessage:
+		return controlWritePriority
+	}
+
+	return normalWritePriority
+}
+
+// Write request.
+type writeRequest struct {
+	// Data.
+	data []byte
+
+	// Receives the outcome of the write.
+	done chan error
+}
+
+// Write scheduler.
+//
+// Serializes writes to a connection from any number of goroutines on a single
+// writer goroutine, writing the most urgent queued write first. A write that
+// is being written is never preempted, but data written in parts, such as the
+// chunks of a large message, may have more urgent writes interleaved between
+// its parts. The writer goroutine only runs while writes are queued, so an idle
+// scheduler holds no goroutine.
+type writeScheduler struct {
+	// Writer.
+	writer *bufio.Writer
+
+	// Queued writes by priority.
+	queues [writePriorities][]*writeRequest
+
+	// Times the head of each queue has been passed over.
+	skipped [writePriorities]int
+
+	// Sticky write error.
+	err error
+
+	// Coalesce writes.
+	coalesce bool
+
+	// Time to linger for more writes before flushing coalesced writes.
+	linger time.Duration
+
+	// Writer goroutine is running.
+	running bool
+
+	// Lock.
+	lock sync.Mutex
+}
+
+// New write scheduler.
+func newWriteScheduler(writer *bufio.Writer) *writeScheduler {
+	return &writeScheduler{
+		writer: writer,
+	}
+}
+
+// Write data.
+//
+// Blocks until the data has been written and flushed, or writing failed.
+func (s *writeScheduler) write(data []byte, priority writePriority) error {
+	req := newWriteRequest(data)
+	if err := s.enqueue(priority, req); err != nil {
+		return err
+	}
+
+	return <-req.done
+}
+
+// Write data in consecutive parts.
+//
+// The parts are queued together and written in order, but more urgent writes
+// may be written between them. Blocks until all parts have been written and
+// flushed, or writing failed.
+func (s *writeScheduler) writeParts(parts [][]byte, priority writePriority) (err error) {
+	reqs := make([]*writeRequest, len(parts))
+	for i, data := range parts {
+		reqs[i] = newWriteRequest(data)
+	}
+
+	if err = s.enqueue(priority, reqs...); err != nil {
+		return
+	}
+
+	for _, req := range reqs {
+		if reqErr := <-req.done; reqErr != nil && err == nil {
+			err = reqErr
+		}
+	}
+
+	return
+}
+
+// New write request.
+func newWriteRequest(data []byte) *writeRequest {
+	return &writeRequest{
+		data: data,
+		done: make(chan error, 1),
+	}
+}
+
+// Queue write requests, starting the writer goroutine if needed.
+//
+// Returns the sticky write error without queueing if writing has failed.
+func (s *writeScheduler) enqueue(priority writePriority, reqs ...*writeRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.queues[priority] = append(s.queues[priority], reqs...)
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+
+	return nil
+}
+
+// Coalesce writes.
+//
+// Instead of flushing after every write, writes are flushed together once no
+// more are queued, optionally lingering for more writes first.
+func (s *writeScheduler) coalesceWrites(linger time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.coalesce = true
+	s.linger = linger
+}
+
+// Close the scheduler.
+//
+// Queued and future writes fail with io.EOF.
+func (s *writeScheduler) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err == nil {
+		s.fail(io.EOF)
+	}
+}
+
+// Fail all queued writes and make the error sticky.
+//
+// Must be called with the lock held.
+func (s *writeScheduler) fail(err error) {
+	s.err = err
+
+	for priority, queue := range s.queues {
+		for _, req := range queue {
+			req.done <- err
+		}
+		s.queues[priority] = nil
+	}
+}
+
+// Pop the next write request.
+//
+// Returns nil if no writes are queued. Must be called with the lock held.
+func (s *writeScheduler) next() *writeRequest {
+	// Promote a starved write if there is one.
+	for priority := writePriorities - 1; priority > controlWritePriority; priority-- {
+		if len(s.queues[priority]) > 0 && s.skipped[priority] >= writeStarvationLimit {
+			return s.pop(priority)
+		}
+	}
+
+	for priority := controlWritePriority; priority < writePriorities; priority++ {
+		if len(s.queues[priority]) > 0 {
+			for lower := priority + 1; lower < writePriorities; lower++ {
+				if len(s.queues[lower]) > 0 {
+					s.skipped[lower]++
+				}
+			}
+
+			return s.pop(priority)
+		}
+	}
+
+	return nil
+}
+
+// Pop the head of a queue.
+//
+// Must be called with the lock held.
+func (s *writeScheduler) pop(priority writePriority) *writeRequest {
+	req := s.queues[priority][0]
+	s.queues[priority][0] = nil
+	s.queues[priority] = s.queues[priority][1:]
+	s.skipped[priority] = 0
+	return req
+}
+
+// Write queued requests until none are left, the scheduler is closed or
+// writing fails.
+func (s *writeScheduler) run() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer func() {
+		s.running = false
+	}()
+
+	// Coalesced writes awaiting a flush.
+	var unflushed []*writeRequest
+	lingered := false
+
+	for {
+		var req *writeRequest
+		if s.err == nil {
+			if req = s.next(); req == nil && len(unflushed) == 0 {
+				return
+			}
+		}
+
+		if s.err != nil {
+			for _, done := range unflushed {
+				done.done <- s.err
+			}
+			return
+		}
+
+		// Flush coalesced writes once the queue is idle or the batch is full,
+		// lingering for more writes first if requested.
+		if req == nil || len(unflushed) >= writeCoalescingLimit {
+			if req == nil && s.linger > 0 && !lingered {
+				lingered = true
+				s.lock.Unlock()
+				time.Sleep(s.linger)
+				s.lock.Lock()
+				continue
+			}
+
+			s.lock.Unlock()
+			err := s.writer.Flush()
+			s.lock.Lock()
+
+			for _, done := range unflushed {
+				done.done <- err
+			}
+			unflushed = nil
+			lingered = false
+
+			if err != nil {
+				if req != nil {
+					req.done <- err
+				}
+				s.fail(err)
+				return
+			}
+
+			if req == nil {
+				continue
+			}
+		}
+
+		coalesce := s.coalesce
+
+		s.lock.Unlock()
+		err := s.writeData(req.data, !coalesce)
+		s.lock.Lock()
+
+		if err != nil {
+			req.done <- err
+			for _, done := range unflushed {
+				done.done <- err
+			}
+			s.fail(err)
+			return
+		}
+
+		if coalesce {
+			unflushed = append(unflushed, req)
+		} else {
+			req.done <- nil
+		}
+	}
+}
+
+// Write data, flushing if requested.
+func (s *writeScheduler) writeData(data []byte, flush bool) (err error) {
+	var n int
+
+	for {
+		if n, err = s.writer.Write(data); err != nil {
+			return
+		}
+
+		if n == len(data) {
+			break
+		}
+
+		data = data[n:]
+	}
+
+	if flush {
+		err = s.writer.Flush()
+	}
+
+	return
+}
@@ -0,0 +1,237 @@
+package goentangle
+
+import (
+	"bufio"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type gatedWriter struct {
+	entered chan struct{}
+	gate    chan struct{}
+	lock    sync.Mutex
+	written []string
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	select {
+	case w.entered <- struct{}{}:
+	default:
+	}
+	<-w.gate
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.written = append(w.written, string(p))
+	return len(p), nil
+}
+
+func (s *writeScheduler) queued() (n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return
+}
+
+func waitForQueued(t *testing.T, s *writeScheduler, n int) {
+	for deadline := time.Now().Add(time.Second); s.queued() != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d queued writes", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Test that queued writes are written in order of priority.
+func TestWriteSchedulerPriority(t *testing.T) {
+	writer := &gatedWriter{
+		entered: make(chan struct{}, 1),
+		gate:    make(chan struct{}),
+	}
+	s := newWriteScheduler(bufio.NewWriter(writer))
+	defer s.close()
+
+	var wg sync.WaitGroup
+	write := func(data string, priority writePriority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.write([]byte(data), priority); err != nil {
+				t.Errorf("Unexpected error writing %s: %v", data, err)
+			}
+		}()
+	}
+
+	// Block the writer goroutine on a first write, then queue the rest.
+	write("first", bulkWritePriority)
+	<-writer.entered
+
+	write("bulk", bulkWritePriority)
+	waitForQueued(t, s, 1)
+	write("normal", normalWritePriority)
+	waitForQueued(t, s, 2)
+	write("control", controlWritePriority)
+	waitForQueued(t, s, 3)
+
+	close(writer.gate)
+	wg.Wait()
+
+	expected := []string{"first", "control", "normal", "bulk"}
+	if len(writer.written) != len(expected) {
+		t.Fatalf("Expected writes %v, but got %v", expected, writer.written)
+	}
+	for i := range expected {
+		if writer.written[i] != expected[i] {
+			t.Fatalf("Expected writes %v, but got %v", expected, writer.written)
+		}
+	}
+}
+
+// Test that more urgent writes are interleaved between the parts of a write.
+func TestWriteSchedulerParts(t *testing.T) {
+	writer := &gatedWriter{
+		entered: make(chan struct{}, 1),
+		gate:    make(chan struct{}),
+	}
+	s := newWriteScheduler(bufio.NewWriter(writer))
+	defer s.close()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if err := s.write([]byte("first"), bulkWritePriority); err != nil {
+			t.Errorf("Unexpected error writing first: %v", err)
+		}
+	}()
+	<-writer.entered
+
+	go func() {
+		defer wg.Done()
+		if err := s.writeParts([][]byte{[]byte("a"), []byte("b"), []byte("c")}, bulkWritePriority); err != nil {
+			t.Errorf("Unexpected error writing parts: %v", err)
+		}
+	}()
+	waitForQueued(t, s, 3)
+
+	// Let the first write through and block the writer goroutine on the first
+	// part, then queue a control write.
+	writer.gate <- struct{}{}
+	waitForQueued(t, s, 2)
+
+	go func() {
+		defer wg.Done()
+		if err := s.write([]byte("control"), controlWritePriority); err != nil {
+			t.Errorf("Unexpected error writing control: %v", err)
+		}
+	}()
+	waitForQueued(t, s, 3)
+
+	close(writer.gate)
+	wg.Wait()
+
+	expected := []string{"first", "a", "control", "b", "c"}
+	if strings.Join(writer.written, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected writes %v, but got %v", expected, writer.written)
+	}
+}
+
+// Test that lower priority writes are not starved.
+func TestWriteSchedulerStarvation(t *testing.T) {
+	s := &writeScheduler{}
+	s.queues[bulkWritePriority] = []*writeRequest{{data: []byte("bulk")}}
+
+	for i := 0; i < writeStarvationLimit; i++ {
+		s.queues[controlWritePriority] = append(s.queues[controlWritePriority], &writeRequest{data: []byte("control")})
+		if req := s.next(); string(req.data) != "control" {
+			t.Fatalf("Expected control write, but got %s", req.data)
+		}
+	}
+
+	s.queues[controlWritePriority] = append(s.queues[controlWritePriority], &writeRequest{data: []byte("control")})
+	if req := s.next(); string(req.data) != "bulk" {
+		t.Errorf("Expected starved bulk write to be promoted, but got %s", req.data)
+	}
+}
+
+// Test that writes fail once the scheduler is closed.
+func TestWriteSchedulerClose(t *testing.T) {
+	writer := &gatedWriter{
+		gate: make(chan struct{}),
+	}
+	close(writer.gate)
+
+	s := newWriteScheduler(bufio.NewWriter(writer))
+	s.close()
+
+	if err := s.write([]byte("data"), normalWritePriority); err != io.EOF {
+		t.Errorf("Expected %v writing to closed scheduler, but got %v", io.EOF, err)
+	}
+}
+
+// Test that coalesced writes are flushed together.
+func TestWriteSchedulerCoalescing(t *testing.T) {
+	for _, linger := range []time.Duration{0, time.Millisecond} {
+		writer := &gatedWriter{
+			entered: make(chan struct{}, 1),
+			gate:    make(chan struct{}),
+		}
+		s := newWriteScheduler(bufio.NewWriter(writer))
+		s.coalesceWrites(linger)
+
+		var wg sync.WaitGroup
+		write := func(data string) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.write([]byte(data), normalWritePriority); err != nil {
+					t.Errorf("Unexpected error writing %s: %v", data, err)
+				}
+			}()
+		}
+
+		// Block the writer goroutine flushing a first write, then queue the
+		// rest.
+		write("first")
+		<-writer.entered
+
+		for i := 0; i < 10; i++ {
+			write("next")
+		}
+		waitForQueued(t, s, 10)
+
+		close(writer.gate)
+		wg.Wait()
+		s.close()
+
+		if len(writer.written) != 2 {
+			t.Errorf("Expected 2 flushes with linger %v, but got %d", linger, len(writer.written))
+		}
+	}
+}
+
+// Test that connections only hold a writer goroutine while writing.
+func TestWriteSchedulerIdle(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		conn := NewConn(discardConn{}, "idle")
+		if _, err := conn.SendNotification("method", []interface{}{}); err != nil {
+			t.Fatalf("Error sending notification: %v", err)
+		}
+	}
+
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected idle connections to hold no goroutines, but %d remain", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}